@@ -72,10 +72,27 @@ Templates for cronjob
 {{- end -}}
 
 {{/*
-Get a hostname from URL
+Name of a CronJob, at most 52 characters because the Job controller appends a suffix to it. A longer name is cut and
+ends with a hash of the complete name, so jobs whose names only differ after the cut don't collide.
+*/}}
+{{- define "cronjobname" -}}
+{{- $name := printf "%s-%s" (include "trackableappname" .context) .jobName -}}
+{{- if gt (len $name) 52 -}}
+{{- printf "%s-%s" ($name | trunc 43 | trimSuffix "-") ($name | sha256sum | trunc 8) -}}
+{{- else -}}
+{{- $name -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Get a hostname from URL, without the scheme, user, port and path
 */}}
 {{- define "hostname" -}}
-{{- . | trimPrefix "http://" |  trimPrefix "https://" | trimSuffix "/" | trim | quote -}}
+{{- $url := . | trim -}}
+{{- if not (contains "://" $url) -}}
+{{- $url = printf "http://%s" $url -}}
+{{- end -}}
+{{- (urlParse $url).hostname | lower | quote -}}
 {{- end -}}
 
 {{/*
@@ -95,14 +112,14 @@ Generate a name for a Persistent Volume Claim
 {{- end -}}
 
 {{- define "sharedlabels" -}}
-app: {{ template "appname" . }}
+app: {{ include "appname" . | quote }}
 chart: "{{ .Chart.Name }}-{{ .Chart.Version| replace "+" "_" }}"
-release: {{ .Release.Name }}
+release: {{ .Release.Name | quote }}
 heritage: {{ .Release.Service }}
-app.kubernetes.io/name: {{ template "appname" . }}
+app.kubernetes.io/name: {{ include "appname" . | quote }}
 helm.sh/chart: "{{ .Chart.Name }}-{{ .Chart.Version| replace "+" "_" }}"
 app.kubernetes.io/managed-by: {{ .Release.Service }}
-app.kubernetes.io/instance: {{ .Release.Name }}
+app.kubernetes.io/instance: {{ .Release.Name | quote }}
 {{- if .Values.extraLabels }}
 {{ toYaml $.Values.extraLabels }}
 {{- end }}
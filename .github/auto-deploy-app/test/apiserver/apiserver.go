@@ -0,0 +1,46 @@
+// Package apiserver validates rendered manifests like an API server does when the chart is installed, e.g. the syntax
+// of label values, resource quantities and port names, which the JSON schemas of the resources don't check.
+//
+// Server applies the manifests with a server-side apply dry run to a kube-apiserver started with envtest, which
+// reports the errors of the real validation and admission. Fake implements a subset of the validation in memory
+// for tests without the kube-apiserver and etcd binaries. Both report a problem per invalid field of an object.
+package apiserver
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Problem is a field of a rendered object an API server rejects, Path is empty if the whole object is rejected.
+type Problem struct {
+	Resource string
+	Path     string
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s", p.Resource, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Resource, p.Path, p.Message)
+}
+
+// Validator validates the manifests of a rendering installed into a namespace.
+type Validator interface {
+	Validate(ctx context.Context, namespace, manifests string) ([]Problem, error)
+}
+
+func resourceName(obj *unstructured.Unstructured) string {
+	return obj.GetKind() + "/" + obj.GetName()
+}
+
+func fieldProblems(resource string, errs field.ErrorList) []Problem {
+	var problems []Problem
+	for _, err := range errs {
+		problems = append(problems, Problem{Resource: resource, Path: err.Field, Message: err.ErrorBody()})
+	}
+	return problems
+}
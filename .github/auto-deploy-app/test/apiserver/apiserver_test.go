@@ -0,0 +1,337 @@
+package apiserver
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const deployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+  labels:
+    app: production
+spec:
+  selector:
+    matchLabels:
+      app: production
+  template:
+    metadata:
+      labels:
+        app: production
+    spec:
+      volumes:
+      - name: data
+        emptyDir: {}
+      containers:
+      - name: auto-deploy-app
+        image: registry/app:1
+        ports:
+        - name: web
+          containerPort: 5000
+        env:
+        - name: DATABASE_URL
+          value: postgres://
+        volumeMounts:
+        - name: data
+          mountPath: /data
+        resources:
+          requests:
+            cpu: 100m
+          limits:
+            cpu: 200m
+`
+
+func TestFake(t *testing.T) {
+	tcs := []struct {
+		name      string
+		manifests string
+
+		expectedProblems []string
+	}{
+		{
+			name:      "valid deployment",
+			manifests: deployment,
+		},
+		{
+			name: "invalid metadata",
+			manifests: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: Production_Config
+  labels:
+    app: "not a label value"
+  annotations:
+    -tier/web: web
+`,
+			expectedProblems: []string{
+				`ConfigMap/Production_Config: metadata.name: Invalid value: "Production_Config": a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+				`ConfigMap/Production_Config: metadata.labels: Invalid value: "not a label value": a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')`,
+				`ConfigMap/Production_Config: metadata.annotations: Invalid value: "-tier/web": prefix part a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+			},
+		},
+		{
+			name: "invalid pod template",
+			manifests: `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+spec:
+  selector:
+    matchLabels:
+      app: production
+  template:
+    metadata:
+      labels:
+        app: staging
+    spec:
+      containers:
+      - name: auto_deploy_app
+        image: registry/app:1
+        ports:
+        - name: a-very-long-port-name
+          containerPort: 70000
+        env:
+        - name: 1_DATABASE_URL
+        volumeMounts:
+        - name: data
+          mountPath: /data
+        resources:
+          requests:
+            memory: 2Gi
+          limits:
+            memory: 1Gi
+`,
+			expectedProblems: []string{
+				`Deployment/production: spec.template.spec.containers[0].name: Invalid value: "auto_deploy_app": a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')`,
+				`Deployment/production: spec.template.spec.containers[0].ports[0].name: Invalid value: "a-very-long-port-name": must be no more than 15 characters`,
+				`Deployment/production: spec.template.spec.containers[0].ports[0].containerPort: Invalid value: 70000: must be between 1 and 65535, inclusive`,
+				`Deployment/production: spec.template.spec.containers[0].env[0].name: Invalid value: "1_DATABASE_URL": a valid environment variable name must consist of alphabetic characters, digits, '_', '-', or '.', and must not start with a digit (e.g. 'my.env-name',  or 'MY_ENV.NAME',  or 'MyEnvName1', regex used for validation is '[-._a-zA-Z][-._a-zA-Z0-9]*')`,
+				`Deployment/production: spec.template.spec.containers[0].volumeMounts[0].name: Not found: "data"`,
+				`Deployment/production: spec.template.spec.containers[0].resources.requests[memory]: Invalid value: "2Gi": must be less than or equal to memory limit`,
+				"Deployment/production: spec.template.metadata.labels: Invalid value: map[string]string{\"app\":\"staging\"}: `selector` does not match template `labels`",
+			},
+		},
+		{
+			name: "invalid resource quantity",
+			manifests: `---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: production-db-migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: registry/app:1
+        resources:
+          requests:
+            cpu: 100 millicores
+`,
+			expectedProblems: []string{
+				`Job/production-db-migrate: spec.template: Invalid value: quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'`,
+			},
+		},
+		{
+			name: "long cron job name",
+			manifests: `---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: review-feature-branch-with-a-long-name-auto-deploy-job1
+spec:
+  schedule: "*/5 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job1
+            image: registry/app:1
+`,
+			expectedProblems: []string{
+				`CronJob/review-feature-branch-with-a-long-name-auto-deploy-job1: metadata.name: Invalid value: "review-feature-branch-with-a-long-name-auto-deploy-job1": must be no more than 52 characters`,
+			},
+		},
+		{
+			name: "invalid service",
+			manifests: `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: 1-production
+spec:
+  type: Internal
+  ports:
+  - port: 80
+    targetPort: web
+    nodePort: 30001
+  - name: metrics
+    port: 9090
+    targetPort: 90000
+`,
+			expectedProblems: []string{
+				`Service/1-production: metadata.name: Invalid value: "1-production": a DNS-1035 label must consist of lower case alphanumeric characters or '-', start with an alphabetic character, and end with an alphanumeric character (e.g. 'my-name',  or 'abc-123', regex used for validation is '[a-z]([-a-z0-9]*[a-z0-9])?')`,
+				`Service/1-production: spec.type: Unsupported value: "Internal": supported values: "ClusterIP", "ExternalName", "LoadBalancer", "NodePort"`,
+				`Service/1-production: spec.ports[0].name: Required value`,
+				`Service/1-production: spec.ports[1].targetPort: Invalid value: 90000: must be between 1 and 65535, inclusive`,
+			},
+		},
+		{
+			name: "cluster IP service with a node port",
+			manifests: `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production
+spec:
+  ports:
+  - port: 80
+    nodePort: 30001
+`,
+			expectedProblems: []string{
+				"Service/production: spec.ports[0].nodePort: Forbidden: may not be used when `type` is 'ClusterIP'",
+			},
+		},
+		{
+			name: "invalid ingress, autoscaler, disruption budget and claim",
+			manifests: `---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: production
+spec:
+  rules:
+  - host: Production.Example.com
+    http:
+      paths:
+      - path: api
+        pathType: Prefix
+  - host: "*.example.com"
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: production
+spec:
+  minReplicas: 3
+  maxReplicas: 2
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: production
+spec:
+  minAvailable: 1
+  maxUnavailable: 1
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: production-data
+spec:
+  resources:
+    requests:
+      storage: 0Gi
+`,
+			expectedProblems: []string{
+				`Ingress/production: spec.rules[0].host: Invalid value: "Production.Example.com": a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+				`Ingress/production: spec.rules[0].http.paths[0].path: Invalid value: "api": must be an absolute path`,
+				"HorizontalPodAutoscaler/production: spec.maxReplicas: Invalid value: 2: must be greater than or equal to `minReplicas`",
+				`PodDisruptionBudget/production: spec: Invalid value: minAvailable and maxUnavailable cannot be both set`,
+				`PersistentVolumeClaim/production-data: spec.accessModes: Required value: at least 1 access mode is required`,
+				`PersistentVolumeClaim/production-data: spec.resources.requests[storage]: Invalid value: "0": must be greater than zero`,
+			},
+		},
+		{
+			name: "custom resources",
+			manifests: `---
+apiVersion: database.crossplane.io/v1alpha1
+kind: PostgreSQLInstance
+metadata:
+  name: production-postgres
+spec:
+  anything: goes
+`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			problems, err := Fake{}.Validate(context.Background(), "default", tc.manifests)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.Equal(t, tc.expectedProblems, messages)
+		})
+	}
+}
+
+func TestFake_InvalidManifests(t *testing.T) {
+	_, err := Fake{}.Validate(context.Background(), "default", "kind: [Deployment")
+	require.Error(t, err)
+}
+
+func TestErrorProblems(t *testing.T) {
+	err := apierrors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "production", field.ErrorList{
+		field.Invalid(field.NewPath("spec", "replicas"), -1, "must be greater than or equal to 0"),
+		field.Required(field.NewPath("spec", "selector"), ""),
+	})
+	require.Equal(t, []Problem{
+		{Resource: "Deployment/production", Path: "spec.replicas", Message: "Invalid value: -1: must be greater than or equal to 0"},
+		{Resource: "Deployment/production", Path: "spec.selector", Message: "Required value"},
+	}, errorProblems("Deployment/production", err))
+
+	err = apierrors.NewForbidden(schema.GroupResource{Resource: "deployments"}, "production", nil)
+	problems := errorProblems("Deployment/production", err)
+	require.Len(t, problems, 1)
+	require.Empty(t, problems[0].Path)
+}
+
+// TestServer applies the same manifests as TestFake to a kube-apiserver if $KUBEBUILDER_ASSETS is set.
+func TestServer(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("$KUBEBUILDER_ASSETS is not set")
+	}
+	server, err := Start()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, server.Stop()) }()
+
+	problems, err := server.Validate(context.Background(), "review", deployment)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	problems, err = server.Validate(context.Background(), "review", `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production
+spec:
+  ports:
+  - port: 80
+  - name: metrics
+    port: 70000
+`)
+	require.NoError(t, err)
+	var messages []string
+	for _, problem := range problems {
+		messages = append(messages, problem.String())
+	}
+	require.Equal(t, []string{
+		"Service/production: spec.ports[0].name: Required value",
+		"Service/production: spec.ports[1].port: Invalid value: 70000: must be between 1 and 65535, inclusive",
+	}, messages)
+}
@@ -0,0 +1,437 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	corev1 "k8s.io/api/core/v1"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/api/validation/path"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Fake validates manifests in memory with a subset of the validation of the kube-apiserver 1.25, with the same
+// messages:
+//
+//   - the metadata of every object, e.g. the syntax of names, label keys and values and annotations,
+//   - the length of CronJob names, which the Job controller appends a suffix to,
+//   - the labels, selectors, containers, volumes and resource quantities of the pod templates of workloads,
+//   - the ports of Services, the hosts and paths of Ingresses, the replicas of HorizontalPodAutoscalers,
+//     PodDisruptionBudgets and the storage requests of PersistentVolumeClaims.
+//
+// Unlike an API server it doesn't reject kinds it doesn't know, e.g. custom resources.
+type Fake struct{}
+
+var _ Validator = Fake{}
+
+// clusterScoped are the kinds without a namespace.
+var clusterScoped = map[string]bool{
+	"ClusterRole":              true,
+	"ClusterRoleBinding":       true,
+	"CustomResourceDefinition": true,
+	"IngressClass":             true,
+	"Namespace":                true,
+	"PersistentVolume":         true,
+	"PriorityClass":            true,
+	"StorageClass":             true,
+}
+
+// podTemplates are the paths of the pod templates of the workload kinds.
+var podTemplates = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// Validate validates the objects of the manifests, objects without a namespace are validated in namespace.
+func (Fake) Validate(_ context.Context, namespace, manifests string) ([]Problem, error) {
+	release, err := integrity.Parse(manifests)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	for _, obj := range release.Objects() {
+		problems = append(problems, fieldProblems(resourceName(obj), validateObject(obj.DeepCopy(), namespace))...)
+	}
+	return problems, nil
+}
+
+func validateObject(obj *unstructured.Unstructured, namespace string) field.ErrorList {
+	kind := obj.GetKind()
+	namespaced := !clusterScoped[kind]
+	if namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(namespace)
+	}
+	allErrs := apivalidation.ValidateObjectMetaAccessor(obj, namespaced, nameValidator(kind), field.NewPath("metadata"))
+
+	switch kind {
+	case "CronJob":
+		if len(obj.GetName()) > validation.DNS1035LabelMaxLength-11 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "name"), obj.GetName(), "must be no more than 52 characters"))
+		}
+	case "Service":
+		allErrs = append(allErrs, validateService(obj)...)
+	case "Ingress":
+		allErrs = append(allErrs, validateIngress(obj)...)
+	case "HorizontalPodAutoscaler":
+		allErrs = append(allErrs, validateAutoscaler(obj)...)
+	case "PodDisruptionBudget":
+		allErrs = append(allErrs, validateDisruptionBudget(obj)...)
+	case "PersistentVolumeClaim":
+		allErrs = append(allErrs, validateClaim(obj)...)
+	}
+	if templatePath, ok := podTemplates[kind]; ok {
+		allErrs = append(allErrs, validateWorkload(obj, templatePath)...)
+	}
+	return allErrs
+}
+
+// nameValidator returns the validation of the names of a kind.
+func nameValidator(kind string) apivalidation.ValidateNameFunc {
+	switch kind {
+	case "Service":
+		return apivalidation.NameIsDNS1035Label
+	case "Namespace":
+		return apivalidation.NameIsDNSLabel
+	case "Role", "RoleBinding", "ClusterRole", "ClusterRoleBinding":
+		return path.ValidatePathSegmentName
+	}
+	return apivalidation.NameIsDNSSubdomain
+}
+
+// convert converts the map at fieldPath of obj to out, e.g. a pod template to a corev1.PodTemplateSpec.
+func convert(obj *unstructured.Unstructured, out interface{}, fieldPath ...string) (found bool, errs field.ErrorList) {
+	fldPath := field.NewPath(fieldPath[0], fieldPath[1:]...)
+	value, found, err := unstructured.NestedMap(obj.Object, fieldPath...)
+	if err != nil {
+		return false, field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, err.Error())}
+	}
+	if !found {
+		return false, nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(value, out); err != nil {
+		return false, field.ErrorList{field.Invalid(fldPath, field.OmitValueType{}, err.Error())}
+	}
+	return true, nil
+}
+
+// number returns the number at fieldPath of obj, numbers of parsed manifests are float64.
+func number(obj *unstructured.Unstructured, fieldPath ...string) (int64, bool) {
+	value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, fieldPath...)
+	if !found {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func validateWorkload(obj *unstructured.Unstructured, templatePath []string) field.ErrorList {
+	fldPath := field.NewPath(templatePath[0], templatePath[1:]...)
+	var template corev1.PodTemplateSpec
+	found, allErrs := convert(obj, &template, templatePath...)
+	if !found {
+		if len(allErrs) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath, ""))
+		}
+		return allErrs
+	}
+	allErrs = append(allErrs, metav1validation.ValidateLabels(template.Labels, fldPath.Child("metadata", "labels"))...)
+	allErrs = append(allErrs, apivalidation.ValidateAnnotations(template.Annotations, fldPath.Child("metadata", "annotations"))...)
+	allErrs = append(allErrs, validatePodSpec(&template.Spec, fldPath.Child("spec"))...)
+
+	if obj.GetKind() == "Job" || obj.GetKind() == "CronJob" {
+		return allErrs
+	}
+	selectorPath := field.NewPath("spec", "selector")
+	var selector metav1.LabelSelector
+	found, errs := convert(obj, &selector, "spec", "selector")
+	allErrs = append(allErrs, errs...)
+	if !found {
+		if len(errs) == 0 {
+			allErrs = append(allErrs, field.Required(selectorPath, ""))
+		}
+		return allErrs
+	}
+	allErrs = append(allErrs, metav1validation.ValidateLabelSelector(&selector, selectorPath)...)
+	if len(selector.MatchLabels)+len(selector.MatchExpressions) == 0 {
+		allErrs = append(allErrs, field.Invalid(selectorPath, selector, "empty selector is invalid for deployment"))
+	} else if s, err := metav1.LabelSelectorAsSelector(&selector); err == nil && !s.Matches(labels.Set(template.Labels)) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("metadata", "labels"), template.Labels, "`selector` does not match template `labels`"))
+	}
+	return allErrs
+}
+
+func validatePodSpec(spec *corev1.PodSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	volumes := map[string]bool{}
+	for i, volume := range spec.Volumes {
+		namePath := fldPath.Child("volumes").Index(i).Child("name")
+		allErrs = append(allErrs, validateDNS1123Label(volume.Name, namePath)...)
+		if volumes[volume.Name] {
+			allErrs = append(allErrs, field.Duplicate(namePath, volume.Name))
+		}
+		volumes[volume.Name] = true
+	}
+
+	if len(spec.Containers) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("containers"), ""))
+	}
+	containers := map[string]bool{}
+	for _, list := range []struct {
+		name       string
+		containers []corev1.Container
+	}{{"initContainers", spec.InitContainers}, {"containers", spec.Containers}} {
+		for i := range list.containers {
+			container := &list.containers[i]
+			containerPath := fldPath.Child(list.name).Index(i)
+			if containers[container.Name] {
+				allErrs = append(allErrs, field.Duplicate(containerPath.Child("name"), container.Name))
+			}
+			containers[container.Name] = true
+			allErrs = append(allErrs, validateContainer(container, volumes, containerPath)...)
+		}
+	}
+	return allErrs
+}
+
+func validateContainer(container *corev1.Container, volumes map[string]bool, fldPath *field.Path) field.ErrorList {
+	allErrs := validateDNS1123Label(container.Name, fldPath.Child("name"))
+	if container.Image == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("image"), ""))
+	}
+
+	for i, port := range container.Ports {
+		portPath := fldPath.Child("ports").Index(i)
+		if port.Name != "" {
+			for _, msg := range validation.IsValidPortName(port.Name) {
+				allErrs = append(allErrs, field.Invalid(portPath.Child("name"), port.Name, msg))
+			}
+		}
+		for _, msg := range validation.IsValidPortNum(int(port.ContainerPort)) {
+			allErrs = append(allErrs, field.Invalid(portPath.Child("containerPort"), port.ContainerPort, msg))
+		}
+	}
+
+	for i, env := range container.Env {
+		namePath := fldPath.Child("env").Index(i).Child("name")
+		if env.Name == "" {
+			allErrs = append(allErrs, field.Required(namePath, ""))
+		}
+		for _, msg := range validation.IsEnvVarName(env.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, env.Name, msg))
+		}
+	}
+
+	for i, mount := range container.VolumeMounts {
+		mountPath := fldPath.Child("volumeMounts").Index(i)
+		if !volumes[mount.Name] {
+			allErrs = append(allErrs, field.NotFound(mountPath.Child("name"), mount.Name))
+		}
+		if mount.MountPath == "" {
+			allErrs = append(allErrs, field.Required(mountPath.Child("mountPath"), ""))
+		}
+	}
+
+	return append(allErrs, validateResources(container.Resources, fldPath.Child("resources"))...)
+}
+
+func validateResources(resources corev1.ResourceRequirements, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, list := range []struct {
+		name      string
+		resources corev1.ResourceList
+	}{{"limits", resources.Limits}, {"requests", resources.Requests}} {
+		for _, name := range sortedResourceNames(list.resources) {
+			quantity := list.resources[name]
+			if quantity.Sign() < 0 {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child(list.name).Key(string(name)), quantity.String(), "must be greater than or equal to 0"))
+			}
+		}
+	}
+	for _, name := range sortedResourceNames(resources.Requests) {
+		request := resources.Requests[name]
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("requests").Key(string(name)), request.String(),
+				fmt.Sprintf("must be less than or equal to %s limit", name)))
+		}
+	}
+	return allErrs
+}
+
+func sortedResourceNames(resources corev1.ResourceList) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+var serviceTypes = []string{
+	string(corev1.ServiceTypeClusterIP),
+	string(corev1.ServiceTypeExternalName),
+	string(corev1.ServiceTypeLoadBalancer),
+	string(corev1.ServiceTypeNodePort),
+}
+
+func validateService(obj *unstructured.Unstructured) field.ErrorList {
+	var spec corev1.ServiceSpec
+	found, allErrs := convert(obj, &spec, "spec")
+	if !found {
+		return allErrs
+	}
+	specPath := field.NewPath("spec")
+
+	if spec.Type != "" && !contains(serviceTypes, string(spec.Type)) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("type"), spec.Type, serviceTypes))
+	}
+	if len(spec.Ports) == 0 && spec.Type != corev1.ServiceTypeExternalName {
+		allErrs = append(allErrs, field.Required(specPath.Child("ports"), ""))
+	}
+
+	names := map[string]bool{}
+	for i, port := range spec.Ports {
+		portPath := specPath.Child("ports").Index(i)
+		if port.Name == "" && len(spec.Ports) > 1 {
+			allErrs = append(allErrs, field.Required(portPath.Child("name"), ""))
+		} else if port.Name != "" {
+			allErrs = append(allErrs, validateDNS1123Label(port.Name, portPath.Child("name"))...)
+			if names[port.Name] {
+				allErrs = append(allErrs, field.Duplicate(portPath.Child("name"), port.Name))
+			}
+			names[port.Name] = true
+		}
+		for _, msg := range validation.IsValidPortNum(int(port.Port)) {
+			allErrs = append(allErrs, field.Invalid(portPath.Child("port"), port.Port, msg))
+		}
+		switch {
+		case port.TargetPort.Type == intstr.String:
+			for _, msg := range validation.IsValidPortName(port.TargetPort.StrVal) {
+				allErrs = append(allErrs, field.Invalid(portPath.Child("targetPort"), port.TargetPort.StrVal, msg))
+			}
+		case port.TargetPort.IntVal != 0:
+			for _, msg := range validation.IsValidPortNum(int(port.TargetPort.IntVal)) {
+				allErrs = append(allErrs, field.Invalid(portPath.Child("targetPort"), port.TargetPort.IntVal, msg))
+			}
+		}
+		if port.NodePort != 0 && (spec.Type == "" || spec.Type == corev1.ServiceTypeClusterIP) {
+			allErrs = append(allErrs, field.Forbidden(portPath.Child("nodePort"), "may not be used when `type` is 'ClusterIP'"))
+		}
+	}
+	return allErrs
+}
+
+// validateIngress validates the rules of networking.k8s.io/v1 and v1beta1 Ingresses, which have the same hosts and paths.
+func validateIngress(obj *unstructured.Unstructured) field.ErrorList {
+	var allErrs field.ErrorList
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	for i, rule := range rules {
+		rule, _ := rule.(map[string]interface{})
+		rulePath := field.NewPath("spec", "rules").Index(i)
+
+		if host, _ := rule["host"].(string); host != "" {
+			msgs := validation.IsDNS1123Subdomain(host)
+			if strings.Contains(host, "*") {
+				msgs = validation.IsWildcardDNS1123Subdomain(host)
+			}
+			for _, msg := range msgs {
+				allErrs = append(allErrs, field.Invalid(rulePath.Child("host"), host, msg))
+			}
+		}
+
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for j, p := range paths {
+			p, _ := p.(map[string]interface{})
+			pathType, _ := p["pathType"].(string)
+			value, _ := p["path"].(string)
+			if (pathType == "Exact" || pathType == "Prefix") && !strings.HasPrefix(value, "/") {
+				allErrs = append(allErrs, field.Invalid(rulePath.Child("http", "paths").Index(j).Child("path"), value, "must be an absolute path"))
+			}
+		}
+	}
+	return allErrs
+}
+
+func validateAutoscaler(obj *unstructured.Unstructured) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	minReplicas, hasMin := number(obj, "spec", "minReplicas")
+	if hasMin && minReplicas < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("minReplicas"), minReplicas, "must be greater than or equal to 1"))
+	}
+	maxReplicas, _ := number(obj, "spec", "maxReplicas")
+	if maxReplicas < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("maxReplicas"), maxReplicas, "must be greater than 0"))
+	} else if hasMin && maxReplicas < minReplicas {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("maxReplicas"), maxReplicas, "must be greater than or equal to `minReplicas`"))
+	}
+	return allErrs
+}
+
+func validateDisruptionBudget(obj *unstructured.Unstructured) field.ErrorList {
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	_, hasMinAvailable := spec["minAvailable"]
+	_, hasMaxUnavailable := spec["maxUnavailable"]
+	if hasMinAvailable && hasMaxUnavailable {
+		return field.ErrorList{field.Invalid(field.NewPath("spec"), field.OmitValueType{}, "minAvailable and maxUnavailable cannot be both set")}
+	}
+	return nil
+}
+
+func validateClaim(obj *unstructured.Unstructured) field.ErrorList {
+	var spec corev1.PersistentVolumeClaimSpec
+	found, allErrs := convert(obj, &spec, "spec")
+	if !found {
+		return allErrs
+	}
+	specPath := field.NewPath("spec")
+	if len(spec.AccessModes) == 0 {
+		allErrs = append(allErrs, field.Required(specPath.Child("accessModes"), "at least 1 access mode is required"))
+	}
+	storagePath := specPath.Child("resources", "requests").Key(string(corev1.ResourceStorage))
+	if storage, ok := spec.Resources.Requests[corev1.ResourceStorage]; !ok {
+		allErrs = append(allErrs, field.Required(storagePath, ""))
+	} else if storage.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(storagePath, storage.String(), "must be greater than zero"))
+	}
+	return allErrs
+}
+
+func validateDNS1123Label(value string, fldPath *field.Path) field.ErrorList {
+	if value == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsDNS1123Label(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
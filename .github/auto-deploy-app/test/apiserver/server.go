@@ -0,0 +1,129 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// fieldManager is the field manager of the server-side apply dry runs.
+const fieldManager = "auto-deploy-app-test"
+
+// Server is a kube-apiserver and etcd started with envtest from the binaries in $KUBEBUILDER_ASSETS,
+// e.g. installed with `setup-envtest use -p path 1.25.x`.
+type Server struct {
+	env       *envtest.Environment
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	mapper    meta.RESTMapper
+}
+
+var _ Validator = (*Server)(nil)
+
+// Start starts a kube-apiserver, call Stop to stop it.
+func Start() (*Server, error) {
+	env := &envtest.Environment{}
+	config, err := env.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the kube-apiserver, is $KUBEBUILDER_ASSETS set? %w", err)
+	}
+
+	s := &Server{env: env}
+	if s.clientset, err = kubernetes.NewForConfig(config); err != nil {
+		_ = env.Stop()
+		return nil, err
+	}
+	if s.dynamic, err = dynamic.NewForConfig(config); err != nil {
+		_ = env.Stop()
+		return nil, err
+	}
+	s.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(s.clientset.Discovery()))
+	return s, nil
+}
+
+// Stop stops the kube-apiserver and etcd.
+func (s *Server) Stop() error {
+	return s.env.Stop()
+}
+
+// Validate applies the objects of the manifests to namespace with a server-side apply dry run and reports the
+// causes of the errors. The namespace is created if it doesn't exist.
+func (s *Server) Validate(ctx context.Context, namespace, manifests string) ([]Problem, error) {
+	release, err := integrity.Parse(manifests)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createNamespace(ctx, namespace); err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	for _, obj := range release.Objects() {
+		if err := s.apply(ctx, namespace, obj); err != nil {
+			problems = append(problems, errorProblems(resourceName(obj), err)...)
+		}
+	}
+	return problems, nil
+}
+
+func (s *Server) createNamespace(ctx context.Context, namespace string) error {
+	_, err := s.clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) apply(ctx context.Context, namespace string, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	var resource dynamic.ResourceInterface = s.dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() != "" {
+			namespace = obj.GetNamespace()
+		}
+		resource = s.dynamic.Resource(mapping.Resource).Namespace(namespace)
+	}
+	force := true
+	_, err = resource.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		DryRun:       []string{metav1.DryRunAll},
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	return err
+}
+
+// errorProblems returns a problem per cause of an API error, or a problem for the whole object.
+func errorProblems(resource string, err error) []Problem {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil && len(status.Status().Details.Causes) > 0 {
+		var problems []Problem
+		for _, cause := range status.Status().Details.Causes {
+			problems = append(problems, Problem{Resource: resource, Path: cause.Field, Message: cause.Message})
+		}
+		return problems
+	}
+	return []Problem{{Resource: resource, Message: err.Error()}}
+}
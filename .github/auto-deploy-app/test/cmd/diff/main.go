@@ -0,0 +1,124 @@
+// Command diff renders the chart twice and prints the resources that differ, see package diff. The renderings differ
+// in their values files, charts or git revisions of the chart, the other flags apply to both.
+//
+//	cd test
+//	go run ./cmd/diff -from-values old-values.yaml -to-values new-values.yaml
+//	go run ./cmd/diff -from-chart path/to/old/auto-deploy-app -f ../values.yaml production
+//	go run ./cmd/diff -from-ref v2.118.0 -json review-feature
+//
+// With -json the result is printed as JSON, e.g. for a comment on a pull request. The exit code is 1 if the renderings
+// differ and 2 if the chart can't be rendered, like diff(1).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/cmd/internal/flagutil"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/diff"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/render"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/upgrade"
+)
+
+// side is the chart and values of one rendering.
+type side struct {
+	chart       string
+	ref         string
+	valuesFiles flagutil.Strings
+}
+
+func main() {
+	chartPath := flag.String("chart", "..", "path of the chart")
+	var from, to side
+	flag.StringVar(&from.chart, "from-chart", "", "path of the chart to diff from, -chart by default")
+	flag.StringVar(&to.chart, "to-chart", "", "path of the chart to diff to, -chart by default")
+	flag.StringVar(&from.ref, "from-ref", "", "git revision of the chart to diff from, the working tree by default")
+	flag.StringVar(&to.ref, "to-ref", "", "git revision of the chart to diff to, the working tree by default")
+	flag.Var(&from.valuesFiles, "from-values", "values file of the rendering to diff from, can be repeated")
+	flag.Var(&to.valuesFiles, "to-values", "values file of the rendering to diff to, can be repeated")
+	namespace := flag.String("namespace", "", "namespace of the release")
+	var valuesFiles, setValues, ignoredLabels flagutil.Strings
+	flag.Var(&valuesFiles, "f", "values file of both renderings, can be repeated")
+	flag.Var(&setValues, "set", "value of both renderings as key=value like helm --set, can be repeated")
+	flag.Var(&ignoredLabels, "ignore-label", "label to ignore in addition to "+strings.Join(diff.DefaultIgnoredLabels, " and ")+", can be repeated")
+	jsonOutput := flag.Bool("json", false, "print the result as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [release]\n\nThe release name defaults to production.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	releaseName := "production"
+	if flag.NArg() > 0 {
+		releaseName = flag.Arg(0)
+	}
+
+	opts := render.Options{Namespace: *namespace, SetValues: map[string]string{}}
+	for _, value := range setValues {
+		key, value, ok := strings.Cut(value, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "-set %s: expected key=value\n", key)
+			os.Exit(2)
+		}
+		opts.SetValues[key] = value
+	}
+
+	renderings := make([]string, 2)
+	for i, s := range []side{from, to} {
+		if s.chart == "" {
+			s.chart = *chartPath
+		}
+		sideOpts := opts
+		sideOpts.ValuesFiles = append(append([]string{}, valuesFiles...), s.valuesFiles...)
+
+		var err error
+		renderings[i], err = renderSide(s, releaseName, sideOpts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	result, err := diff.Compare(renderings[0], renderings[1], append(diff.DefaultIgnoredLabels, ignoredLabels...))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *jsonOutput {
+		err = result.WriteJSON(os.Stdout)
+	} else {
+		err = result.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(result.Resources) > 0 {
+		os.Exit(1)
+	}
+}
+
+// renderSide renders the chart of a side, at its git revision if it has one.
+func renderSide(s side, releaseName string, opts render.Options) (string, error) {
+	chartPath := s.chart
+	if s.ref != "" {
+		dir, cleanup, err := upgrade.ChartAt(s.chart, s.ref)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		chartPath = dir
+	}
+
+	renderer, err := render.Load(chartPath)
+	if err != nil {
+		return "", err
+	}
+	output, err := renderer.Render(releaseName, opts)
+	if err != nil && s.ref != "" {
+		return "", fmt.Errorf("chart at %s: %w", s.ref, err)
+	}
+	return output, err
+}
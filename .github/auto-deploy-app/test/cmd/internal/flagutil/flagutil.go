@@ -0,0 +1,16 @@
+// Package flagutil has the flag types the commands share.
+package flagutil
+
+import "strings"
+
+// Strings collects the values of a repeated flag, e.g. `-f a.yaml -f b.yaml`.
+type Strings []string
+
+func (f *Strings) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *Strings) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,198 @@
+// Command matrix runs the template tests once per Kubernetes version in schema.KubernetesVersions
+// and reports which tests fail on which version.
+//
+// Every run passes -kube-version to the tests, which render the templates with `--kube-version` and only the API
+// versions served by that version, and check that it serves the rendered apiVersions and kinds.
+//
+//	cd test
+//	go run ./cmd/matrix                                # all versions, ./templates
+//	go run ./cmd/matrix -versions 1.21,1.25 -run Ingress
+//
+// The exit code is 1 if a test fails on any version.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/schema"
+)
+
+// testEvent is a line of `go test -json`, see `go doc test2json`.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+type versionResult struct {
+	version string
+	failed  []string
+	// output of a failing package without failing tests, e.g. a compile error
+	packageOutput string
+	err           error
+}
+
+func main() {
+	versions := flag.String("versions", strings.Join(schema.KubernetesVersions, ","), "comma separated Kubernetes minor versions")
+	run := flag.String("run", "", "only run tests matching the regular expression, like go test -run")
+	verbose := flag.Bool("v", false, "print the output of failing tests")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [packages]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	packages := flag.Args()
+	if len(packages) == 0 {
+		packages = []string{"./templates"}
+	}
+
+	failed := false
+	var results []versionResult
+	for _, version := range strings.Split(*versions, ",") {
+		version = strings.TrimSpace(version)
+		if version == "" {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "testing Kubernetes %s\n", version)
+		result := runVersion(version, *run, packages, *verbose)
+		if result.err != nil || len(result.failed) > 0 || result.packageOutput != "" {
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	printReport(os.Stdout, results)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runVersion(version, run string, packages []string, verbose bool) versionResult {
+	args := []string{"test", "-json"}
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+	args = append(args, packages...)
+	args = append(args, "-args", "-kube-version", version)
+
+	cmd := exec.Command("go", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return versionResult{version: version, err: err}
+	}
+	if err := cmd.Start(); err != nil {
+		return versionResult{version: version, err: err}
+	}
+
+	result := parseEvents(stdout, verbose)
+	result.version = version
+
+	// go test exits with 1 if tests fail, which is reported per test instead
+	if err := cmd.Wait(); err != nil && len(result.failed) == 0 && result.packageOutput == "" {
+		result.err = fmt.Errorf("go %s: %w\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return result
+}
+
+func parseEvents(r io.Reader, verbose bool) versionResult {
+	var result versionResult
+	output := map[string]*strings.Builder{}
+	failedTests := map[string]bool{}
+	var packageOutput strings.Builder
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// not an event, e.g. a build error printed by go test
+			packageOutput.WriteString(scanner.Text() + "\n")
+			continue
+		}
+		key := path.Base(event.Package) + " " + event.Test
+		switch event.Action {
+		case "output":
+			if output[key] == nil {
+				output[key] = &strings.Builder{}
+			}
+			output[key].WriteString(event.Output)
+		case "fail":
+			if event.Test != "" {
+				failedTests[key] = true
+			} else if !hasFailedTest(failedTests, key) && output[key] != nil {
+				packageOutput.WriteString(output[key].String())
+			}
+		}
+	}
+
+	for key := range failedTests {
+		// only report the innermost failing subtests
+		if hasFailedTest(failedTests, key+"/") {
+			continue
+		}
+		name := key
+		if verbose && output[key] != nil {
+			name += "\n" + indent(output[key].String())
+		}
+		result.failed = append(result.failed, name)
+	}
+	sort.Strings(result.failed)
+	result.packageOutput = packageOutput.String()
+	return result
+}
+
+func hasFailedTest(failedTests map[string]bool, prefix string) bool {
+	for key := range failedTests {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func printReport(w io.Writer, results []versionResult) {
+	var supported []string
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			fmt.Fprintf(w, "Kubernetes %s: ERROR %s\n", result.version, result.err)
+		case result.packageOutput != "":
+			fmt.Fprintf(w, "Kubernetes %s: FAIL\n%s", result.version, indent(result.packageOutput))
+		case len(result.failed) > 0:
+			fmt.Fprintf(w, "Kubernetes %s: FAIL (%d tests)\n", result.version, len(result.failed))
+			for _, test := range result.failed {
+				fmt.Fprintf(w, "    %s\n", test)
+			}
+		default:
+			fmt.Fprintf(w, "Kubernetes %s: ok\n", result.version)
+			supported = append(supported, result.version)
+		}
+	}
+	if len(supported) == 0 {
+		fmt.Fprintln(w, "supported Kubernetes versions: none")
+		return
+	}
+	fmt.Fprintf(w, "supported Kubernetes versions: %s\n", strings.Join(supported, ", "))
+}
+
+func indent(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "        " + line
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
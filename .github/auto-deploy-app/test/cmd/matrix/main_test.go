@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEvents(t *testing.T) {
+	events := `{"Action":"run","Package":"example.com/test/templates","Test":"TestIngress"}
+{"Action":"run","Package":"example.com/test/templates","Test":"TestIngress/v1"}
+{"Action":"output","Package":"example.com/test/templates","Test":"TestIngress/v1","Output":"not served\n"}
+{"Action":"fail","Package":"example.com/test/templates","Test":"TestIngress/v1"}
+{"Action":"pass","Package":"example.com/test/templates","Test":"TestIngress/v1beta1"}
+{"Action":"fail","Package":"example.com/test/templates","Test":"TestIngress"}
+{"Action":"pass","Package":"example.com/test/templates","Test":"TestService"}
+{"Action":"output","Package":"example.com/test/templates","Output":"FAIL\n"}
+{"Action":"fail","Package":"example.com/test/templates"}
+`
+
+	result := parseEvents(strings.NewReader(events), false)
+	require.Equal(t, []string{"templates TestIngress/v1"}, result.failed)
+	require.Empty(t, result.packageOutput)
+
+	result = parseEvents(strings.NewReader(events), true)
+	require.Equal(t, []string{"templates TestIngress/v1\n        not served\n"}, result.failed)
+}
+
+func TestParseEvents_BuildFailure(t *testing.T) {
+	events := `# example.com/test/templates
+templates/helpers.go:1:1: expected 'package', found 'EOF'
+{"Action":"output","Package":"example.com/test/templates","Output":"FAIL\texample.com/test/templates [build failed]\n"}
+{"Action":"fail","Package":"example.com/test/templates"}
+`
+
+	result := parseEvents(strings.NewReader(events), false)
+	require.Empty(t, result.failed)
+	require.Contains(t, result.packageOutput, "expected 'package'")
+	require.Contains(t, result.packageOutput, "[build failed]")
+}
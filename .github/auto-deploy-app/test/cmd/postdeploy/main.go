@@ -0,0 +1,140 @@
+// Command postdeploy checks a release after `helm upgrade --wait`: its Deployments are available and its URLs,
+// service.url and service.additionalHosts, serve the app, see package postdeploy. The release is read from the Helm
+// storage of the cluster of KUBE_CONFIG, a base64 encoded kubeconfig like in deploy.yml, or else of $KUBECONFIG or
+// ~/.kube/config. The HTTP checks are a YAML list of postdeploy.Check:
+//
+//	cd test
+//	go run ./cmd/postdeploy -namespace my-app -junit postdeploy.xml my-app
+//	go run ./cmd/postdeploy -namespace my-app -checks checks.yaml -min-tls-validity 168h my-app
+//
+// with a checks file like:
+//
+//	# checks.yaml
+//	- path: /health
+//	  status: 200
+//	  body: ^ok$
+//
+// The exit code is 1 if a check fails and 2 if the release can't be read.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/postdeploy"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	namespace := flag.String("namespace", os.Getenv("KUBE_NAMESPACE"), "namespace of the release")
+	checksFile := flag.String("checks", "", "YAML file with the HTTP checks, by default the URLs respond with a status below 400")
+	junit := flag.String("junit", "", "write a JUnit report to the file")
+	timeout := flag.Duration("timeout", postdeploy.DefaultTimeout, "time each check is retried")
+	interval := flag.Duration("interval", postdeploy.DefaultInterval, "time between the attempts of a check")
+	minTLSValidity := flag.Duration("min-tls-validity", 0, "time the certificates of https URLs must be valid for at least")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] release\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *namespace == "" {
+		exit(fmt.Errorf("-namespace is required"))
+	}
+	checks := postdeploy.DefaultChecks
+	if *checksFile != "" {
+		data, err := os.ReadFile(*checksFile)
+		if err != nil {
+			exit(err)
+		}
+		if err := yaml.UnmarshalStrict(data, &checks); err != nil {
+			exit(fmt.Errorf("%s: %w", *checksFile, err))
+		}
+	}
+
+	config, err := restConfig()
+	if err != nil {
+		exit(err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		exit(err)
+	}
+	var releases *storage.Storage
+	switch helmDriver := os.Getenv("HELM_DRIVER"); helmDriver {
+	case "", "secret", "secrets":
+		releases = storage.Init(driver.NewSecrets(clientset.CoreV1().Secrets(*namespace)))
+	case "configmap", "configmaps":
+		releases = storage.Init(driver.NewConfigMaps(clientset.CoreV1().ConfigMaps(*namespace)))
+	default:
+		exit(fmt.Errorf("unsupported HELM_DRIVER %q", helmDriver))
+	}
+	rel, err := releases.Deployed(flag.Arg(0))
+	if err != nil {
+		exit(fmt.Errorf("release %s: %w", flag.Arg(0), err))
+	}
+
+	checker := &postdeploy.Checker{
+		Clientset:      clientset,
+		Timeout:        *timeout,
+		Interval:       *interval,
+		MinTLSValidity: *minTLSValidity,
+	}
+	report, err := checker.Check(context.Background(), rel, checks)
+	if err != nil {
+		exit(err)
+	}
+	for _, result := range report.Results {
+		if result.Failure == "" {
+			fmt.Printf("ok   %s\n", result.Name)
+		} else {
+			fmt.Printf("FAIL %s: %s\n", result.Name, result.Failure)
+		}
+	}
+	if *junit != "" {
+		file, err := os.Create(*junit)
+		if err == nil {
+			err = report.WriteJUnit(file)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			exit(err)
+		}
+	}
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
+
+// restConfig returns the config of KUBE_CONFIG or of the default kubeconfig.
+func restConfig() (*rest.Config, error) {
+	if encoded := os.Getenv("KUBE_CONFIG"); encoded != "" {
+		data, err := deploy.DecodeKubeConfig(encoded)
+		if err != nil {
+			return nil, err
+		}
+		return clientcmd.RESTConfigFromKubeConfig(data)
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{},
+	).ClientConfig()
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
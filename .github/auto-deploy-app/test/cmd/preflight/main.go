@@ -0,0 +1,132 @@
+// Command preflight renders the chart with the API versions of the cluster and checks that the Secrets,
+// ServiceAccounts, IngressClasses, StorageClasses and PriorityClasses it references exist, see package preflight.
+// The cluster is the one of KUBE_CONFIG, a base64 encoded kubeconfig like in deploy.yml, or else of $KUBECONFIG or
+// ~/.kube/config:
+//
+//	cd ../deploy
+//	go run ./cmd/deployvalues -app-name my-app -docker-tag my-app:1 -kube-ingress-base-domain example.com \
+//	  -o ../auto-deploy-app/test/values.yaml
+//	cd ../auto-deploy-app/test
+//	go run ./cmd/preflight -namespace my-app -f values.yaml -set application.secretName=my-app my-app
+//
+// The exit code is 1 if a referenced resource doesn't exist, warnings don't change it, and 2 if the chart can't be
+// rendered or the cluster can't be reached.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/cmd/internal/flagutil"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/preflight"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/render"
+	"helm.sh/helm/v3/pkg/action"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func main() {
+	chartPath := flag.String("chart", "..", "path of the chart")
+	namespace := flag.String("namespace", os.Getenv("KUBE_NAMESPACE"), "namespace of the release")
+	var valuesFiles, setValues flagutil.Strings
+	flag.Var(&valuesFiles, "f", "values file, can be repeated")
+	flag.Var(&setValues, "set", "value as key=value like helm --set, can be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [release]\n\nThe release name defaults to production.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	releaseName := "production"
+	if flag.NArg() > 0 {
+		releaseName = flag.Arg(0)
+	}
+	if *namespace == "" {
+		exit(fmt.Errorf("-namespace is required"))
+	}
+	opts := render.Options{
+		Namespace:   *namespace,
+		ValuesFiles: valuesFiles,
+		SetValues:   map[string]string{},
+	}
+	for _, value := range setValues {
+		key, value, ok := strings.Cut(value, "=")
+		if !ok {
+			exit(fmt.Errorf("-set %s: expected key=value", key))
+		}
+		opts.SetValues[key] = value
+	}
+
+	config, err := restConfig()
+	if err != nil {
+		exit(err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		exit(err)
+	}
+	// like helm, the chart is rendered with the API versions of the cluster, e.g. networking.k8s.io/v1/Ingress
+	apiVersions, err := action.GetVersionSet(clientset.Discovery())
+	if err != nil {
+		exit(err)
+	}
+	opts.APIVersions = apiVersions
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		exit(err)
+	}
+	opts.KubeVersion = version.GitVersion
+
+	renderer, err := render.Load(*chartPath)
+	if err != nil {
+		exit(err)
+	}
+	manifests, err := renderer.Render(releaseName, opts)
+	if err != nil {
+		exit(err)
+	}
+	problems, err := preflight.Check(context.Background(), clientset, *namespace, manifests)
+	if err != nil {
+		exit(err)
+	}
+
+	failed := false
+	for _, problem := range problems {
+		failed = failed || !problem.Warning
+	}
+	if len(problems) == 0 {
+		fmt.Printf("preflight of %s in %s: ok\n", releaseName, *namespace)
+		return
+	}
+	fmt.Printf("preflight of %s in %s:\n", releaseName, *namespace)
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// restConfig returns the config of KUBE_CONFIG or of the default kubeconfig.
+func restConfig() (*rest.Config, error) {
+	if encoded := os.Getenv("KUBE_CONFIG"); encoded != "" {
+		data, err := deploy.DecodeKubeConfig(encoded)
+		if err != nil {
+			return nil, err
+		}
+		return clientcmd.RESTConfigFromKubeConfig(data)
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{},
+	).ClientConfig()
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
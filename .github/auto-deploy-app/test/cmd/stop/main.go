@@ -0,0 +1,100 @@
+// Command stop removes the deployment of an app that deploy.yml or cmd/deploy created in its own namespace, see
+// package stop. The names are derived from the app name like in deploy, the namespace is KUBE_NAMESPACE of the
+// deployment, and the cluster is the one of KUBE_CONFIG, a base64 encoded kubeconfig, or else of $KUBECONFIG or
+// ~/.kube/config:
+//
+//	cd test
+//	go run ./cmd/stop -app-name my-app -namespace my-app-review
+//
+// The names don't depend on the ref, so it refuses to run in the namespace every ref of the app is deployed to by
+// default, the app name, where it would remove the deployment of the default branch.
+// The removed resources and the ones that don't exist are printed. The exit code is 2 if a resource can't be removed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/stop"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+	"k8s.io/client-go/kubernetes"
+)
+
+func main() {
+	var config stop.Config
+	flag.StringVar(&config.AppName, "app-name", os.Getenv("APP_NAME"), "APP_NAME")
+	flag.BoolVar(&config.DeriveNames, "derive-names", false, "derive DNS-1123 names instead of the names of deploy.yml")
+	flag.StringVar(&config.Namespace, "namespace", os.Getenv("KUBE_NAMESPACE"), "namespace of only this deployment, required")
+	flag.BoolVar(&config.DeleteSecret, "delete-secret", false, "delete the Secret with the K8S_SECRET_ variables")
+	flag.BoolVar(&config.DeleteClaims, "delete-pvcs", false, "delete the PersistentVolumeClaims of the app and PostgreSQL, with their data")
+	flag.DurationVar(&config.Timeout, "timeout", stop.DefaultTimeout, "time to wait for each Kubernetes operation")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if config.AppName == "" {
+		exit(fmt.Errorf("-app-name is required"))
+	}
+	stopper, err := newStopper()
+	if err != nil {
+		exit(err)
+	}
+	report, err := stopper.Stop(context.Background(), config)
+	if report != nil {
+		if writeErr := report.Write(os.Stdout); err == nil {
+			err = writeErr
+		}
+	}
+	if err != nil {
+		exit(err)
+	}
+}
+
+// newStopper returns a stopper for the cluster of KUBE_CONFIG, or of the kubeconfig of helm if it isn't set.
+func newStopper() (*stop.Stopper, error) {
+	getters, err := deploy.RESTClientGetters(cli.New(), os.Getenv("KUBE_CONFIG"))
+	if err != nil {
+		return nil, err
+	}
+	getter, err := getters("")
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := getter.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	log := func(format string, v ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", v...)
+	}
+
+	return &stop.Stopper{
+		Clientset: clientset,
+		Helm: func(namespace string) (*action.Configuration, error) {
+			getter, err := getters(namespace)
+			if err != nil {
+				return nil, err
+			}
+			cfg := &action.Configuration{}
+			if err := cfg.Init(getter, namespace, os.Getenv("HELM_DRIVER"), log); err != nil {
+				return nil, err
+			}
+			return cfg, nil
+		},
+	}, nil
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
@@ -0,0 +1,111 @@
+// Command upgrade renders the chart at a previous git revision and at the working tree with the same values and
+// reports the immutable fields that change, which would break `helm upgrade --atomic` of existing releases.
+// See package upgrade for the checked fields.
+//
+//	cd test
+//	go run ./cmd/upgrade                                 # from the latest tag before HEAD
+//	go run ./cmd/upgrade -from v2.118.0 -f ../values.yaml -set application.track=canary production
+//
+// The exit code is 1 if an immutable field changes and 2 if the chart can't be rendered.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/cmd/internal/flagutil"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/render"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/upgrade"
+)
+
+func main() {
+	from := flag.String("from", "", "git revision to upgrade from, the latest tag before HEAD by default")
+	chartPath := flag.String("chart", "..", "path of the chart")
+	namespace := flag.String("namespace", "", "namespace of the release")
+	var valuesFiles, setValues flagutil.Strings
+	flag.Var(&valuesFiles, "f", "values file, can be repeated")
+	flag.Var(&setValues, "set", "value as key=value like helm --set, can be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [release]\n\nThe release name defaults to production.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	releaseName := "production"
+	if flag.NArg() > 0 {
+		releaseName = flag.Arg(0)
+	}
+
+	opts := render.Options{
+		Namespace:   *namespace,
+		ValuesFiles: valuesFiles,
+		SetValues:   map[string]string{},
+	}
+	for _, value := range setValues {
+		key, value, ok := strings.Cut(value, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "-set %s: expected key=value\n", key)
+			os.Exit(2)
+		}
+		opts.SetValues[key] = value
+	}
+
+	problems, err := check(*chartPath, *from, releaseName, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// check renders the chart at the revision from and in chartPath, prints the result and returns the problems.
+func check(chartPath, from, releaseName string, opts render.Options) ([]upgrade.Problem, error) {
+	if from == "" {
+		tag, err := upgrade.PreviousTag(chartPath)
+		if err != nil {
+			return nil, fmt.Errorf("no previous tag, use -from: %w", err)
+		}
+		from = tag
+	}
+
+	previousChart, cleanup, err := upgrade.ChartAt(chartPath, from)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	previous, err := renderChart(previousChart, releaseName, opts)
+	if err != nil {
+		return nil, fmt.Errorf("chart at %s: %w", from, err)
+	}
+	current, err := renderChart(chartPath, releaseName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	problems, err := upgrade.Check(previous, current)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) == 0 {
+		fmt.Printf("upgrading %s from %s: ok\n", releaseName, from)
+		return nil, nil
+	}
+	fmt.Printf("upgrading %s from %s changes immutable fields:\n", releaseName, from)
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	return problems, nil
+}
+
+func renderChart(chartPath, releaseName string, opts render.Options) (string, error) {
+	renderer, err := render.Load(chartPath)
+	if err != nil {
+		return "", err
+	}
+	return renderer.Render(releaseName, opts)
+}
@@ -0,0 +1,70 @@
+// Command valueslint checks values files of apps, e.g. `.github/auto-deploy-values.yaml`, against the chart,
+// see package valueslint.
+//
+//	cd test
+//	go run ./cmd/valueslint path/to/app/.github/auto-deploy-values.yaml
+//	go run ./cmd/valueslint -strict -chart path/to/auto-deploy-app < auto-deploy-values.yaml
+//
+// Problems are printed as "file:line: severity: path: message". The exit code is 1 if there are errors,
+// or warnings with -strict, and 2 if a file can't be read or parsed, so the command can run as a pre-commit hook.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/valueslint"
+)
+
+func main() {
+	chartPath := flag.String("chart", "..", "path of the chart")
+	strict := flag.Bool("strict", false, "exit with 1 on warnings too")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [files]\n\nReads stdin without files or with -.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	linter, err := valueslint.Load(*chartPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	exitCode := 0
+	for _, file := range files {
+		var content []byte
+		if file == "-" {
+			content, err = io.ReadAll(os.Stdin)
+			file = "stdin"
+		} else {
+			content, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+
+		problems, err := linter.Lint(content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			exitCode = 2
+			continue
+		}
+		for _, problem := range problems {
+			fmt.Printf("%s:%s\n", file, problem)
+			if exitCode == 0 && (problem.Severity == valueslint.Error || *strict) {
+				exitCode = 1
+			}
+		}
+	}
+	os.Exit(exitCode)
+}
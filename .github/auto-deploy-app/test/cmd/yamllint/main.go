@@ -0,0 +1,60 @@
+// Command yamllint checks YAML files with the rules of the template tests, see package yamllint.
+//
+//	cd test
+//	helm template production .. | go run ./cmd/yamllint
+//	go run ./cmd/yamllint -max-line-length 120 ../values.yaml
+//
+// Problems are printed as "file:line:column: message (rule)". The exit code is 1 if there are problems
+// and 2 if a file can't be read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/yamllint"
+)
+
+func main() {
+	config := yamllint.DefaultConfig
+	flag.IntVar(&config.MaxLineLength, "max-line-length", config.MaxLineLength, "maximum line length, 0 disables the check")
+	flag.BoolVar(&config.IndentSequences, "indent-sequences", config.IndentSequences, "require block sequences to be indented relative to their key")
+	flag.BoolVar(&config.AllowBlankLines, "allow-blank-lines", config.AllowBlankLines, "allow empty lines and lines containing only whitespace")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [files]\n\nReads stdin without files or with -.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	exitCode := 0
+	for _, file := range files {
+		var input []byte
+		var err error
+		if file == "-" {
+			input, err = io.ReadAll(os.Stdin)
+			file = "stdin"
+		} else {
+			input, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+
+		for _, problem := range yamllint.Lint(string(input), config) {
+			fmt.Printf("%s:%s\n", file, problem)
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
+	}
+	os.Exit(exitCode)
+}
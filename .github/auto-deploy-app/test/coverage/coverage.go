@@ -0,0 +1,352 @@
+// Package coverage reports which values the templates of a chart reference and which of them are never set by a test.
+//
+// A Recorder collects the values of every rendering, e.g. the keys of `--set` flags and the keys of values files,
+// together with the rendered templates. Analyze scans the templates for `.Values` references, including the options of
+// `range` variables like `$jobConfig.schedule`, which becomes `cronjobs.*.schedule`, and reports per template the
+// references no rendering of that template sets.
+//
+// Paths are compared by segment: list indexes are dropped, so `workers.worker1.command[0]` sets `workers.*.command`,
+// and a path sets every reference it is nested in, e.g. `hpa.metrics[0].type` sets `hpa.metrics`.
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Path is a values path split into its keys.
+type Path []string
+
+// String joins the keys with dots, escaping dots in keys like `--set` does.
+func (p Path) String() string {
+	keys := make([]string, len(p))
+	for i, key := range p {
+		keys[i] = strings.ReplaceAll(key, ".", `\.`)
+	}
+	return strings.Join(keys, ".")
+}
+
+// ParseSetPath parses the key of a `--set` flag, e.g. `workers.worker1.command[0]` or `extraLabels.app\.kubernetes\.io/name`.
+func ParseSetPath(key string) Path {
+	var path Path
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			path = append(path, current.String())
+			current.Reset()
+		}
+	}
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case c == '\\' && i+1 < len(key):
+			i++
+			current.WriteByte(key[i])
+		case c == '.':
+			flush()
+		case c == '[':
+			// list index
+			flush()
+			if end := strings.IndexByte(key[i:], ']'); end >= 0 {
+				i += end
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return path
+}
+
+// Paths returns the paths of the leaves of values, e.g. of a values file. Lists are descended without an index,
+// empty maps and lists are leaves.
+func Paths(values map[string]interface{}) []Path {
+	var paths []Path
+	var walk func(prefix Path, value interface{})
+	walk = func(prefix Path, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 && len(prefix) > 0 {
+				paths = append(paths, prefix)
+			}
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(append(prefix[:len(prefix):len(prefix)], key), v[key])
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				paths = append(paths, prefix)
+			}
+			for _, item := range v {
+				walk(prefix, item)
+			}
+		default:
+			paths = append(paths, prefix)
+		}
+	}
+	walk(nil, values)
+	return unique(paths)
+}
+
+// ValuesFilePaths reads a values file and returns the paths of its leaves.
+func ValuesFilePaths(file string) ([]Path, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return Paths(values), nil
+}
+
+// covers reports whether setting the path sets the reference: the reference is a prefix of the path,
+// a `*` in the reference matches any key.
+func covers(reference, path Path) bool {
+	if len(path) < len(reference) {
+		return false
+	}
+	for i, key := range reference {
+		if key != "*" && key != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// related reports whether one path is nested in the other.
+func related(a, b Path) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return covers(a, b)
+}
+
+type rendering struct {
+	// templates are the rendered templates, all templates if empty
+	templates []string
+	paths     []Path
+}
+
+// Recorder collects the values of the renderings of a test run. It is safe for concurrent use.
+type Recorder struct {
+	mu         sync.Mutex
+	renderings []rendering
+}
+
+// Record records a rendering of the templates, all templates if empty, with values at the paths.
+func (r *Recorder) Record(templates []string, paths []Path) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.renderings = append(r.renderings, rendering{templates: templates, paths: paths})
+}
+
+// Report is the values coverage of the templates of a chart.
+type Report struct {
+	// References is the number of distinct values references of all templates,
+	// Exercised the number of them a rendering of a referencing template sets.
+	References int `json:"references"`
+	Exercised  int `json:"exercised"`
+
+	Templates []TemplateReport `json:"templates"`
+	// Unreferenced are the keys of values.yaml no template references.
+	Unreferenced []string `json:"unreferenced"`
+}
+
+// TemplateReport is the values coverage of a template.
+type TemplateReport struct {
+	Template    string   `json:"template"`
+	References  int      `json:"references"`
+	Exercised   int      `json:"exercised"`
+	Unexercised []string `json:"unexercised"`
+}
+
+// Analyze compares the values references of the templates of the chart in chartDir with the recorded values.
+// Partials (templates starting with `_`) are included by every template, so every rendering renders them.
+func (r *Recorder) Analyze(chartDir string) (*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(chartDir, "templates", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Unreferenced: []string{}}
+	references := map[string]bool{}
+	exercised := map[string]bool{}
+	var allReferences []Path
+	for _, file := range files {
+		if ext := filepath.Ext(file); ext != ".yaml" && ext != ".tpl" {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		template := "templates/" + filepath.Base(file)
+		partial := strings.HasPrefix(filepath.Base(file), "_")
+
+		templateReport := TemplateReport{Template: template, Unexercised: []string{}}
+		for _, reference := range References(string(content)) {
+			allReferences = append(allReferences, reference)
+			templateReport.References++
+			references[reference.String()] = true
+			if r.exercised(template, partial, reference) {
+				templateReport.Exercised++
+				exercised[reference.String()] = true
+			} else {
+				templateReport.Unexercised = append(templateReport.Unexercised, reference.String())
+			}
+		}
+		if templateReport.References > 0 {
+			report.Templates = append(report.Templates, templateReport)
+		}
+	}
+	report.References = len(references)
+	report.Exercised = len(exercised)
+
+	defaults, err := ValuesFilePaths(filepath.Join(chartDir, "values.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range defaults {
+		referenced := false
+		for _, reference := range allReferences {
+			if related(reference, key) {
+				referenced = true
+				break
+			}
+		}
+		if !referenced {
+			report.Unreferenced = append(report.Unreferenced, key.String())
+		}
+	}
+	return report, nil
+}
+
+func (r *Recorder) exercised(template string, partial bool, reference Path) bool {
+	for _, rendering := range r.renderings {
+		if !partial && len(rendering.templates) > 0 && !contains(rendering.templates, template) {
+			continue
+		}
+		for _, path := range rendering.paths {
+			if covers(reference, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	// valuesReference matches `.Values.a.b`, `$.Values.a.b` and `.context.Values.a.b`
+	valuesReference = regexp.MustCompile(`\.Values((?:\.\w+)+)`)
+	// variableReference matches `$config.a.b`
+	variableReference = regexp.MustCompile(`\$(\w+)((?:\.\w+)+)`)
+	// rangeBinding matches `range $key, $value := <reference>` and `range $value := <reference>`
+	rangeBinding = regexp.MustCompile(`range\s+(?:\$\w+\s*,\s*)?\$(\w+)\s*:?=\s*(\S+)`)
+	// rangeMapBinding matches the value variable of `range $key, $value := <reference>`
+	rangeMapBinding = regexp.MustCompile(`range\s+\$\w+\s*,\s*\$\w+\s*:?=`)
+)
+
+// References returns the values paths a template references, sorted and without duplicates.
+// The variables of `range` actions are resolved: the value of a map entry is `*`, list items have no key.
+func References(template string) []Path {
+	variables := map[string]Path{}
+	for _, m := range rangeBinding.FindAllStringSubmatchIndex(template, -1) {
+		variable := template[m[2]:m[3]]
+		target := strings.TrimSuffix(template[m[4]:m[5]], "}}")
+		var path Path
+		if ref := valuesReference.FindStringSubmatch(target); ref != nil && strings.HasSuffix(target, ref[0]) {
+			path = splitReference(ref[1])
+		} else if ref := variableReference.FindStringSubmatch(target); ref != nil && variables[ref[1]] != nil {
+			path = append(append(Path{}, variables[ref[1]]...), splitReference(ref[2])...)
+		} else {
+			continue
+		}
+		if rangeMapBinding.MatchString(template[m[0]:m[5]]) {
+			path = append(path, "*")
+		}
+		variables[variable] = path
+	}
+
+	var references []Path
+	for _, m := range valuesReference.FindAllStringSubmatch(template, -1) {
+		references = append(references, splitReference(m[1]))
+	}
+	for _, m := range variableReference.FindAllStringSubmatch(template, -1) {
+		if prefix, ok := variables[m[1]]; ok {
+			references = append(references, append(append(Path{}, prefix...), splitReference(m[2])...))
+		}
+	}
+	return unique(references)
+}
+
+func splitReference(reference string) Path {
+	return Path(strings.Split(strings.TrimPrefix(reference, "."), "."))
+}
+
+func unique(paths []Path) []Path {
+	seen := map[string]bool{}
+	var result []Path
+	for _, path := range paths {
+		if len(path) == 0 || seen[path.String()] {
+			continue
+		}
+		seen[path.String()] = true
+		result = append(result, path)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].String() < result[j].String() })
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes the report for humans, listing the unexercised references per template.
+func (r *Report) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "values coverage: %d of %d referenced values are set by a test (%s)\n",
+		r.Exercised, r.References, percent(r.Exercised, r.References)); err != nil {
+		return err
+	}
+	for _, template := range r.Templates {
+		fmt.Fprintf(w, "\n%s: %d of %d references set (%s)\n",
+			template.Template, template.Exercised, template.References, percent(template.Exercised, template.References))
+		for _, reference := range template.Unexercised {
+			fmt.Fprintf(w, "  %s\n", reference)
+		}
+	}
+	if len(r.Unreferenced) > 0 {
+		fmt.Fprintf(w, "\nvalues.yaml keys no template references:\n")
+		for _, key := range r.Unreferenced {
+			fmt.Fprintf(w, "  %s\n", key)
+		}
+	}
+	return nil
+}
+
+func percent(part, total int) string {
+	if total == 0 {
+		return "100%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)*100/float64(total))
+}
@@ -0,0 +1,137 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pathStrings(paths []Path) []string {
+	var result []string
+	for _, path := range paths {
+		result = append(result, path.String())
+	}
+	return result
+}
+
+func TestParseSetPath(t *testing.T) {
+	for key, expected := range map[string]Path{
+		"hpa.enabled":                            {"hpa", "enabled"},
+		"workers.worker1.command[0]":             {"workers", "worker1", "command"},
+		"hpa.metrics[0].resource.name":           {"hpa", "metrics", "resource", "name"},
+		`extraLabels.app\.kubernetes\.io/name`:   {"extraLabels", "app.kubernetes.io/name"},
+		"persistence.volumes[10].claim.size":     {"persistence", "volumes", "claim", "size"},
+		`ingress.annotations.nginx\.ingress/foo`: {"ingress", "annotations", "nginx.ingress/foo"},
+	} {
+		require.Equal(t, expected, ParseSetPath(key), key)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	paths := Paths(map[string]interface{}{
+		"service": map[string]interface{}{"enabled": true, "annotations": map[string]interface{}{}},
+		"persistence": map[string]interface{}{
+			"volumes": []interface{}{
+				map[string]interface{}{"name": "data", "claim": map[string]interface{}{"size": "8Gi"}},
+				map[string]interface{}{"name": "logs"},
+			},
+		},
+		"tolerations": []interface{}{},
+	})
+	require.Equal(t, []string{
+		"persistence.volumes.claim.size",
+		"persistence.volumes.name",
+		"service.annotations",
+		"service.enabled",
+		"tolerations",
+	}, pathStrings(paths))
+}
+
+func TestReferences(t *testing.T) {
+	template := `{{- if and (not .Values.application.initializeCommand) .Values.cronjobs -}}
+{{- range $jobName, $jobConfig:= .Values.cronjobs }}
+  schedule: {{ $jobConfig.schedule | quote }}
+  {{- with $nodeSelectorConfig := default $.Values.nodeSelector $jobConfig.nodeSelector -}}
+  {{- range $jobConfig.command }}
+  - {{ . }}
+  {{- end }}
+{{- end }}
+{{- range $volume := .Values.persistence.volumes }}
+  name: {{ $volume.claim.size }}
+{{- end }}
+{{ include "sharedlabels" (dict "context" . "name" .Values.service.name) }}
+{{ $unknown.field }}
+`
+	require.Equal(t, []string{
+		"application.initializeCommand",
+		"cronjobs",
+		"cronjobs.*.command",
+		"cronjobs.*.nodeSelector",
+		"cronjobs.*.schedule",
+		"nodeSelector",
+		"persistence.volumes",
+		"persistence.volumes.claim.size",
+		"service.name",
+	}, pathStrings(References(template)))
+}
+
+func TestAnalyze(t *testing.T) {
+	chart := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(chart, "templates"), 0o755))
+	files := map[string]string{
+		"values.yaml": `
+service:
+  enabled: true
+  name: web
+workers: {}
+unused:
+  key: value
+`,
+		"templates/service.yaml":       `{{ if .Values.service.enabled }}{{ .Values.service.name }}{{ end }}`,
+		"templates/worker.yaml":        `{{ range $name, $worker := .Values.workers }}{{ $worker.command }}{{ $worker.replicas }}{{ end }}`,
+		"templates/_helpers.tpl":       `{{ define "name" }}{{ .Values.nameOverride }}{{ end }}`,
+		"templates/NOTES.txt":          `{{ .Values.notes }}`,
+		"templates/no-references.yaml": `kind: ConfigMap`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(chart, name), []byte(content), 0o644))
+	}
+
+	var recorder Recorder
+	recorder.Record([]string{"templates/service.yaml"}, []Path{ParseSetPath("service.enabled"), ParseSetPath("nameOverride")})
+	// workers.worker1.command is set, but templates/worker.yaml isn't rendered
+	recorder.Record([]string{"templates/service.yaml"}, []Path{ParseSetPath("workers.worker1.command[0]")})
+	recorder.Record(nil, []Path{ParseSetPath("workers.worker1.replicas")})
+
+	report, err := recorder.Analyze(chart)
+	require.NoError(t, err)
+	require.Equal(t, &Report{
+		References: 6,
+		Exercised:  4,
+		Templates: []TemplateReport{
+			{Template: "templates/_helpers.tpl", References: 1, Exercised: 1, Unexercised: []string{}},
+			{Template: "templates/service.yaml", References: 2, Exercised: 1, Unexercised: []string{"service.name"}},
+			{Template: "templates/worker.yaml", References: 3, Exercised: 2, Unexercised: []string{"workers.*.command"}},
+		},
+		Unreferenced: []string{"unused.key"},
+	}, report)
+
+	var text strings.Builder
+	require.NoError(t, report.WriteText(&text))
+	require.Equal(t, `values coverage: 4 of 6 referenced values are set by a test (67%)
+
+templates/_helpers.tpl: 1 of 1 references set (100%)
+
+templates/service.yaml: 1 of 2 references set (50%)
+  service.name
+
+templates/worker.yaml: 2 of 3 references set (67%)
+  workers.*.command
+
+values.yaml keys no template references:
+  unused.key
+`, text.String())
+}
@@ -0,0 +1,263 @@
+// Package diff compares two renderings of a chart resource by resource, e.g. before and after a chart or values change.
+//
+// Resources are matched by kind, namespace and name, so the order of the manifests and of map keys doesn't matter.
+// Items of lists whose items all have a unique `name`, e.g. containers, env and ports, are matched by name:
+// the path of the image of a container is `spec.template.spec.containers[name=web].image`.
+// Labels that change with every chart release, e.g. `chart: auto-deploy-app-2.119.0`, are ignored.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultIgnoredLabels are the labels containing the chart version.
+var DefaultIgnoredLabels = []string{"chart", "helm.sh/chart"}
+
+// Change is the kind of change of a resource.
+type Change string
+
+const (
+	Added   Change = "added"
+	Removed Change = "removed"
+	Changed Change = "changed"
+)
+
+// Resource is a resource that differs between the renderings.
+type Resource struct {
+	Kind      string  `json:"kind"`
+	Namespace string  `json:"namespace,omitempty"`
+	Name      string  `json:"name"`
+	Change    Change  `json:"change"`
+	Fields    []Field `json:"fields,omitempty"`
+}
+
+func (r Resource) String() string {
+	if r.Namespace == "" {
+		return r.Kind + "/" + r.Name
+	}
+	return r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// Field is a changed field of a resource, Old or New is nil if the field is added or removed.
+type Field struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// Result are the resources that differ, sorted by kind, namespace and name.
+type Result struct {
+	Resources []Resource `json:"resources"`
+}
+
+// Compare compares the manifests of two renderings, ignoring the labels in ignoredLabels.
+func Compare(old, new string, ignoredLabels []string) (*Result, error) {
+	oldRelease, err := integrity.Parse(old)
+	if err != nil {
+		return nil, fmt.Errorf("old rendering: %w", err)
+	}
+	newRelease, err := integrity.Parse(new)
+	if err != nil {
+		return nil, fmt.Errorf("new rendering: %w", err)
+	}
+
+	oldObjects := index(oldRelease, ignoredLabels)
+	newObjects := index(newRelease, ignoredLabels)
+
+	result := &Result{Resources: []Resource{}}
+	for key, oldObj := range oldObjects {
+		newObj, ok := newObjects[key]
+		if !ok {
+			result.Resources = append(result.Resources, resource(oldObj, Removed))
+			continue
+		}
+		if fields := compare("", oldObj.Object, newObj.Object); len(fields) > 0 {
+			r := resource(newObj, Changed)
+			r.Fields = fields
+			result.Resources = append(result.Resources, r)
+		}
+	}
+	for key, newObj := range newObjects {
+		if _, ok := oldObjects[key]; !ok {
+			result.Resources = append(result.Resources, resource(newObj, Added))
+		}
+	}
+
+	sort.Slice(result.Resources, func(i, j int) bool {
+		a, b := result.Resources[i], result.Resources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return result, nil
+}
+
+func resource(obj *unstructured.Unstructured, change Change) Resource {
+	return Resource{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName(), Change: change}
+}
+
+// index returns the objects by kind, namespace and name, without the ignored labels.
+func index(release *integrity.Release, ignoredLabels []string) map[string]*unstructured.Unstructured {
+	objects := map[string]*unstructured.Unstructured{}
+	for _, obj := range release.Objects() {
+		obj = obj.DeepCopy()
+		removeLabels(obj.Object, ignoredLabels)
+		objects[obj.GetKind()+"/"+obj.GetNamespace()+"/"+obj.GetName()] = obj
+	}
+	return objects
+}
+
+// removeLabels removes the labels from every `labels` map, e.g. of the metadata and of pod templates.
+func removeLabels(value interface{}, ignoredLabels []string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if labels, ok := child.(map[string]interface{}); ok && key == "labels" {
+				for _, label := range ignoredLabels {
+					delete(labels, label)
+				}
+			}
+			removeLabels(child, ignoredLabels)
+		}
+	case []interface{}:
+		for _, item := range v {
+			removeLabels(item, ignoredLabels)
+		}
+	}
+}
+
+// compare returns the changed leaves of the values.
+func compare(path string, old, new interface{}) []Field {
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		var fields []Field
+		for _, key := range sortedKeys(oldMap, newMap) {
+			fields = append(fields, compare(joinPath(path, key), oldMap[key], newMap[key])...)
+		}
+		return fields
+	}
+
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := new.([]interface{})
+	if oldIsList && newIsList {
+		oldNamed, oldOK := byName(oldList)
+		newNamed, newOK := byName(newList)
+		if oldOK && newOK {
+			var fields []Field
+			for _, name := range sortedKeys(oldNamed, newNamed) {
+				fields = append(fields, compare(fmt.Sprintf("%s[name=%s]", path, name), oldNamed[name], newNamed[name])...)
+			}
+			return fields
+		}
+		if len(oldList) == len(newList) {
+			var fields []Field
+			for i := range oldList {
+				fields = append(fields, compare(fmt.Sprintf("%s[%d]", path, i), oldList[i], newList[i])...)
+			}
+			return fields
+		}
+	}
+
+	return []Field{{Path: path, Old: old, New: new}}
+}
+
+// byName returns the items of a list by their name, ok is false unless every item is a map with a unique name.
+func byName(list []interface{}) (items map[string]interface{}, ok bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+	items = map[string]interface{}{}
+	for _, item := range list {
+		m, isMap := item.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		name, isString := m["name"].(string)
+		if !isString || items[name] != nil {
+			return nil, false
+		}
+		items[name] = m
+	}
+	return items, true
+}
+
+func sortedKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinPath joins the path and a key, keys like `app.gitlab.com/env` are quoted: `metadata.annotations["app.gitlab.com/env"]`.
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// WriteText writes the result for humans: `+` for added, `-` for removed and `~` for changed resources.
+func (r *Result) WriteText(w io.Writer) error {
+	counts := map[Change]int{}
+	for _, resource := range r.Resources {
+		counts[resource.Change]++
+		symbol := map[Change]string{Added: "+", Removed: "-", Changed: "~"}[resource.Change]
+		if _, err := fmt.Fprintf(w, "%s %s\n", symbol, resource); err != nil {
+			return err
+		}
+		for _, field := range resource.Fields {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", field.Path, format(field.Old), format(field.New))
+		}
+	}
+	if len(r.Resources) == 0 {
+		_, err := fmt.Fprintln(w, "no differences")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d added, %d removed, %d changed\n", counts[Added], counts[Removed], counts[Changed])
+	return err
+}
+
+// WriteJSON writes the result as indented JSON.
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func format(value interface{}) string {
+	if value == nil {
+		return "<unset>"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,269 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const deployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+  namespace: default
+  labels:
+    app: production
+    chart: auto-deploy-app-2.118.0
+  annotations:
+    app.gitlab.com/env: production
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        app: production
+        chart: auto-deploy-app-2.118.0
+    spec:
+      containers:
+      - name: auto-deploy-app
+        image: registry/app:1
+        env:
+        - name: A
+          value: "1"
+        - name: B
+          value: "2"
+      - name: sidecar
+        image: registry/sidecar:1
+`
+
+func TestCompare(t *testing.T) {
+	tcs := []struct {
+		name string
+		old  string
+		new  string
+
+		expectedText string
+	}{
+		{
+			name: "identical",
+			old:  deployment,
+			new:  deployment,
+
+			expectedText: "no differences\n",
+		},
+		{
+			name: "map ordering, list ordering of named items and chart labels",
+			old:  deployment,
+			new: `---
+kind: Deployment
+apiVersion: apps/v1
+spec:
+  template:
+    spec:
+      containers:
+      - image: registry/sidecar:1
+        name: sidecar
+      - env:
+        - name: B
+          value: "2"
+        - name: A
+          value: "1"
+        name: auto-deploy-app
+        image: registry/app:1
+    metadata:
+      labels:
+        chart: auto-deploy-app-2.119.0
+        app: production
+  replicas: 1
+metadata:
+  annotations:
+    app.gitlab.com/env: production
+  labels:
+    chart: auto-deploy-app-2.119.0
+    app: production
+  namespace: default
+  name: production
+`,
+
+			expectedText: "no differences\n",
+		},
+		{
+			name: "changed fields",
+			old:  deployment,
+			new: `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+  namespace: default
+  labels:
+    app: production
+    chart: auto-deploy-app-2.119.0
+  annotations:
+    app.gitlab.com/env: staging
+spec:
+  replicas: 2
+  template:
+    metadata:
+      labels:
+        app: production
+    spec:
+      containers:
+      - name: auto-deploy-app
+        image: registry/app:2
+        env:
+        - name: A
+          value: "1"
+        - name: C
+          value: "3"
+`,
+
+			expectedText: `~ Deployment/default/production
+    metadata.annotations["app.gitlab.com/env"]: "production" -> "staging"
+    spec.replicas: 1 -> 2
+    spec.template.spec.containers[name=auto-deploy-app].env[name=B]: {"name":"B","value":"2"} -> <unset>
+    spec.template.spec.containers[name=auto-deploy-app].env[name=C]: <unset> -> {"name":"C","value":"3"}
+    spec.template.spec.containers[name=auto-deploy-app].image: "registry/app:1" -> "registry/app:2"
+    spec.template.spec.containers[name=sidecar]: {"image":"registry/sidecar:1","name":"sidecar"} -> <unset>
+0 added, 0 removed, 1 changed
+`,
+		},
+		{
+			name: "lists without names",
+			old: `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production
+spec:
+  clusterIPs: [10.0.0.1, 10.0.0.2]
+  ipFamilies: [IPv4]
+`,
+			new: `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production
+spec:
+  clusterIPs: [10.0.0.1, 10.0.0.3]
+  ipFamilies: [IPv4, IPv6]
+`,
+
+			expectedText: `~ Service/production
+    spec.clusterIPs[1]: "10.0.0.2" -> "10.0.0.3"
+    spec.ipFamilies: ["IPv4"] -> ["IPv4","IPv6"]
+0 added, 0 removed, 1 changed
+`,
+		},
+		{
+			name: "added and removed resources",
+			old: deployment + `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production
+  namespace: default
+`,
+			new: deployment + `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production
+  namespace: review
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: production
+`,
+
+			expectedText: `+ Ingress/production
+- Service/default/production
++ Service/review/production
+2 added, 1 removed, 0 changed
+`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Compare(tc.old, tc.new, DefaultIgnoredLabels)
+			require.NoError(t, err)
+
+			var text bytes.Buffer
+			require.NoError(t, result.WriteText(&text))
+			require.Equal(t, tc.expectedText, text.String())
+		})
+	}
+}
+
+func TestCompare_IgnoredLabels(t *testing.T) {
+	upgraded := strings.ReplaceAll(deployment, "auto-deploy-app-2.118.0", "auto-deploy-app-2.119.0")
+
+	result, err := Compare(deployment, upgraded, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Resources, 1)
+	var paths []string
+	for _, field := range result.Resources[0].Fields {
+		paths = append(paths, field.Path)
+	}
+	require.Equal(t, []string{"metadata.labels.chart", "spec.template.metadata.labels.chart"}, paths)
+
+	result, err = Compare(deployment, upgraded, []string{"chart"})
+	require.NoError(t, err)
+	require.Empty(t, result.Resources)
+}
+
+func TestResult_WriteJSON(t *testing.T) {
+	result, err := Compare(deployment, `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+  namespace: default
+  labels:
+    app: production
+  annotations:
+    app.gitlab.com/env: production
+spec:
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        app: production
+    spec:
+      containers:
+      - name: auto-deploy-app
+        image: registry/app:1
+        env:
+        - name: A
+          value: "1"
+        - name: B
+          value: "2"
+      - name: sidecar
+        image: registry/sidecar:1
+`, DefaultIgnoredLabels)
+	require.NoError(t, err)
+
+	var output bytes.Buffer
+	require.NoError(t, result.WriteJSON(&output))
+	require.JSONEq(t, `{
+  "resources": [
+    {
+      "kind": "Deployment",
+      "namespace": "default",
+      "name": "production",
+      "change": "changed",
+      "fields": [{"path": "spec.replicas", "old": 1, "new": 3}]
+    }
+  ]
+}`, output.String())
+}
+
+func TestCompare_InvalidManifest(t *testing.T) {
+	_, err := Compare("kind: [Deployment", deployment, nil)
+	require.Error(t, err)
+}
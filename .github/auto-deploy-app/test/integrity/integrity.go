@@ -0,0 +1,298 @@
+// Package integrity checks that the resources of a complete chart rendering reference each other correctly,
+// e.g. that the HorizontalPodAutoscaler scales a rendered Deployment and the Ingress routes to a port
+// of the rendered Service. helm and the schema validation only look at one resource at a time.
+//
+// Selections and CheckSelectors evaluate the label selectors of a rendering against the pod templates
+// of its workloads.
+package integrity
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Problem is a broken reference of a rendered resource.
+type Problem struct {
+	Resource string
+	Path     string
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Resource, p.Path, p.Message)
+}
+
+// workloadTemplates are the paths of the pod templates of the workload kinds.
+var workloadTemplates = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// Release is a parsed rendering, indexed by kind and name.
+type Release struct {
+	objects []*unstructured.Unstructured
+	byKind  map[string]map[string]*unstructured.Unstructured
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// Parse parses a multi-document YAML stream, e.g. the output of `helm template`.
+// Items of `v1 List` resources are expanded.
+func Parse(manifests string) (*Release, error) {
+	r := &Release{byKind: map[string]map[string]*unstructured.Unstructured{}}
+	for i, doc := range documentSeparator.Split(manifests, -1) {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse document %d: %w", i, err)
+		}
+		if obj == nil {
+			continue
+		}
+		if obj["apiVersion"] == "v1" && obj["kind"] == "List" {
+			items, _ := obj["items"].([]interface{})
+			for _, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					r.add(m)
+				}
+			}
+			continue
+		}
+		r.add(obj)
+	}
+	return r, nil
+}
+
+func (r *Release) add(obj map[string]interface{}) {
+	u := &unstructured.Unstructured{Object: obj}
+	if r.byKind[u.GetKind()] == nil {
+		r.byKind[u.GetKind()] = map[string]*unstructured.Unstructured{}
+	}
+	r.byKind[u.GetKind()][u.GetName()] = u
+	r.objects = append(r.objects, u)
+}
+
+// Objects returns the rendered resources in the order of the manifests.
+func (r *Release) Objects() []*unstructured.Unstructured {
+	return r.objects
+}
+
+// Get returns the rendered resource of the kind with the name or nil.
+func (r *Release) Get(kind, name string) *unstructured.Unstructured {
+	return r.byKind[kind][name]
+}
+
+// names lists the names of the rendered resources of a kind for the problem messages.
+func (r *Release) names(kind string) string {
+	var names []string
+	for name := range r.byKind[kind] {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "no " + kind + " is rendered"
+	}
+	sort.Strings(names)
+	return "rendered: " + strings.Join(names, ", ")
+}
+
+// Check parses the manifests and checks all references, see Release.Check.
+func Check(manifests string) ([]Problem, error) {
+	r, err := Parse(manifests)
+	if err != nil {
+		return nil, err
+	}
+	return r.Check(), nil
+}
+
+// Check verifies that
+//   - the scaleTargetRef of a HorizontalPodAutoscaler is rendered,
+//   - the selector of a PodDisruptionBudget selects the pods of a rendered workload,
+//   - every Ingress backend is a port of a rendered Service,
+//   - the Role of a RoleBinding is rendered (ClusterRoles are not part of a release),
+//   - every persistentVolumeClaim volume of a pod template claims a rendered PersistentVolumeClaim.
+func (r *Release) Check() []Problem {
+	var problems []Problem
+	for _, obj := range r.objects {
+		resource := obj.GetKind() + "/" + obj.GetName()
+		report := func(path, format string, args ...interface{}) {
+			problems = append(problems, Problem{Resource: resource, Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+
+		switch obj.GetKind() {
+		case "HorizontalPodAutoscaler":
+			r.checkScaleTarget(obj, report)
+		case "PodDisruptionBudget":
+			r.checkDisruptionBudget(obj, report)
+		case "Ingress":
+			r.checkIngress(obj, report)
+		case "RoleBinding":
+			r.checkRoleBinding(obj, report)
+		}
+		if path, ok := workloadTemplates[obj.GetKind()]; ok {
+			r.checkClaims(obj, path, report)
+		}
+	}
+	return problems
+}
+
+type reportFunc func(path, format string, args ...interface{})
+
+func (r *Release) checkScaleTarget(hpa *unstructured.Unstructured, report reportFunc) {
+	ref, _, _ := unstructured.NestedStringMap(hpa.Object, "spec", "scaleTargetRef")
+	target := r.byKind[ref["kind"]][ref["name"]]
+	if target == nil {
+		report("spec.scaleTargetRef", "%s %q is not rendered (%s)", ref["kind"], ref["name"], r.names(ref["kind"]))
+		return
+	}
+	if ref["apiVersion"] != "" && ref["apiVersion"] != target.GetAPIVersion() {
+		report("spec.scaleTargetRef.apiVersion", "%s %q is rendered as %s, not %s", ref["kind"], ref["name"], target.GetAPIVersion(), ref["apiVersion"])
+	}
+}
+
+func (r *Release) checkDisruptionBudget(pdb *unstructured.Unstructured, report reportFunc) {
+	matchLabels, _, _ := unstructured.NestedStringMap(pdb.Object, "spec", "selector", "matchLabels")
+	if len(matchLabels) == 0 {
+		report("spec.selector.matchLabels", "is empty and selects all pods of the namespace")
+		return
+	}
+	selector := labels.SelectorFromSet(matchLabels)
+
+	var mismatches []string
+	for _, obj := range r.objects {
+		path, ok := workloadTemplates[obj.GetKind()]
+		if !ok {
+			continue
+		}
+		podLabels, _, _ := unstructured.NestedStringMap(obj.Object, append(path, "metadata", "labels")...)
+		if selector.Matches(labels.Set(podLabels)) {
+			return
+		}
+		mismatches = append(mismatches, fmt.Sprintf("%s/%s: %s", obj.GetKind(), obj.GetName(), labelDiff(matchLabels, podLabels)))
+	}
+	if len(mismatches) == 0 {
+		report("spec.selector", "selects %s, but no workload is rendered", selector)
+		return
+	}
+	report("spec.selector", "%s does not select the pods of any rendered workload (%s)", selector, strings.Join(mismatches, "; "))
+}
+
+// labelDiff explains why the labels don't match the expected ones.
+func labelDiff(expected, actual map[string]string) string {
+	var keys []string
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var diffs []string
+	for _, key := range keys {
+		value, ok := actual[key]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s is missing", key))
+		} else if value != expected[key] {
+			diffs = append(diffs, fmt.Sprintf("%s is %q", key, value))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+func (r *Release) checkIngress(ingress *unstructured.Unstructured, report reportFunc) {
+	for _, field := range []string{"defaultBackend", "backend"} {
+		if backend, ok, _ := unstructured.NestedMap(ingress.Object, "spec", field); ok {
+			r.checkBackend(backend, "spec."+field, report)
+		}
+	}
+
+	rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+	for i, rule := range rules {
+		rule, _ := rule.(map[string]interface{})
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for j, path := range paths {
+			path, _ := path.(map[string]interface{})
+			backend, ok, _ := unstructured.NestedMap(path, "backend")
+			fieldPath := fmt.Sprintf("spec.rules[%d].http.paths[%d].backend", i, j)
+			if !ok {
+				report(fieldPath, "is missing")
+				continue
+			}
+			r.checkBackend(backend, fieldPath, report)
+		}
+	}
+}
+
+// checkBackend checks a networking.k8s.io/v1 or a v1beta1/extensions backend.
+func (r *Release) checkBackend(backend map[string]interface{}, path string, report reportFunc) {
+	var serviceName string
+	var port interface{}
+	if service, ok, _ := unstructured.NestedMap(backend, "service"); ok {
+		serviceName, _, _ = unstructured.NestedString(service, "name")
+		if number, ok, _ := unstructured.NestedFieldNoCopy(service, "port", "number"); ok {
+			port = number
+		} else {
+			port, _, _ = unstructured.NestedFieldNoCopy(service, "port", "name")
+		}
+	} else if _, ok := backend["serviceName"]; ok {
+		serviceName, _, _ = unstructured.NestedString(backend, "serviceName")
+		port = backend["servicePort"]
+	} else {
+		// e.g. a resource backend
+		return
+	}
+
+	service := r.byKind["Service"][serviceName]
+	if service == nil {
+		report(path, "Service %q is not rendered (%s)", serviceName, r.names("Service"))
+		return
+	}
+
+	ports, _, _ := unstructured.NestedSlice(service.Object, "spec", "ports")
+	var available []string
+	for _, servicePort := range ports {
+		servicePort, _ := servicePort.(map[string]interface{})
+		number := fmt.Sprint(servicePort["port"])
+		name, _ := servicePort["name"].(string)
+		if fmt.Sprint(port) == number || (name != "" && port == name) {
+			return
+		}
+		if name != "" {
+			number += "/" + name
+		}
+		available = append(available, number)
+	}
+	report(path, "Service %q has no port %v (ports: %s)", serviceName, port, strings.Join(available, ", "))
+}
+
+func (r *Release) checkRoleBinding(binding *unstructured.Unstructured, report reportFunc) {
+	kind, _, _ := unstructured.NestedString(binding.Object, "roleRef", "kind")
+	name, _, _ := unstructured.NestedString(binding.Object, "roleRef", "name")
+	if kind != "Role" {
+		return
+	}
+	if r.byKind["Role"][name] == nil {
+		report("roleRef", "Role %q is not rendered (%s)", name, r.names("Role"))
+	}
+}
+
+func (r *Release) checkClaims(workload *unstructured.Unstructured, templatePath []string, report reportFunc) {
+	volumes, _, _ := unstructured.NestedSlice(workload.Object, append(templatePath, "spec", "volumes")...)
+	for i, volume := range volumes {
+		volume, _ := volume.(map[string]interface{})
+		claimName, ok, _ := unstructured.NestedString(volume, "persistentVolumeClaim", "claimName")
+		if !ok {
+			continue
+		}
+		if r.byKind["PersistentVolumeClaim"][claimName] == nil {
+			path := fmt.Sprintf("%s.spec.volumes[%d].persistentVolumeClaim.claimName", strings.Join(templatePath, "."), i)
+			report(path, "PersistentVolumeClaim %q is not rendered (%s)", claimName, r.names("PersistentVolumeClaim"))
+		}
+	}
+}
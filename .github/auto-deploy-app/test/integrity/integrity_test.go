@@ -0,0 +1,195 @@
+package integrity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const deployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production-canary
+spec:
+  template:
+    metadata:
+      labels:
+        app: production
+        release: production
+        tier: web
+        track: canary
+    spec:
+      volumes:
+      - name: data
+        persistentVolumeClaim:
+          claimName: production-auto-deploy-data
+`
+
+const service = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: production-auto-deploy
+spec:
+  ports:
+  - port: 5000
+    targetPort: 5000
+    name: web
+`
+
+func TestCheck(t *testing.T) {
+	tcs := []struct {
+		name      string
+		manifests string
+
+		expectedProblems []string
+	}{
+		{
+			name: "consistent release",
+			manifests: deployment + "---" + service + `---
+kind: PersistentVolumeClaim
+apiVersion: v1
+metadata:
+  name: production-auto-deploy-data
+---
+apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: production-auto-deploy
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: production-canary
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: production-auto-deploy
+spec:
+  selector:
+    matchLabels:
+      app: production
+      track: canary
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: production-auto-deploy
+spec:
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: production-auto-deploy
+            port:
+              number: 5000
+---
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: legacy
+spec:
+  backend:
+    serviceName: production-auto-deploy
+    servicePort: web
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: Role
+  metadata:
+    name: reader
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: reader
+  roleRef:
+    kind: Role
+    name: reader
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: admin
+  roleRef:
+    kind: ClusterRole
+    name: admin
+`,
+		},
+		{
+			name: "broken references",
+			manifests: deployment + "---" + service + `---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: production-auto-deploy
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: production
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: production-auto-deploy
+spec:
+  selector:
+    matchLabels:
+      app: production
+      track: stable
+      extra: label
+---
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: production-auto-deploy
+spec:
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - backend:
+          serviceName: production-auto-deploy
+          servicePort: 80
+      - backend:
+          serviceName: production
+          servicePort: 5000
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: reader
+roleRef:
+  kind: Role
+  name: reader
+`,
+			expectedProblems: []string{
+				`HorizontalPodAutoscaler/production-auto-deploy: spec.scaleTargetRef: Deployment "production" is not rendered (rendered: production-canary)`,
+				`PodDisruptionBudget/production-auto-deploy: spec.selector: app=production,extra=label,track=stable does not select the pods of any rendered workload (Deployment/production-canary: extra is missing, track is "canary")`,
+				`Ingress/production-auto-deploy: spec.rules[0].http.paths[0].backend: Service "production-auto-deploy" has no port 80 (ports: 5000/web)`,
+				`Ingress/production-auto-deploy: spec.rules[0].http.paths[1].backend: Service "production" is not rendered (rendered: production-auto-deploy)`,
+				`RoleBinding/reader: roleRef: Role "reader" is not rendered (no Role is rendered)`,
+				`Deployment/production-canary: spec.template.spec.volumes[0].persistentVolumeClaim.claimName: PersistentVolumeClaim "production-auto-deploy-data" is not rendered (no PersistentVolumeClaim is rendered)`,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			problems, err := Check(tc.manifests)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.ElementsMatch(t, tc.expectedProblems, messages)
+		})
+	}
+}
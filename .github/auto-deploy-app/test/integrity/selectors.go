@@ -0,0 +1,142 @@
+package integrity
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Selection is the set of pods a label selector of a rendered resource matches,
+// identified by the workloads whose pod templates carry the labels.
+type Selection struct {
+	Resource  string
+	Selector  labels.Selector
+	Workloads []string
+}
+
+func (s Selection) String() string {
+	selector := s.Selector.String()
+	if s.Selector.Empty() {
+		selector = "{}"
+	}
+	if len(s.Workloads) == 0 {
+		return fmt.Sprintf("%s: %s selects no pods", s.Resource, selector)
+	}
+	return fmt.Sprintf("%s: %s selects the pods of %s", s.Resource, selector, strings.Join(s.Workloads, ", "))
+}
+
+// Selections evaluates the pod selectors of all Services, PodDisruptionBudgets and NetworkPolicies.
+// Services without a selector are skipped, their endpoints are managed manually.
+func (r *Release) Selections() ([]Selection, error) {
+	var selections []Selection
+	for _, obj := range r.objects {
+		var selector labels.Selector
+		switch obj.GetKind() {
+		case "Service":
+			selectorLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "selector")
+			if len(selectorLabels) == 0 {
+				continue
+			}
+			selector = labels.SelectorFromSet(selectorLabels)
+		case "PodDisruptionBudget":
+			var err error
+			if selector, err = labelSelector(obj, "spec", "selector"); err != nil {
+				return nil, err
+			}
+		case "NetworkPolicy":
+			var err error
+			if selector, err = labelSelector(obj, "spec", "podSelector"); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+
+		selection := Selection{Resource: obj.GetKind() + "/" + obj.GetName(), Selector: selector}
+		for _, workload := range r.objects {
+			if podLabels, ok := r.podLabels(workload); ok && selector.Matches(labels.Set(podLabels)) {
+				selection.Workloads = append(selection.Workloads, workload.GetKind()+"/"+workload.GetName())
+			}
+		}
+		selections = append(selections, selection)
+	}
+	return selections, nil
+}
+
+func labelSelector(obj *unstructured.Unstructured, fields ...string) (labels.Selector, error) {
+	var selector metav1.LabelSelector
+	if field, ok, _ := unstructured.NestedMap(obj.Object, fields...); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(field, &selector); err != nil {
+			return nil, fmt.Errorf("%s/%s: %s: %w", obj.GetKind(), obj.GetName(), strings.Join(fields, "."), err)
+		}
+	}
+	return metav1.LabelSelectorAsSelector(&selector)
+}
+
+// podLabels returns the labels of the pod template of a workload.
+func (r *Release) podLabels(obj *unstructured.Unstructured) (map[string]string, bool) {
+	path, ok := workloadTemplates[obj.GetKind()]
+	if !ok {
+		return nil, false
+	}
+	podLabels, _, _ := unstructured.NestedStringMap(obj.Object, append(path, "metadata", "labels")...)
+	return podLabels, true
+}
+
+// CheckSelectors verifies that every Service with a selector selects the pods of exactly one long-running workload,
+// i.e. it neither matches nothing nor sends traffic to the pods of workers, Jobs or CronJobs.
+func (r *Release) CheckSelectors() ([]Problem, error) {
+	selections, err := r.Selections()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	for _, selection := range selections {
+		if !strings.HasPrefix(selection.Resource, "Service/") {
+			continue
+		}
+		report := func(format string, args ...interface{}) {
+			problems = append(problems, Problem{Resource: selection.Resource, Path: "spec.selector", Message: fmt.Sprintf(format, args...)})
+		}
+
+		switch len(selection.Workloads) {
+		case 0:
+			var mismatches []string
+			for _, obj := range r.objects {
+				if podLabels, ok := r.podLabels(obj); ok {
+					mismatches = append(mismatches, fmt.Sprintf("%s/%s: %s", obj.GetKind(), obj.GetName(), labelDiff(selectorLabels(selection.Selector), podLabels)))
+				}
+			}
+			if len(mismatches) == 0 {
+				report("%s selects no pods, no workload is rendered", selection.Selector)
+			} else {
+				report("%s selects no pods (%s)", selection.Selector, strings.Join(mismatches, "; "))
+			}
+		case 1:
+			kind := strings.SplitN(selection.Workloads[0], "/", 2)[0]
+			if kind == "Job" || kind == "CronJob" {
+				report("%s selects the pods of %s, which are not long-running", selection.Selector, selection.Workloads[0])
+			}
+		default:
+			report("%s selects the pods of more than one workload: %s", selection.Selector, strings.Join(selection.Workloads, ", "))
+		}
+	}
+	return problems, nil
+}
+
+// selectorLabels returns the required label values of an equality based selector.
+func selectorLabels(selector labels.Selector) map[string]string {
+	requiredLabels := map[string]string{}
+	requirements, _ := selector.Requirements()
+	for _, requirement := range requirements {
+		if values := requirement.Values().List(); len(values) == 1 {
+			requiredLabels[requirement.Key()] = values[0]
+		}
+	}
+	return requiredLabels
+}
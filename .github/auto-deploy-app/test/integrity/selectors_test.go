@@ -0,0 +1,159 @@
+package integrity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const workloads = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+spec:
+  template:
+    metadata:
+      labels:
+        app: production
+        tier: web
+        track: stable
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production-worker
+spec:
+  template:
+    metadata:
+      labels:
+        release: production
+        tier: worker
+        track: stable
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: production-job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            app: production
+            tier: cronjob
+            track: stable
+`
+
+func TestSelections(t *testing.T) {
+	r, err := Parse(workloads + `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production-auto-deploy
+spec:
+  selector:
+    app: production
+    tier: web
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: production-auto-deploy
+spec:
+  podSelector:
+    matchExpressions:
+    - key: tier
+      operator: In
+      values: [web, worker]
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: all
+spec:
+  podSelector:
+    matchLabels: {}
+`)
+	require.NoError(t, err)
+
+	selections, err := r.Selections()
+	require.NoError(t, err)
+
+	var messages []string
+	for _, selection := range selections {
+		messages = append(messages, selection.String())
+	}
+	require.Equal(t, []string{
+		"Service/production-auto-deploy: app=production,tier=web selects the pods of Deployment/production",
+		"NetworkPolicy/production-auto-deploy: tier in (web,worker) selects the pods of Deployment/production, Deployment/production-worker",
+		"NetworkPolicy/all: {} selects the pods of Deployment/production, Deployment/production-worker, CronJob/production-job",
+	}, messages)
+}
+
+func TestCheckSelectors(t *testing.T) {
+	tcs := []struct {
+		name     string
+		selector string
+
+		expectedProblems []string
+	}{
+		{
+			name: "web pods",
+			selector: `
+    app: production
+    tier: web
+    track: stable`,
+		},
+		{
+			name: "no pods",
+			selector: `
+    app: production
+    tier: web
+    track: canary`,
+			expectedProblems: []string{
+				`Service/production-auto-deploy: spec.selector: app=production,tier=web,track=canary selects no pods (Deployment/production: track is "stable"; Deployment/production-worker: app is missing, tier is "worker", track is "stable"; CronJob/production-job: tier is "cronjob", track is "stable")`,
+			},
+		},
+		{
+			name: "web and worker pods",
+			selector: `
+    track: stable`,
+			expectedProblems: []string{
+				`Service/production-auto-deploy: spec.selector: track=stable selects the pods of more than one workload: Deployment/production, Deployment/production-worker, CronJob/production-job`,
+			},
+		},
+		{
+			name: "cronjob pods",
+			selector: `
+    app: production
+    tier: cronjob`,
+			expectedProblems: []string{
+				`Service/production-auto-deploy: spec.selector: app=production,tier=cronjob selects the pods of CronJob/production-job, which are not long-running`,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Parse(workloads + `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: production-auto-deploy
+spec:
+  selector:` + tc.selector + "\n")
+			require.NoError(t, err)
+
+			problems, err := r.CheckSelectors()
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.Equal(t, tc.expectedProblems, messages)
+		})
+	}
+}
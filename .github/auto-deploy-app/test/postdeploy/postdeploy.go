@@ -0,0 +1,390 @@
+// Package postdeploy checks a deployed release after `helm upgrade --wait`, which only waits for the pods:
+//
+//   - every Deployment of the rendering, the app and its workers, is rolled out and available, like
+//     `kubectl rollout status`,
+//   - every URL of the app, the `appurls` of NOTES.txt built from service.url, service.additionalHosts and
+//     ingress.path, serves the app: the HTTP checks expect a status and a body, and https URLs a valid certificate.
+//
+// The checks are retried until they pass or the timeout expires, e.g. while the ingress controller picks up a new
+// host. The results are written as a JUnit report.
+package postdeploy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultTimeout is the time a check is retried by default.
+	DefaultTimeout = 5 * time.Minute
+	// DefaultInterval is the time between the attempts of a check by default.
+	DefaultInterval = 5 * time.Second
+)
+
+// Check is an HTTP check of every URL of the app.
+type Check struct {
+	// Name is the name of the check in the report, GET if it is empty.
+	Name string `json:"name,omitempty"`
+	// Path is appended to the URLs, e.g. /health.
+	Path string `json:"path,omitempty"`
+	// Status is the expected status, any status below 400 if it is 0.
+	Status int `json:"status,omitempty"`
+	// Body is a regular expression the body has to match.
+	Body string `json:"body,omitempty"`
+	// InsecureSkipTLSVerify accepts any certificate.
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+}
+
+// DefaultChecks are the checks if none are configured: the URLs of the app respond.
+var DefaultChecks = []Check{{}}
+
+// Result is the result of a check.
+type Result struct {
+	// Suite is "rollout" or "http".
+	Suite    string
+	Name     string
+	Duration time.Duration
+	// Failure is empty if the check passed.
+	Failure string
+}
+
+// Report are the results of the checks of a release.
+type Report struct {
+	Release string
+	Results []Result
+}
+
+// Failed returns true if a check failed.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Failure != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Checker checks deployed releases.
+type Checker struct {
+	Clientset kubernetes.Interface
+	// Client makes the HTTP requests, http.DefaultClient if it is nil.
+	Client *http.Client
+	// Timeout and Interval are the time each check is retried and between the attempts, DefaultTimeout and
+	// DefaultInterval if they are 0.
+	Timeout  time.Duration
+	Interval time.Duration
+	// MinTLSValidity is the time the certificates of https URLs must be valid for at least.
+	MinTLSValidity time.Duration
+}
+
+// Check checks the Deployments and the URLs of the release. The checks of the URLs are skipped if a Deployment
+// isn't available.
+func (c *Checker) Check(ctx context.Context, rel *release.Release, checks []Check) (*Report, error) {
+	r, err := integrity.Parse(rel.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	values, err := chartutil.CoalesceValues(rel.Chart, rel.Config)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := URLs(values)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Release: rel.Name}
+	for _, obj := range r.Objects() {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		name := obj.GetName()
+		report.Results = append(report.Results, c.retry(ctx, "rollout", "Deployment/"+name, func(ctx context.Context) (string, bool) {
+			return c.rolloutStatus(ctx, rel.Namespace, name)
+		}))
+	}
+	if report.Failed() {
+		return report, nil
+	}
+
+	for _, check := range checks {
+		if check.Body != "" {
+			if _, err := regexp.Compile(check.Body); err != nil {
+				return nil, fmt.Errorf("check %s: %w", check.name(), err)
+			}
+		}
+		for _, u := range urls {
+			if path := check.path(); path != "" {
+				u = strings.TrimSuffix(u, "/") + path
+			}
+			u := u
+			report.Results = append(report.Results, c.retry(ctx, "http", check.name()+" "+u, func(ctx context.Context) (string, bool) {
+				return c.checkURL(ctx, u, check)
+			}))
+		}
+	}
+	return report, nil
+}
+
+// name returns the name of the check, GET if it has none.
+func (check Check) name() string {
+	if check.Name != "" {
+		return check.Name
+	}
+	return http.MethodGet
+}
+
+func (check Check) path() string {
+	if check.Path == "" || strings.HasPrefix(check.Path, "/") {
+		return check.Path
+	}
+	return "/" + check.Path
+}
+
+// URLs returns the URLs of the app like the `appurls` template of the chart.
+func URLs(values chartutil.Values) ([]string, error) {
+	url, _ := values.PathValue("service.url")
+	if url == nil || url == "" {
+		return nil, fmt.Errorf("service.url is not set")
+	}
+	path, _ := values.PathValue("ingress.path")
+	if path == nil {
+		path = ""
+	}
+	scheme := "http://"
+	if tls, _ := values.PathValue("ingress.tls.enabled"); tls == true {
+		scheme = "https://"
+	}
+
+	// like printf "%s%s" in the template
+	urls := []string{fmt.Sprintf("%s%s", url, path)}
+	hosts, _ := values.PathValue("service.additionalHosts")
+	if hosts, ok := hosts.([]interface{}); ok {
+		for _, host := range hosts {
+			urls = append(urls, fmt.Sprintf("%s%s%s", scheme, host, path))
+		}
+	}
+	return urls, nil
+}
+
+// retry retries the check until it passes or the timeout expires. The check returns the failure and whether to stop
+// retrying.
+func (c *Checker) retry(ctx context.Context, suite, name string, check func(context.Context) (string, bool)) Result {
+	timeout, interval := c.Timeout, c.Interval
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := Result{Suite: suite, Name: name}
+	for {
+		failure, done := check(ctx)
+		if ctx.Err() != nil && result.Failure != "" {
+			// the attempt was cut off, the previous one tells more
+			failure = result.Failure
+		}
+		result.Failure = failure
+		if failure == "" || done {
+			break
+		}
+		if !sleep(ctx, interval) {
+			result.Failure = fmt.Sprintf("%s, gave up after %s", failure, timeout)
+			break
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// sleep waits for the interval and returns false if the context is done first.
+func sleep(ctx context.Context, interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// rolloutStatus returns why the Deployment isn't available, and whether its rollout failed.
+func (c *Checker) rolloutStatus(ctx context.Context, namespace, name string) (string, bool) {
+	d, err := c.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err.Error(), false
+	}
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return fmt.Sprintf("the rollout exceeded its progress deadline: %s", condition.Message), true
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Generation > d.Status.ObservedGeneration:
+		return "the rollout hasn't been observed", false
+	case d.Status.UpdatedReplicas < replicas:
+		return fmt.Sprintf("%d of %d replicas are updated", d.Status.UpdatedReplicas, replicas), false
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas), false
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return fmt.Sprintf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas), false
+	}
+	return "", true
+}
+
+// maxBody is the size of the body that is matched.
+const maxBody = 1 << 20
+
+// checkURL returns why the URL doesn't pass the check, and whether retrying can't help.
+func (c *Checker) checkURL(ctx context.Context, url string, check Check) (string, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Sprintf("invalid URL: %s", err), true
+	}
+	resp, err := c.client(check).Do(req)
+	if err != nil {
+		return err.Error(), false
+	}
+	defer resp.Body.Close()
+
+	if check.Status == 0 && resp.StatusCode >= 400 || check.Status != 0 && resp.StatusCode != check.Status {
+		expected := "a status below 400"
+		if check.Status != 0 {
+			expected = fmt.Sprintf("the status %d", check.Status)
+		}
+		return fmt.Sprintf("expected %s, got %s", expected, resp.Status), false
+	}
+	if check.Body != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil {
+			return fmt.Sprintf("reading the body: %s", err), false
+		}
+		if !regexp.MustCompile(check.Body).Match(body) {
+			return fmt.Sprintf("the body doesn't match %q", check.Body), false
+		}
+	}
+	if resp.TLS != nil && c.MinTLSValidity > 0 && !check.InsecureSkipTLSVerify {
+		leaf := resp.TLS.PeerCertificates[0]
+		if time.Until(leaf.NotAfter) < c.MinTLSValidity {
+			// a renewal can take a while
+			return fmt.Sprintf("the certificate expires at %s, in less than %s", leaf.NotAfter.UTC().Format(time.RFC3339), c.MinTLSValidity), false
+		}
+	}
+	return "", true
+}
+
+// client returns the client for the check.
+func (c *Checker) client(check Check) *http.Client {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if !check.InsecureSkipTLSVerify {
+		return client
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return client
+	}
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	insecure := *client
+	insecure.Transport = transport
+	return &insecure
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML with a test suite per kind of check, <release>/rollout and
+// <release>/http.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	var suites junitTestSuites
+	index := map[string]int{}
+	durations := map[string]time.Duration{}
+	for _, result := range r.Results {
+		name := r.Release + "/" + result.Suite
+		i, ok := index[name]
+		if !ok {
+			i = len(suites.Suites)
+			index[name] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: name})
+		}
+		suite := &suites.Suites[i]
+		testCase := junitTestCase{Name: result.Name, ClassName: name, Time: seconds(result.Duration)}
+		if result.Failure != "" {
+			testCase.Failure = &junitFailure{Message: result.Failure, Text: result.Failure}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+		durations[name] += result.Duration
+		suite.Time = seconds(durations[name])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
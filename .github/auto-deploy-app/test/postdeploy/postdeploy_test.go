@@ -0,0 +1,301 @@
+package postdeploy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/render"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/strvals"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// deployment returns a Deployment of the release with the status.
+func deployment(name string, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "review", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     status,
+	}
+}
+
+var available = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+
+// newRelease renders the chart with the values like `helm upgrade`.
+func newRelease(t *testing.T, values map[string]string) *release.Release {
+	c, err := loader.Load("../..")
+	require.NoError(t, err)
+	r, err := render.Load("../..")
+	require.NoError(t, err)
+	manifest, err := r.Render("production", render.Options{Namespace: "review", SetValues: values})
+	require.NoError(t, err)
+
+	config := map[string]interface{}{}
+	for key, value := range values {
+		require.NoError(t, strvals.ParseInto(key+"="+value, config))
+	}
+	return &release.Release{Name: "production", Namespace: "review", Manifest: manifest, Chart: c, Config: config}
+}
+
+// newServer returns an https server of the app, and a client that connects every host to it.
+func newServer(t *testing.T) *http.Client {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte("welcome"))
+		case "/health":
+			w.Write([]byte("ok"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	// the handshakes with the hosts the certificate isn't valid for fail
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	client.Transport = transport
+	return client
+}
+
+func TestChecker_Check(t *testing.T) {
+	// the certificate of the test server is valid for example.com
+	values := map[string]string{"service.url": "https://example.com", "ingress.tls.enabled": "true"}
+
+	tcs := []struct {
+		name           string
+		values         map[string]string
+		deployments    []runtime.Object
+		checks         []Check
+		minTLSValidity time.Duration
+
+		expectedResults []Result
+	}{
+		{
+			name:        "available app",
+			values:      values,
+			deployments: []runtime.Object{deployment("production", available)},
+			checks:      []Check{{}, {Name: "health", Path: "health", Status: 200, Body: "^ok$"}},
+			expectedResults: []Result{
+				{Suite: "rollout", Name: "Deployment/production"},
+				{Suite: "http", Name: "GET https://example.com/"},
+				{Suite: "http", Name: "health https://example.com/health"},
+			},
+		},
+		{
+			name: "workers and additional hosts",
+			values: map[string]string{
+				"service.url":                  "https://example.com",
+				"ingress.tls.enabled":          "true",
+				"service.additionalHosts[0]":   "my-app.example.org",
+				"workers.worker.command[0]":    "worker",
+				"workers.sidekiq.command[0]":   "sidekiq",
+				"workers.sidekiq.replicaCount": "0",
+			},
+			deployments: []runtime.Object{
+				deployment("production", available),
+				deployment("production-worker", available),
+				deployment("production-sidekiq", available),
+			},
+			checks: DefaultChecks,
+			expectedResults: []Result{
+				{Suite: "rollout", Name: "Deployment/production"},
+				{Suite: "rollout", Name: "Deployment/production-sidekiq"},
+				{Suite: "rollout", Name: "Deployment/production-worker"},
+				{Suite: "http", Name: "GET https://example.com/"},
+				{Suite: "http", Name: "GET https://my-app.example.org/", Failure: "x509: certificate is valid for"},
+			},
+		},
+		{
+			name:        "unexpected status and body",
+			values:      values,
+			deployments: []runtime.Object{deployment("production", available)},
+			checks:      []Check{{Path: "/missing"}, {Path: "/health", Status: 201}, {Path: "/", Body: "ok"}},
+			expectedResults: []Result{
+				{Suite: "rollout", Name: "Deployment/production"},
+				{Suite: "http", Name: "GET https://example.com/missing", Failure: "expected a status below 400, got 404 Not Found, gave up after 50ms"},
+				{Suite: "http", Name: "GET https://example.com/health", Failure: "expected the status 201, got 200 OK, gave up after 50ms"},
+				{Suite: "http", Name: "GET https://example.com/", Failure: `the body doesn't match "ok", gave up after 50ms`},
+			},
+		},
+		{
+			name:           "certificate that expires soon",
+			values:         values,
+			deployments:    []runtime.Object{deployment("production", available)},
+			checks:         []Check{{}, {Name: "insecure", InsecureSkipTLSVerify: true}},
+			minTLSValidity: 100 * 365 * 24 * time.Hour,
+			expectedResults: []Result{
+				{Suite: "rollout", Name: "Deployment/production"},
+				{Suite: "http", Name: "GET https://example.com/", Failure: "in less than 876000h0m0s, gave up after 50ms"},
+				{Suite: "http", Name: "insecure https://example.com/"},
+			},
+		},
+		{
+			name:   "unavailable Deployment",
+			values: values,
+			deployments: []runtime.Object{deployment("production", appsv1.DeploymentStatus{
+				ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 1,
+			})},
+			checks: DefaultChecks,
+			expectedResults: []Result{
+				{Suite: "rollout", Name: "Deployment/production", Failure: "1 old replicas are pending termination, gave up after 50ms"},
+			},
+		},
+		{
+			name:   "failed rollout",
+			values: values,
+			deployments: []runtime.Object{deployment("production", appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Conditions: []appsv1.DeploymentCondition{{
+					Type:    appsv1.DeploymentProgressing,
+					Reason:  "ProgressDeadlineExceeded",
+					Message: `ReplicaSet "production-5d8f" has timed out progressing.`,
+				}},
+			})},
+			checks: DefaultChecks,
+			expectedResults: []Result{
+				{Suite: "rollout", Name: "Deployment/production", Failure: `the rollout exceeded its progress deadline: ReplicaSet "production-5d8f" has timed out progressing.`},
+			},
+		},
+		{
+			name:   "missing Deployment",
+			values: values,
+			checks: DefaultChecks,
+			expectedResults: []Result{
+				{Suite: "rollout", Name: "Deployment/production", Failure: `deployments.apps "production" not found, gave up after 50ms`},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := &Checker{
+				Clientset:      fake.NewSimpleClientset(tc.deployments...),
+				Client:         newServer(t),
+				Timeout:        50 * time.Millisecond,
+				Interval:       10 * time.Millisecond,
+				MinTLSValidity: tc.minTLSValidity,
+			}
+			report, err := checker.Check(context.Background(), newRelease(t, tc.values), tc.checks)
+			require.NoError(t, err)
+			require.Equal(t, "production", report.Release)
+			require.Len(t, report.Results, len(tc.expectedResults))
+			failed := false
+			for i, result := range report.Results {
+				expected := tc.expectedResults[i]
+				require.Equal(t, expected.Suite, result.Suite)
+				require.Equal(t, expected.Name, result.Name)
+				if expected.Failure == "" {
+					require.Empty(t, result.Failure, result.Name)
+				} else {
+					require.Contains(t, result.Failure, expected.Failure)
+				}
+				failed = failed || expected.Failure != ""
+			}
+			require.Equal(t, failed, report.Failed())
+		})
+	}
+}
+
+func TestChecker_Check_InvalidBody(t *testing.T) {
+	checker := &Checker{Clientset: fake.NewSimpleClientset(deployment("production", available))}
+	_, err := checker.Check(context.Background(), newRelease(t, map[string]string{"service.url": "http://example.com"}), []Check{{Body: "("}})
+	require.EqualError(t, err, "check GET: error parsing regexp: missing closing ): `(`")
+}
+
+func TestURLs(t *testing.T) {
+	tcs := []struct {
+		name   string
+		values string
+
+		expectedURLs  []string
+		expectedError string
+	}{
+		{
+			name:         "default path",
+			values:       "service:\n  url: http://my-app.example.com\ningress:\n  path: /",
+			expectedURLs: []string{"http://my-app.example.com/"},
+		},
+		{
+			name: "additional hosts with TLS",
+			values: `service:
+  url: https://my-app.example.com
+  additionalHosts: [my-app-main.example.com, www.example.com]
+ingress:
+  path: /app
+  tls:
+    enabled: true`,
+			expectedURLs: []string{"https://my-app.example.com/app", "https://my-app-main.example.com/app", "https://www.example.com/app"},
+		},
+		{
+			name:         "additional hosts without TLS",
+			values:       "service:\n  url: http://my-app.example.com\n  additionalHosts: [www.example.com]\ningress:\n  tls:\n    enabled: false",
+			expectedURLs: []string{"http://my-app.example.com", "http://www.example.com"},
+		},
+		{
+			name:          "no URL",
+			values:        "service:\n  url:",
+			expectedError: "service.url is not set",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := chartutil.ReadValues([]byte(tc.values))
+			require.NoError(t, err)
+			urls, err := URLs(values)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedURLs, urls)
+		})
+	}
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	report := &Report{
+		Release: "production",
+		Results: []Result{
+			{Suite: "rollout", Name: "Deployment/production", Duration: 1500 * time.Millisecond},
+			{Suite: "http", Name: "GET https://example.com", Duration: 20 * time.Millisecond},
+			{Suite: "http", Name: "GET https://www.example.com", Duration: 5 * time.Second, Failure: `expected a status below 400, got 502 Bad Gateway & "more"`},
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteJUnit(&out))
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="production/rollout" tests="1" failures="0" time="1.500">
+    <testcase name="Deployment/production" classname="production/rollout" time="1.500"></testcase>
+  </testsuite>
+  <testsuite name="production/http" tests="2" failures="1" time="5.020">
+    <testcase name="GET https://example.com" classname="production/http" time="0.020"></testcase>
+    <testcase name="GET https://www.example.com" classname="production/http" time="5.000">
+      <failure message="expected a status below 400, got 502 Bad Gateway &amp; &#34;more&#34;">expected a status below 400, got 502 Bad Gateway &amp; &#34;more&#34;</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`, out.String())
+}
@@ -0,0 +1,234 @@
+// Package preflight checks that the resources a rendering of the chart references but doesn't render exist in the
+// cluster, before `helm upgrade --atomic --wait` fails late on them:
+//
+//   - the Secrets of envFrom, secretKeyRef and secret volumes, e.g. application.secretName,
+//   - the ServiceAccount of the pods, serviceAccount.name if serviceAccount.createNew is false,
+//   - the PriorityClass of the pods, priorityClassName,
+//   - the imagePullSecrets of the pods, image.secrets,
+//   - the IngressClass of the Ingress, ingress.className,
+//   - the StorageClass of the PersistentVolumeClaims, persistence.volumes[].claim.storageClass.
+//
+// References marked optional and resources of the rendering, e.g. a ServiceAccount with createNew or the Secret a
+// Crossplane claim writes, are skipped. Missing imagePullSecrets are warnings: the pods start if the image can be
+// pulled without credentials.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Reference is a resource outside of the rendering a rendered resource needs.
+type Reference struct {
+	Kind string
+	Name string
+	// Resource and Path are where the reference is, e.g. Deployment/production and spec.template.spec.priorityClassName.
+	Resource string
+	Path     string
+	// Warning is set if the rollout doesn't fail without the resource.
+	Warning bool
+}
+
+// Problem is a reference to a resource that doesn't exist.
+type Problem struct {
+	Resource string
+	Path     string
+	Message  string
+	Warning  bool
+}
+
+func (p Problem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("warning: %s: %s: %s", p.Resource, p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Resource, p.Path, p.Message)
+}
+
+// podTemplates are the paths of the pod specs of the workload kinds.
+var podTemplates = map[string][]string{
+	"Pod":         {},
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// References returns the references of the rendering to resources it doesn't render.
+func References(r *integrity.Release) []Reference {
+	// a Crossplane claim writes the Secret of its connection
+	written := map[string]bool{}
+	for _, obj := range r.Objects() {
+		if name, ok, _ := unstructured.NestedString(obj.Object, "spec", "writeConnectionSecretToRef", "name"); ok {
+			written[name] = true
+		}
+	}
+
+	var refs []Reference
+	for _, obj := range r.Objects() {
+		resource := obj.GetKind() + "/" + obj.GetName()
+		add := func(kind, name, path string, warning bool) {
+			if name == "" || r.Get(kind, name) != nil || (kind == "Secret" && written[name]) {
+				return
+			}
+			refs = append(refs, Reference{Kind: kind, Name: name, Resource: resource, Path: path, Warning: warning})
+		}
+
+		if templatePath, ok := podTemplates[obj.GetKind()]; ok {
+			spec, _, _ := unstructured.NestedMap(obj.Object, append(templatePath, "spec")...)
+			prefix := strings.Join(append(templatePath, "spec"), ".")
+			podReferences(spec, prefix, add)
+		}
+		switch obj.GetKind() {
+		case "Ingress":
+			name, _, _ := unstructured.NestedString(obj.Object, "spec", "ingressClassName")
+			add("IngressClass", name, "spec.ingressClassName", false)
+		case "PersistentVolumeClaim":
+			name, _, _ := unstructured.NestedString(obj.Object, "spec", "storageClassName")
+			add("StorageClass", name, "spec.storageClassName", false)
+		case "StatefulSet":
+			claims, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+			for i, claim := range claims {
+				claim, _ := claim.(map[string]interface{})
+				name, _, _ := unstructured.NestedString(claim, "spec", "storageClassName")
+				add("StorageClass", name, fmt.Sprintf("spec.volumeClaimTemplates[%d].spec.storageClassName", i), false)
+			}
+		}
+	}
+	return refs
+}
+
+// podReferences adds the references of a pod spec.
+func podReferences(spec map[string]interface{}, prefix string, add func(kind, name, path string, warning bool)) {
+	name, _, _ := unstructured.NestedString(spec, "serviceAccountName")
+	add("ServiceAccount", name, prefix+".serviceAccountName", false)
+	name, _, _ = unstructured.NestedString(spec, "priorityClassName")
+	add("PriorityClass", name, prefix+".priorityClassName", false)
+
+	pullSecrets, _, _ := unstructured.NestedSlice(spec, "imagePullSecrets")
+	for i, secret := range pullSecrets {
+		secret, _ := secret.(map[string]interface{})
+		name, _, _ := unstructured.NestedString(secret, "name")
+		add("Secret", name, fmt.Sprintf("%s.imagePullSecrets[%d].name", prefix, i), true)
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+	for i, volume := range volumes {
+		volume, _ := volume.(map[string]interface{})
+		if optional, _, _ := unstructured.NestedBool(volume, "secret", "optional"); optional {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(volume, "secret", "secretName")
+		add("Secret", name, fmt.Sprintf("%s.volumes[%d].secret.secretName", prefix, i), false)
+	}
+
+	for _, containers := range []string{"initContainers", "containers"} {
+		list, _, _ := unstructured.NestedSlice(spec, containers)
+		for i, container := range list {
+			container, _ := container.(map[string]interface{})
+			containerPath := fmt.Sprintf("%s.%s[%d]", prefix, containers, i)
+
+			envFrom, _, _ := unstructured.NestedSlice(container, "envFrom")
+			for j, source := range envFrom {
+				source, _ := source.(map[string]interface{})
+				if optional, _, _ := unstructured.NestedBool(source, "secretRef", "optional"); optional {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(source, "secretRef", "name")
+				add("Secret", name, fmt.Sprintf("%s.envFrom[%d].secretRef.name", containerPath, j), false)
+			}
+
+			env, _, _ := unstructured.NestedSlice(container, "env")
+			for j, variable := range env {
+				variable, _ := variable.(map[string]interface{})
+				if optional, _, _ := unstructured.NestedBool(variable, "valueFrom", "secretKeyRef", "optional"); optional {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(variable, "valueFrom", "secretKeyRef", "name")
+				add("Secret", name, fmt.Sprintf("%s.env[%d].valueFrom.secretKeyRef.name", containerPath, j), false)
+			}
+		}
+	}
+}
+
+// Check parses the manifests and checks their references in the namespace of the cluster.
+func Check(ctx context.Context, clientset kubernetes.Interface, namespace, manifests string) ([]Problem, error) {
+	r, err := integrity.Parse(manifests)
+	if err != nil {
+		return nil, err
+	}
+	return CheckReferences(ctx, clientset, namespace, References(r))
+}
+
+// CheckReferences returns a problem for every reference to a resource that doesn't exist. A reference that can't
+// be checked because the access is forbidden is a warning.
+func CheckReferences(ctx context.Context, clientset kubernetes.Interface, namespace string, refs []Reference) ([]Problem, error) {
+	// a resource is looked up once, however often it is referenced
+	errs := map[string]error{}
+	var problems []Problem
+	for _, ref := range refs {
+		key := ref.Kind + "/" + ref.Name
+		err, ok := errs[key]
+		if !ok {
+			err = get(ctx, clientset, namespace, ref.Kind, ref.Name)
+			errs[key] = err
+		}
+		switch {
+		case err == nil:
+			continue
+		case apierrors.IsNotFound(err):
+			message := fmt.Sprintf("%s %q doesn't exist", ref.Kind, ref.Name)
+			if namespaced(ref.Kind) {
+				message += " in namespace " + namespace
+			}
+			problems = append(problems, Problem{Resource: ref.Resource, Path: ref.Path, Message: message, Warning: ref.Warning})
+		case apierrors.IsForbidden(err):
+			problems = append(problems, Problem{
+				Resource: ref.Resource,
+				Path:     ref.Path,
+				Message:  fmt.Sprintf("%s %q can't be checked: %s", ref.Kind, ref.Name, err),
+				Warning:  true,
+			})
+		default:
+			return nil, fmt.Errorf("%s %q: %w", ref.Kind, ref.Name, err)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return !problems[i].Warning && problems[j].Warning
+	})
+	return problems, nil
+}
+
+func namespaced(kind string) bool {
+	return kind == "Secret" || kind == "ServiceAccount"
+}
+
+// get gets the resource of the kind with the name.
+func get(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string) error {
+	var err error
+	options := metav1.GetOptions{}
+	switch kind {
+	case "Secret":
+		_, err = clientset.CoreV1().Secrets(namespace).Get(ctx, name, options)
+	case "ServiceAccount":
+		_, err = clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, options)
+	case "IngressClass":
+		_, err = clientset.NetworkingV1().IngressClasses().Get(ctx, name, options)
+	case "StorageClass":
+		_, err = clientset.StorageV1().StorageClasses().Get(ctx, name, options)
+	case "PriorityClass":
+		_, err = clientset.SchedulingV1().PriorityClasses().Get(ctx, name, options)
+	default:
+		err = fmt.Errorf("unsupported kind")
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/render"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// cluster has the resources the chart references by default and in the test cases.
+var cluster = []runtime.Object{
+	&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "gitlab-registry", Namespace: "review"}},
+	&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "review"}},
+	&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "review"}},
+	&networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: "nginx"}},
+	&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}},
+	&schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: "high"}},
+}
+
+func TestCheck(t *testing.T) {
+	r, err := render.Load("../..")
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedProblems []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "existing references",
+			values: map[string]string{
+				"application.secretName":                    "my-app",
+				"serviceAccount.name":                       "my-app",
+				"ingress.className":                         "nginx",
+				"priorityClassName":                         "high",
+				"workers.worker.command[0]":                 "worker",
+				"cronjobs.job.command[0]":                   "job",
+				"cronjobs.job.schedule":                     "* * * * *",
+				"application.migrateCommand":                "migrate",
+				"persistence.enabled":                       "true",
+				"persistence.volumes[0].name":               "data",
+				"persistence.volumes[0].mount.path":         "/data",
+				"persistence.volumes[0].claim.accessMode":   "ReadWriteOnce",
+				"persistence.volumes[0].claim.size":         "1Gi",
+				"persistence.volumes[0].claim.storageClass": "standard",
+			},
+		},
+		{
+			name: "missing references",
+			values: map[string]string{
+				"application.secretName":                    "other-app",
+				"serviceAccount.name":                       "other-app",
+				"ingress.className":                         "traefik",
+				"priorityClassName":                         "low",
+				"image.secrets[0].name":                     "registry",
+				"workers.worker.command[0]":                 "worker",
+				"persistence.enabled":                       "true",
+				"persistence.volumes[0].name":               "data",
+				"persistence.volumes[0].mount.path":         "/data",
+				"persistence.volumes[0].claim.accessMode":   "ReadWriteOnce",
+				"persistence.volumes[0].claim.size":         "1Gi",
+				"persistence.volumes[0].claim.storageClass": "fast",
+			},
+			expectedProblems: []string{
+				`PersistentVolumeClaim/production-auto-deploy-data: spec.storageClassName: StorageClass "fast" doesn't exist`,
+				`Deployment/production: spec.template.spec.serviceAccountName: ServiceAccount "other-app" doesn't exist in namespace review`,
+				`Deployment/production: spec.template.spec.priorityClassName: PriorityClass "low" doesn't exist`,
+				`Deployment/production: spec.template.spec.containers[0].envFrom[0].secretRef.name: Secret "other-app" doesn't exist in namespace review`,
+				`Ingress/production-auto-deploy: spec.ingressClassName: IngressClass "traefik" doesn't exist`,
+				`Deployment/production-worker: spec.template.spec.serviceAccountName: ServiceAccount "other-app" doesn't exist in namespace review`,
+				`Deployment/production-worker: spec.template.spec.containers[0].envFrom[0].secretRef.name: Secret "other-app" doesn't exist in namespace review`,
+				`warning: Deployment/production: spec.template.spec.imagePullSecrets[0].name: Secret "registry" doesn't exist in namespace review`,
+				`warning: Deployment/production-worker: spec.template.spec.imagePullSecrets[0].name: Secret "registry" doesn't exist in namespace review`,
+			},
+		},
+		{
+			name:   "rendered ServiceAccount",
+			values: map[string]string{"serviceAccount.name": "new-app", "serviceAccount.createNew": "true"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			manifests, err := r.Render("production", render.Options{Namespace: "review", SetValues: tc.values, APIVersions: []string{"networking.k8s.io/v1/Ingress"}})
+			require.NoError(t, err)
+
+			problems, err := Check(context.Background(), fake.NewSimpleClientset(cluster...), "review", manifests)
+			require.NoError(t, err)
+			var actual []string
+			for _, problem := range problems {
+				actual = append(actual, problem.String())
+			}
+			require.Equal(t, tc.expectedProblems, actual)
+		})
+	}
+}
+
+func TestReferences(t *testing.T) {
+	r, err := render.Load("../..")
+	require.NoError(t, err)
+	manifests, err := r.Render("production", render.Options{SetValues: map[string]string{
+		"application.secretName": "my-app",
+		"postgresql.managed":     "true",
+	}})
+	require.NoError(t, err)
+
+	problems, err := Check(context.Background(), fake.NewSimpleClientset(), "review", manifests)
+	require.NoError(t, err)
+	// the Secret app-postgres of the PostgreSQLInstance isn't a problem
+	require.Equal(t, []Problem{
+		{
+			Resource: "Deployment/production",
+			Path:     "spec.template.spec.containers[0].envFrom[0].secretRef.name",
+			Message:  `Secret "my-app" doesn't exist in namespace review`,
+		},
+		{
+			Resource: "Deployment/production",
+			Path:     "spec.template.spec.imagePullSecrets[0].name",
+			Message:  `Secret "gitlab-registry" doesn't exist in namespace review`,
+			Warning:  true,
+		},
+	}, problems)
+}
+
+func TestCheckReferences_Errors(t *testing.T) {
+	refs := []Reference{
+		{Kind: "StorageClass", Name: "fast", Resource: "PersistentVolumeClaim/data", Path: "spec.storageClassName"},
+		{Kind: "StorageClass", Name: "fast", Resource: "PersistentVolumeClaim/logs", Path: "spec.storageClassName"},
+	}
+
+	t.Run("forbidden", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		gets := 0
+		clientset.PrependReactor("get", "storageclasses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			gets++
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "storage.k8s.io", Resource: "storageclasses"}, "fast", fmt.Errorf("no access"))
+		})
+		problems, err := CheckReferences(context.Background(), clientset, "review", refs)
+		require.NoError(t, err)
+		require.Equal(t, 1, gets)
+		require.Equal(t, []Problem{
+			{Resource: "PersistentVolumeClaim/data", Path: "spec.storageClassName", Message: `StorageClass "fast" can't be checked: storageclasses.storage.k8s.io "fast" is forbidden: no access`, Warning: true},
+			{Resource: "PersistentVolumeClaim/logs", Path: "spec.storageClassName", Message: `StorageClass "fast" can't be checked: storageclasses.storage.k8s.io "fast" is forbidden: no access`, Warning: true},
+		}, problems)
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("get", "storageclasses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewServiceUnavailable("unavailable")
+		})
+		_, err := CheckReferences(context.Background(), clientset, "review", refs)
+		require.EqualError(t, err, `StorageClass "fast": unavailable`)
+	})
+}
@@ -0,0 +1,188 @@
+// Package render renders a chart in-process with Helm's chart loader and template engine,
+// producing the same output as `helm template` without a helm binary.
+//
+// The chart is loaded once per Renderer, so rendering hundreds of test cases only pays for the
+// template execution.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/copystructure"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// Options are the `helm template` flags the renderer supports.
+type Options struct {
+	Namespace string
+
+	// SetValues, SetStrValues and SetFiles are applied in sorted key order, like terratest passes them to helm.
+	SetValues    map[string]string // --set
+	SetStrValues map[string]string // --set-string
+	SetFiles     map[string]string // --set-file
+	ValuesFiles  []string          // --values
+
+	ShowOnly    []string // --show-only
+	KubeVersion string   // --kube-version
+	APIVersions []string // --api-versions
+	IsUpgrade   bool     // --is-upgrade
+
+	// OnlyAPIVersions renders with APIVersions as the only API versions, like a cluster that serves just those,
+	// instead of adding them to helm's defaults, which contain every built-in group version, e.g. policy/v1.
+	OnlyAPIVersions bool
+}
+
+// defaultCapabilities guards chartutil.DefaultCapabilities, which helm copies for every client-only rendering and
+// Render replaces for the renderings with OnlyAPIVersions.
+var defaultCapabilities sync.RWMutex
+
+// Renderer renders a loaded chart.
+type Renderer struct {
+	chart *chart.Chart
+}
+
+// Load loads the chart in chartPath, a directory or a packaged chart.
+func Load(chartPath string) (*Renderer, error) {
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if c.Metadata.Type != "" && c.Metadata.Type != "application" {
+		return nil, fmt.Errorf("%s charts are not installable", c.Metadata.Type)
+	}
+	if req := c.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(c, req); err != nil {
+			return nil, fmt.Errorf("an error occurred while checking for chart dependencies. You may need to run `helm dependency build` to fetch missing dependencies: %w", err)
+		}
+	}
+	return &Renderer{chart: c}, nil
+}
+
+// Render renders the chart like `helm template <releaseName> <chart>`. The errors have the same messages as helm's.
+func (r *Renderer) Render(releaseName string, opts Options) (string, error) {
+	valueOpts := &values.Options{
+		ValueFiles:   opts.ValuesFiles,
+		Values:       setArgs(opts.SetValues),
+		StringValues: setArgs(opts.SetStrValues),
+		FileValues:   setArgs(opts.SetFiles),
+	}
+	vals, err := valueOpts.MergeValues(getter.Providers{})
+	if err != nil {
+		return "", err
+	}
+
+	client := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	client.DryRun = true
+	client.ReleaseName = releaseName
+	client.Replace = true // Skip the name check
+	client.ClientOnly = true
+	client.Namespace = opts.Namespace
+	if client.Namespace == "" {
+		client.Namespace = "default"
+	}
+	client.APIVersions = chartutil.VersionSet(opts.APIVersions)
+	client.IsUpgrade = opts.IsUpgrade
+	if opts.KubeVersion != "" {
+		client.KubeVersion, err = chartutil.ParseKubeVersion(opts.KubeVersion)
+		if err != nil {
+			return "", fmt.Errorf("invalid kube version '%s': %s", opts.KubeVersion, err)
+		}
+	}
+
+	if opts.OnlyAPIVersions {
+		defaultCapabilities.Lock()
+		defer defaultCapabilities.Unlock()
+		defaults := chartutil.DefaultCapabilities
+		capabilities := defaults.Copy()
+		capabilities.APIVersions = nil
+		chartutil.DefaultCapabilities = capabilities
+		defer func() { chartutil.DefaultCapabilities = defaults }()
+	} else {
+		defaultCapabilities.RLock()
+		defer defaultCapabilities.RUnlock()
+	}
+
+	// rendering coalesces the values into the chart's default values, so every rendering gets its own copy
+	defaults, err := copystructure.Copy(r.chart.Values)
+	if err != nil {
+		return "", err
+	}
+	c := *r.chart
+	c.Values = defaults.(map[string]interface{})
+
+	rel, err := client.Run(&c, vals)
+	if err != nil {
+		return "", err
+	}
+
+	var manifests bytes.Buffer
+	fmt.Fprintln(&manifests, strings.TrimSpace(rel.Manifest))
+	for _, m := range rel.Hooks {
+		fmt.Fprintf(&manifests, "---\n# Source: %s\n%s\n", m.Path, m.Manifest)
+	}
+	if len(opts.ShowOnly) == 0 {
+		return manifests.String(), nil
+	}
+	return showOnly(manifests.String(), opts.ShowOnly)
+}
+
+// setArgs formats values as the arguments of a --set flag.
+func setArgs(setValues map[string]string) []string {
+	keys := make([]string, 0, len(setValues))
+	for key := range setValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, len(keys))
+	for i, key := range keys {
+		args[i] = fmt.Sprintf("%s=%s", key, setValues[key])
+	}
+	return args
+}
+
+var manifestNameRegex = regexp.MustCompile("# Source: [^/]+/(.+)")
+
+// showOnly filters the manifests like `helm template --show-only`.
+func showOnly(manifests string, showFiles []string) (string, error) {
+	splitManifests := releaseutil.SplitManifests(manifests)
+	manifestsKeys := make([]string, 0, len(splitManifests))
+	for k := range splitManifests {
+		manifestsKeys = append(manifestsKeys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(manifestsKeys))
+
+	var out strings.Builder
+	for _, f := range showFiles {
+		missing := true
+		f = filepath.ToSlash(f)
+		for _, manifestKey := range manifestsKeys {
+			manifest := splitManifests[manifestKey]
+			submatch := manifestNameRegex.FindStringSubmatch(manifest)
+			if len(submatch) == 0 {
+				continue
+			}
+			if matched, _ := filepath.Match(f, submatch[1]); !matched {
+				continue
+			}
+			fmt.Fprintf(&out, "---\n%s\n", manifest)
+			missing = false
+		}
+		if missing {
+			return "", fmt.Errorf("could not find template %s in chart", f)
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,121 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	r, err := Load("../..")
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name        string
+		releaseName string
+		opts        Options
+
+		expectedContains []string
+		expectedError    string
+	}{
+		{
+			name:        "show only",
+			releaseName: "production",
+			opts: Options{
+				Namespace: "review",
+				SetValues: map[string]string{"service.externalPort": "8080"},
+				ShowOnly:  []string{"templates/service.yaml"},
+			},
+			expectedContains: []string{"---\n# Source: auto-deploy-app/templates/service.yaml\n", "name: production-auto-deploy\n", "port: 8080\n"},
+		},
+		{
+			name:        "api versions",
+			releaseName: "production",
+			opts: Options{
+				APIVersions: []string{"networking.k8s.io/v1/Ingress"},
+				ShowOnly:    []string{"templates/ingress.yaml"},
+			},
+			expectedContains: []string{"apiVersion: networking.k8s.io/v1\n"},
+		},
+		{
+			name:        "only api versions",
+			releaseName: "production",
+			opts: Options{
+				SetValues:       map[string]string{"cronjobs.job1.schedule": "0 * * * *"},
+				APIVersions:     []string{"v1", "batch/v1beta1", "batch/v1beta1/CronJob"},
+				OnlyAPIVersions: true,
+				ShowOnly:        []string{"templates/cronjob.yaml"},
+			},
+			expectedContains: []string{`apiVersion: "batch/v1beta1"`},
+		},
+		{
+			name:        "hooks",
+			releaseName: "production",
+			opts: Options{
+				SetValues: map[string]string{"application.migrateCommand": "echo migrate"},
+				ShowOnly:  []string{"templates/db-migrate-hook.yaml"},
+			},
+			expectedContains: []string{"kind: Job\n", `"helm.sh/hook": pre-upgrade`},
+		},
+		{
+			name:          "template not rendered",
+			releaseName:   "production",
+			opts:          Options{ShowOnly: []string{"templates/pvc.yaml"}},
+			expectedError: "could not find template templates/pvc.yaml in chart",
+		},
+		{
+			name:          "invalid release name",
+			releaseName:   "Production",
+			expectedError: `release name "Production": invalid release name, must match regex ^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$ and the length must not be longer than 53`,
+		},
+		{
+			name:          "invalid kube version",
+			releaseName:   "production",
+			opts:          Options{KubeVersion: "latest"},
+			expectedError: "invalid kube version 'latest': Invalid Semantic Version",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := r.Render(tc.releaseName, tc.opts)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			for _, expected := range tc.expectedContains {
+				require.Contains(t, output, expected)
+			}
+		})
+	}
+}
+
+func TestRender_DoesNotModifyChart(t *testing.T) {
+	r, err := Load("../..")
+	require.NoError(t, err)
+
+	opts := Options{ShowOnly: []string{"templates/service.yaml"}}
+	expected, err := r.Render("production", opts)
+	require.NoError(t, err)
+
+	_, err = r.Render("production", Options{SetValues: map[string]string{"service.externalPort": "8080", "service.annotations.a": "b"}})
+	require.NoError(t, err)
+
+	output, err := r.Render("production", opts)
+	require.NoError(t, err)
+	require.Equal(t, expected, output)
+}
+
+func TestRender_OnlyAPIVersionsRestoresDefaults(t *testing.T) {
+	r, err := Load("../..")
+	require.NoError(t, err)
+
+	opts := Options{SetValues: map[string]string{"cronjobs.job1.schedule": "0 * * * *"}, ShowOnly: []string{"templates/cronjob.yaml"}}
+	_, err = r.Render("production", Options{APIVersions: []string{"v1"}, OnlyAPIVersions: true, ShowOnly: opts.ShowOnly, SetValues: opts.SetValues})
+	require.NoError(t, err)
+
+	output, err := r.Render("production", opts)
+	require.NoError(t, err)
+	require.Contains(t, output, `apiVersion: "batch/v1"`)
+}
@@ -0,0 +1,139 @@
+// Command gen generates the JSON schemas vendored in schema/kubernetes: per version in schema.KubernetesVersions, the
+// kinds the version serves (served-v<version>.json) and the definitions of their fields (definitions-v<version>.json).
+//
+// A binary can only link one version of k8s.io/api, so the definitions of each version are generated by a program
+// from definitions.go.tmpl, which is run in a temporary module requiring k8s.io/api v0.<minor>.0. The modules are
+// downloaded from GOPROXY.
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/schema"
+)
+
+//go:embed definitions.go.tmpl
+var definitionsTemplate string
+
+// program is the data of definitionsTemplate.
+type program struct {
+	KubernetesVersion string
+	Imports           []goImport
+	Kinds             []goKind
+}
+
+type goImport struct {
+	Name, Path string
+}
+
+type goKind struct {
+	API, Package, Kind string
+}
+
+func main() {
+	out := flag.String("out", "kubernetes", "directory to write the schemas to")
+	flag.Parse()
+
+	for _, version := range schema.KubernetesVersions {
+		generated, err := generate(version, schema.ServedAPIs(version))
+		if err != nil {
+			log.Fatalf("Kubernetes %s: %v", version, err)
+		}
+		write(filepath.Join(*out, "served-v"+version+".json"), schema.Index{KubernetesVersion: version, Kinds: generated.Kinds})
+		write(filepath.Join(*out, "definitions-v"+version+".json"), map[string]interface{}{"definitions": generated.Definitions})
+	}
+}
+
+// generated is the output of a program.
+type generated struct {
+	Kinds       map[string]string         `json:"kinds"`
+	Definitions map[string]*schema.Schema `json:"definitions"`
+}
+
+// generate runs the program for the served "apiVersion/Kind"s of a Kubernetes version with its k8s.io/api version.
+func generate(version string, apis []string) (*generated, error) {
+	p := program{KubernetesVersion: version}
+	imported := map[string]bool{}
+	for _, api := range apis {
+		i := strings.LastIndex(api, "/")
+		path, name := goPackage(api[:i])
+		if !imported[path] {
+			imported[path] = true
+			p.Imports = append(p.Imports, goImport{Name: name, Path: path})
+		}
+		p.Kinds = append(p.Kinds, goKind{API: api, Package: name, Kind: api[i+1:]})
+	}
+
+	var source bytes.Buffer
+	if err := template.Must(template.New("definitions").Parse(definitionsTemplate)).Execute(&source, p); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "schema-gen-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	minor := strings.SplitN(version, ".", 2)[1]
+	goMod := fmt.Sprintf("module definitions\n\ngo 1.18\n\nrequire (\n\tk8s.io/api v0.%[1]s.0\n\tk8s.io/apimachinery v0.%[1]s.0\n)\n", minor)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), source.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+
+	if _, err := run(dir, "go", "mod", "tidy"); err != nil {
+		return nil, err
+	}
+	out, err := run(dir, "go", "run", ".")
+	if err != nil {
+		return nil, err
+	}
+	var g generated
+	if err := json.Unmarshal(out, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// goPackage returns the k8s.io/api package of an apiVersion and the name to import it as, e.g. networkingV1 for
+// networking.k8s.io/v1.
+func goPackage(apiVersion string) (path, name string) {
+	group, version := "core", apiVersion
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		group, version = strings.SplitN(apiVersion[:i], ".", 2)[0], apiVersion[i+1:]
+	}
+	return "k8s.io/api/" + group + "/" + version, group + strings.ToUpper(version[:1]) + version[1:]
+}
+
+func run(dir string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func write(path string, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatalf("failed to marshal %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		log.Fatalf("failed to write %s: %v", path, err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package schema validates rendered Kubernetes manifests against the JSON schemas vendored in kubernetes/,
+// without access to a cluster or the network.
+//
+// The schemas are generated by `go generate ./schema` from the k8s.io/api types of each Kubernetes version, e.g.
+// k8s.io/api v0.25.0 for Kubernetes 1.25. Per version, served-v<version>.json lists the apiVersion/kind combinations
+// the version serves and definitions-v<version>.json the fields of their types, so a Validator of a version reports
+// a field that version doesn't have, e.g. one added in a later version.
+package schema
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+//go:generate go run ./gen -out kubernetes
+
+//go:embed kubernetes/*.json
+var vendored embed.FS
+
+// Schema is the subset of JSON schema the generated definitions use.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	IntOrString          bool               `json:"x-kubernetes-int-or-string,omitempty"`
+	PreserveUnknown      bool               `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+}
+
+// Index maps the "apiVersion/Kind" a Kubernetes version serves to the definition of the kind, one index is vendored
+// per Kubernetes version next to the definitions of that version.
+type Index struct {
+	KubernetesVersion string            `json:"kubernetesVersion"`
+	Kinds             map[string]string `json:"kinds"`
+}
+
+// Violation is a schema violation of a single field of a rendered resource.
+type Violation struct {
+	Resource string
+	Path     string
+	Message  string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return fmt.Sprintf("%s: %s", v.Resource, v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Resource, v.Path, v.Message)
+}
+
+// Validator validates the fields of resources and that one Kubernetes version serves their apiVersion and kind.
+type Validator struct {
+	index       Index
+	definitions map[string]*Schema
+	// versions are the validators of every vendored version, newest first, if the Validator accepts a kind any of
+	// them serves.
+	versions []*Validator
+}
+
+var definitions struct {
+	sync.Mutex
+	byVersion map[string]map[string]*Schema
+}
+
+// loadDefinitions loads the definitions of a Kubernetes version once.
+func loadDefinitions(kubeVersion string) (map[string]*Schema, error) {
+	definitions.Lock()
+	defer definitions.Unlock()
+	if defs, ok := definitions.byVersion[kubeVersion]; ok {
+		return defs, nil
+	}
+	b, err := vendored.ReadFile(path.Join("kubernetes", "definitions-v"+kubeVersion+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Definitions map[string]*Schema `json:"definitions"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+	if definitions.byVersion == nil {
+		definitions.byVersion = map[string]map[string]*Schema{}
+	}
+	definitions.byVersion[kubeVersion] = file.Definitions
+	return file.Definitions, nil
+}
+
+// NewValidator loads the apiVersions and kinds a Kubernetes minor version serves, e.g. "1.25", and their fields in
+// that version. With an empty version a kind is accepted if any of the vendored versions serves it, and its fields
+// are those of the newest version serving it.
+func NewValidator(kubeVersion string) (*Validator, error) {
+	if kubeVersion == "" {
+		v := &Validator{}
+		for i := len(KubernetesVersions) - 1; i >= 0; i-- {
+			version, err := NewValidator(KubernetesVersions[i])
+			if err != nil {
+				return nil, err
+			}
+			v.versions = append(v.versions, version)
+		}
+		return v, nil
+	}
+	kubeVersion = strings.TrimPrefix(kubeVersion, "v")
+	b, err := vendored.ReadFile(path.Join("kubernetes", "served-v"+kubeVersion+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("no served APIs vendored for Kubernetes %s: %w", kubeVersion, err)
+	}
+	v := &Validator{}
+	if err := json.Unmarshal(b, &v.index); err != nil {
+		return nil, fmt.Errorf("failed to load schema index for Kubernetes %s: %w", kubeVersion, err)
+	}
+	if v.definitions, err = loadDefinitions(kubeVersion); err != nil {
+		return nil, fmt.Errorf("failed to load schema definitions for Kubernetes %s: %w", kubeVersion, err)
+	}
+	return v, nil
+}
+
+// Validate validates a decoded resource. Items of `v1 List` resources are validated one by one.
+// Resources of API groups unknown to the vendored schemas (e.g. custom resources) are skipped.
+func (v *Validator) Validate(obj map[string]interface{}) []Violation {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	resource := resourceName(obj)
+
+	if apiVersion == "v1" && kind == "List" {
+		items, ok := obj["items"].([]interface{})
+		if !ok && obj["items"] != nil {
+			return []Violation{{Resource: resource, Path: "items", Message: "expected array"}}
+		}
+		var violations []Violation
+		for i, item := range items {
+			itemObj, ok := item.(map[string]interface{})
+			if !ok {
+				violations = append(violations, Violation{Resource: resource, Path: fmt.Sprintf("items[%d]", i), Message: "expected object"})
+				continue
+			}
+			violations = append(violations, v.Validate(itemObj)...)
+		}
+		return violations
+	}
+
+	if apiVersion == "" || kind == "" {
+		return []Violation{{Resource: resource, Message: "apiVersion and kind must be set"}}
+	}
+	for _, version := range v.versions {
+		if _, ok := version.index.Kinds[apiVersion+"/"+kind]; ok {
+			return version.Validate(obj)
+		}
+	}
+	ref, ok := v.index.Kinds[apiVersion+"/"+kind]
+	if !ok {
+		if knownAPIVersions()[apiVersion] {
+			served := "Kubernetes " + v.index.KubernetesVersion
+			if v.index.KubernetesVersion == "" {
+				served = fmt.Sprintf("any Kubernetes version from %s to %s", KubernetesVersions[0], KubernetesVersions[len(KubernetesVersions)-1])
+			}
+			return []Violation{{Resource: resource, Message: fmt.Sprintf("%s %s is not served by %s", apiVersion, kind, served)}}
+		}
+		return nil
+	}
+
+	var violations []Violation
+	v.validate(&Schema{Ref: ref}, obj, "", func(path, msg string) {
+		violations = append(violations, Violation{Resource: resource, Path: path, Message: msg})
+	})
+	return violations
+}
+
+func (v *Validator) validate(s *Schema, value interface{}, path string, report func(path, msg string)) {
+	for s.Ref != "" {
+		def, ok := v.definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		if !ok {
+			report(path, fmt.Sprintf("unresolved schema reference %s", s.Ref))
+			return
+		}
+		s = def
+	}
+	// null is accepted for every field, the API server decodes it to the zero value
+	if value == nil || s.PreserveUnknown {
+		return
+	}
+
+	if s.IntOrString {
+		switch value.(type) {
+		case string, float64:
+		default:
+			report(path, fmt.Sprintf("expected integer or string, got %s", typeName(value)))
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			report(path, fmt.Sprintf("expected object, got %s", typeName(value)))
+			return
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldPath := joinPath(path, key)
+			if prop, ok := s.Properties[key]; ok {
+				v.validate(prop, obj[key], fieldPath, report)
+			} else if s.AdditionalProperties != nil {
+				v.validate(s.AdditionalProperties, obj[key], fieldPath, report)
+			} else {
+				report(fieldPath, "unknown field")
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			report(path, fmt.Sprintf("expected array, got %s", typeName(value)))
+			return
+		}
+		for i, item := range items {
+			v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			report(path, fmt.Sprintf("expected string, got %s", typeName(value)))
+		}
+	case "integer":
+		if f, ok := value.(float64); !ok || f != float64(int64(f)) {
+			report(path, fmt.Sprintf("expected integer, got %s", typeName(value)))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			report(path, fmt.Sprintf("expected number, got %s", typeName(value)))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report(path, fmt.Sprintf("expected boolean, got %s", typeName(value)))
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func typeName(value interface{}) string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func resourceName(obj map[string]interface{}) string {
+	kind, _ := obj["kind"].(string)
+	if kind == "" {
+		kind = "<unknown kind>"
+	}
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	if name == "" {
+		return kind
+	}
+	return kind + "/" + name
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// ValidateManifests validates every document of a multi-document YAML stream, e.g. the output of `helm template`.
+func (v *Validator) ValidateManifests(manifests string) ([]Violation, error) {
+	var violations []Violation
+	for i, doc := range documentSeparator.Split(manifests, -1) {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse document %d: %w", i, err)
+		}
+		if obj == nil {
+			continue
+		}
+		violations = append(violations, v.Validate(obj)...)
+	}
+	return violations, nil
+}
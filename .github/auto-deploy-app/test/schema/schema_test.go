@@ -0,0 +1,206 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateManifests(t *testing.T) {
+	tcs := []struct {
+		name        string
+		kubeVersion string
+		manifests   string
+
+		expectedViolations []string
+	}{
+		{
+			name:        "valid deployment",
+			kubeVersion: "1.25",
+			manifests: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+  labels:
+    app: production
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: production
+  template:
+    spec:
+      containers:
+      - name: auto-deploy-app
+        image: "registry.example.com/app:stable"
+        ports:
+        - containerPort: 5000
+        resources:
+          requests:
+            cpu: 500
+            memory: 128Mi
+        livenessProbe:
+          httpGet:
+            path: /
+            port: 5000
+          initialDelaySeconds: 15
+`,
+		},
+		{
+			name:        "misspelled and misplaced fields",
+			kubeVersion: "1.25",
+			manifests: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+spec:
+  replicas: "two"
+  template:
+    spec:
+      containers:
+      - name: auto-deploy-app
+        livenessProbe:
+          httpGet:
+            path: /
+            port: 5000
+            failureThreshold: 3
+          initialDelaySecond: 15
+`,
+			expectedViolations: []string{
+				"Deployment/production: spec.replicas: expected integer, got string",
+				"Deployment/production: spec.template.spec.containers[0].livenessProbe.httpGet.failureThreshold: unknown field",
+				"Deployment/production: spec.template.spec.containers[0].livenessProbe.initialDelaySecond: unknown field",
+			},
+		},
+		{
+			name:        "kind removed in newer versions",
+			kubeVersion: "1.25",
+			manifests: `
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: production-job
+`,
+			expectedViolations: []string{
+				"CronJob/production-job: batch/v1beta1 CronJob is not served by Kubernetes 1.25",
+			},
+		},
+		{
+			name:        "kind not yet served in older versions",
+			kubeVersion: "1.20",
+			manifests: `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: production-job
+`,
+			expectedViolations: []string{
+				"CronJob/production-job: batch/v1 CronJob is not served by Kubernetes 1.20",
+			},
+		},
+		{
+			name:        "field added in a later version",
+			kubeVersion: "1.23",
+			manifests: `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: production-job
+spec:
+  schedule: "0 3 * * *"
+  timeZone: Etc/UTC
+`,
+			expectedViolations: []string{
+				"CronJob/production-job: spec.timeZone: unknown field",
+			},
+		},
+		{
+			name:        "field of the version",
+			kubeVersion: "1.25",
+			manifests: `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: production-job
+spec:
+  schedule: "0 3 * * *"
+  timeZone: Etc/UTC
+`,
+		},
+		{
+			name: "any version",
+			manifests: `
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: production
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: production-job
+`,
+		},
+		{
+			name:        "items of lists",
+			kubeVersion: "1.25",
+			manifests: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: production-worker
+    labels:
+      track: 1
+`,
+			expectedViolations: []string{
+				"Deployment/production-worker: metadata.labels.track: expected string, got integer",
+			},
+		},
+		{
+			name:        "custom resources are skipped",
+			kubeVersion: "1.25",
+			manifests: `
+# Source: auto-deploy-app/templates/custom-resources.yaml
+apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  name: ingress-route
+spec:
+  anything: goes
+`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			validator, err := NewValidator(tc.kubeVersion)
+			require.NoError(t, err)
+
+			violations, err := validator.ValidateManifests(tc.manifests)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, violation := range violations {
+				messages = append(messages, violation.String())
+			}
+			require.Equal(t, tc.expectedViolations, messages)
+		})
+	}
+}
+
+func TestVendoredVersions(t *testing.T) {
+	for _, version := range KubernetesVersions {
+		validator, err := NewValidator(version)
+		require.NoError(t, err)
+		require.Len(t, validator.index.Kinds, len(ServedAPIs(version)), "vendored served APIs of %s are outdated, run go generate ./schema", version)
+		for api, ref := range validator.index.Kinds {
+			require.Contains(t, validator.definitions, strings.TrimPrefix(ref, "#/definitions/"), "no definition of %s in %s", api, version)
+		}
+	}
+}
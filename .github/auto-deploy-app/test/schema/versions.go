@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+)
+
+// servedAPI describes in which Kubernetes minor versions an apiVersion/kind is served.
+// since and until are inclusive minor versions, 0 means unbounded.
+type servedAPI struct {
+	apiVersion string
+	kind       string
+	since      int
+	until      int
+}
+
+// servedAPIs lists the kinds the chart can render (including the kinds commonly used in customResources)
+// together with the Kubernetes versions serving them.
+// See https://kubernetes.io/docs/reference/using-api/deprecation-guide/
+var servedAPIs = []servedAPI{
+	{"v1", "ConfigMap", 0, 0},
+	{"v1", "Namespace", 0, 0},
+	{"v1", "PersistentVolumeClaim", 0, 0},
+	{"v1", "Pod", 0, 0},
+	{"v1", "Secret", 0, 0},
+	{"v1", "Service", 0, 0},
+	{"v1", "ServiceAccount", 0, 0},
+	{"apps/v1", "DaemonSet", 0, 0},
+	{"apps/v1", "Deployment", 0, 0},
+	{"apps/v1", "ReplicaSet", 0, 0},
+	{"apps/v1", "StatefulSet", 0, 0},
+	{"autoscaling/v1", "HorizontalPodAutoscaler", 0, 0},
+	{"autoscaling/v2", "HorizontalPodAutoscaler", 23, 0},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", 0, 24},
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", 0, 25},
+	{"batch/v1", "CronJob", 21, 0},
+	{"batch/v1", "Job", 0, 0},
+	{"batch/v1beta1", "CronJob", 0, 24},
+	{"extensions/v1beta1", "Ingress", 0, 21},
+	{"networking.k8s.io/v1", "Ingress", 19, 0},
+	{"networking.k8s.io/v1", "IngressClass", 19, 0},
+	{"networking.k8s.io/v1", "NetworkPolicy", 0, 0},
+	{"networking.k8s.io/v1beta1", "Ingress", 0, 21},
+	{"networking.k8s.io/v1beta1", "IngressClass", 18, 21},
+	{"policy/v1", "PodDisruptionBudget", 21, 0},
+	{"policy/v1beta1", "PodDisruptionBudget", 0, 24},
+	{"rbac.authorization.k8s.io/v1", "ClusterRole", 0, 0},
+	{"rbac.authorization.k8s.io/v1", "ClusterRoleBinding", 0, 0},
+	{"rbac.authorization.k8s.io/v1", "Role", 0, 0},
+	{"rbac.authorization.k8s.io/v1", "RoleBinding", 0, 0},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", 0, 21},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", 0, 21},
+	{"scheduling.k8s.io/v1", "PriorityClass", 0, 0},
+	{"storage.k8s.io/v1", "StorageClass", 0, 0},
+}
+
+// KubernetesVersions are the minor versions the served apiVersions and kinds and their fields are vendored for, oldest
+// first. The fields of a version are those of k8s.io/api v0.<minor>.0.
+var KubernetesVersions = []string{"1.19", "1.20", "1.21", "1.22", "1.23", "1.24", "1.25", "1.26", "1.27"}
+
+// ServedAPIs returns the "apiVersion/Kind" strings served by the given Kubernetes minor version, e.g. "1.25".
+func ServedAPIs(kubeVersion string) []string {
+	minor := minorVersion(kubeVersion)
+	var apis []string
+	for _, api := range servedAPIs {
+		if (api.since == 0 || minor >= api.since) && (api.until == 0 || minor <= api.until) {
+			apis = append(apis, api.apiVersion+"/"+api.kind)
+		}
+	}
+	sort.Strings(apis)
+	return apis
+}
+
+// knownAPIVersions returns all apiVersions of servedAPIs, independent of the Kubernetes version.
+func knownAPIVersions() map[string]bool {
+	known := map[string]bool{}
+	for _, api := range servedAPIs {
+		known[api.apiVersion] = true
+	}
+	return known
+}
+
+func minorVersion(kubeVersion string) int {
+	parts := strings.Split(strings.TrimPrefix(kubeVersion, "v"), ".")
+	if len(parts) < 2 {
+		return 0
+	}
+	minor := 0
+	for _, c := range parts[1] {
+		if c < '0' || c > '9' {
+			break
+		}
+		minor = minor*10 + int(c-'0')
+	}
+	return minor
+}
@@ -0,0 +1,154 @@
+// Package stop removes the deployment of an app, e.g. of a branch that is deleted, which deploy.yml leaves behind:
+//
+//   - the release of the app and the PostgreSQL release, like `helm uninstall`,
+//   - optionally the Secret with the K8S_SECRET_ variables, which isn't part of a release,
+//   - optionally the PersistentVolumeClaims of both releases, which `helm uninstall` keeps if a StatefulSet, e.g. the
+//     one of PostgreSQL, created them.
+//
+// The names are derived from the app name like in package deploy; the ref changes none of them. Every ref of an app
+// is deployed to the same release, so a deployment of one ref, e.g. of a deleted branch, can only be told apart by
+// its own namespace, KUBE_NAMESPACE of its deploy job. Stop refuses to run without such a namespace, as it would
+// remove the deployment of the default branch with its Secret and data.
+package stop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/slug"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultTimeout is the time to wait for each Kubernetes operation of `helm uninstall` by default.
+const DefaultTimeout = 5 * time.Minute
+
+// Config is what to stop.
+type Config struct {
+	// AppName is the app deploy derived the names from.
+	AppName string
+	// DeriveNames uses the names of slug.Derive instead of the names of deploy.yml.
+	DeriveNames bool
+	// Namespace is the KUBE_NAMESPACE the deployment was deployed to. It is required and can't be the namespace of
+	// the derived names, the app name, which the deployments of every ref share.
+	Namespace string
+	// DeleteSecret deletes the Secret of the app.
+	DeleteSecret bool
+	// DeleteClaims deletes the PersistentVolumeClaims of the releases, with the data of the app and PostgreSQL.
+	DeleteClaims bool
+	// Timeout is the time to wait for each Kubernetes operation, DefaultTimeout if it is 0.
+	Timeout time.Duration
+}
+
+// ErrSharedNamespace is returned by Stop without a namespace or with the namespace every ref of the app is deployed
+// to by default.
+var ErrSharedNamespace = errors.New("the names of the deployment don't depend on the ref: a namespace of only this deployment is required")
+
+// Report is what was removed and what didn't exist, as kind/name, e.g. release/my-app.
+type Report struct {
+	Namespace string
+	Removed   []string
+	Missing   []string
+}
+
+// Write writes the report.
+func (r *Report) Write(w io.Writer) error {
+	for _, removed := range r.Removed {
+		if _, err := fmt.Fprintf(w, "removed %s from %s\n", removed, r.Namespace); err != nil {
+			return err
+		}
+	}
+	for _, missing := range r.Missing {
+		if _, err := fmt.Fprintf(w, "%s doesn't exist in %s\n", missing, r.Namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stopper stops deployments in a cluster.
+type Stopper struct {
+	Clientset kubernetes.Interface
+	// Helm returns the Helm configuration of a namespace.
+	Helm func(namespace string) (*action.Configuration, error)
+}
+
+// Stop removes the deployment. It continues after a resource that doesn't exist, and stops at the first error.
+func (s *Stopper) Stop(ctx context.Context, config Config) (*Report, error) {
+	names := slug.Legacy(config.AppName, "")
+	if config.DeriveNames {
+		names = slug.Derive(config.AppName, "")
+	}
+	// deploy uses the namespace of the names of either kind without KUBE_NAMESPACE
+	shared := []string{slug.Legacy(config.AppName, "").Namespace, slug.Derive(config.AppName, "").Namespace}
+	if config.Namespace == "" || config.Namespace == shared[0] || config.Namespace == shared[1] {
+		return nil, fmt.Errorf("%w, not %q", ErrSharedNamespace, names.Namespace)
+	}
+	report := &Report{Namespace: config.Namespace}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	helm, err := s.Helm(report.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{names.Release, names.PostgresRelease} {
+		// helm can't have installed a release with an invalid name, e.g. a legacy name with an underscore
+		if chartutil.ValidateReleaseName(name) != nil {
+			report.Missing = append(report.Missing, "release/"+name)
+			continue
+		}
+		uninstall := action.NewUninstall(helm)
+		uninstall.Timeout = timeout
+		_, err := uninstall.Run(name)
+		switch {
+		case errors.Is(err, driver.ErrReleaseNotFound):
+			report.Missing = append(report.Missing, "release/"+name)
+		case err != nil:
+			return report, fmt.Errorf("release %s: %w", name, err)
+		default:
+			report.Removed = append(report.Removed, "release/"+name)
+		}
+	}
+
+	if config.DeleteSecret {
+		err := s.Clientset.CoreV1().Secrets(report.Namespace).Delete(ctx, names.Secret, metav1.DeleteOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			report.Missing = append(report.Missing, "secret/"+names.Secret)
+		case err != nil:
+			return report, fmt.Errorf("secret %s: %w", names.Secret, err)
+		default:
+			report.Removed = append(report.Removed, "secret/"+names.Secret)
+		}
+	}
+
+	if config.DeleteClaims {
+		// the labels of the chart and of the PostgreSQL chart
+		selectors := []string{"release=" + names.Release, "app.kubernetes.io/instance=" + names.PostgresRelease}
+		claims := s.Clientset.CoreV1().PersistentVolumeClaims(report.Namespace)
+		for _, selector := range selectors {
+			list, err := claims.List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return report, fmt.Errorf("persistentvolumeclaims %s: %w", selector, err)
+			}
+			for _, claim := range list.Items {
+				err := claims.Delete(ctx, claim.Name, metav1.DeleteOptions{})
+				if err != nil && !apierrors.IsNotFound(err) {
+					return report, fmt.Errorf("persistentvolumeclaim %s: %w", claim.Name, err)
+				}
+				report.Removed = append(report.Removed, "persistentvolumeclaim/"+claim.Name)
+			}
+		}
+	}
+	return report, nil
+}
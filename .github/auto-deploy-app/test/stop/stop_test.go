@@ -0,0 +1,227 @@
+package stop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/clustertest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newFakeCluster(t *testing.T, namespace string, releases []string, objects ...runtime.Object) *clustertest.Cluster {
+	c := clustertest.New(objects...)
+	for _, name := range releases {
+		require.NoError(t, c.AddRelease(namespace, name))
+	}
+	return c
+}
+
+func stopper(c *clustertest.Cluster) *Stopper {
+	return &Stopper{Clientset: c.Clientset, Helm: c.Helm}
+}
+
+func claim(name, namespace string, labels map[string]string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+}
+
+func TestStopper_Stop(t *testing.T) {
+	objects := []runtime.Object{
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-app"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "review"}},
+		claim("production-auto-deploy-data", "my-app", map[string]string{"release": "my-app"}),
+		claim("data-my-app-postgres-0", "my-app", map[string]string{"app.kubernetes.io/instance": "my-app-postgres"}),
+		claim("other-app-data", "my-app", map[string]string{"release": "other-app"}),
+		claim("production-auto-deploy-data", "review", map[string]string{"release": "my-app"}),
+		claim("data-my-app-postgres-0", "review", map[string]string{"app.kubernetes.io/instance": "my-app-postgres"}),
+		claim("other-app-data", "review", map[string]string{"release": "other-app"}),
+	}
+
+	tcs := []struct {
+		name      string
+		namespace string
+		releases  []string
+		config    Config
+
+		expectedReport Report
+		expectedSecret bool
+		expectedClaims []string
+	}{
+		{
+			name:      "releases",
+			namespace: "review",
+			releases:  []string{"my-app", "my-app-postgres", "other-app"},
+			config:    Config{AppName: "my-app", Namespace: "review"},
+			expectedReport: Report{
+				Namespace: "review",
+				Removed:   []string{"release/my-app", "release/my-app-postgres"},
+			},
+			expectedSecret: true,
+			expectedClaims: []string{"data-my-app-postgres-0", "other-app-data", "production-auto-deploy-data"},
+		},
+		{
+			name:      "nothing deployed",
+			namespace: "review",
+			releases:  []string{"other-app"},
+			config:    Config{AppName: "my-app", Namespace: "review", DeleteSecret: true},
+			expectedReport: Report{
+				Namespace: "review",
+				Removed:   []string{"secret/my-app"},
+				Missing:   []string{"release/my-app", "release/my-app-postgres"},
+			},
+			expectedClaims: []string{"data-my-app-postgres-0", "other-app-data", "production-auto-deploy-data"},
+		},
+		{
+			name:      "secret and claims",
+			namespace: "review",
+			releases:  []string{"my-app"},
+			config:    Config{AppName: "my-app", Namespace: "review", DeleteSecret: true, DeleteClaims: true},
+			expectedReport: Report{
+				Namespace: "review",
+				Removed: []string{
+					"release/my-app", "secret/my-app",
+					"persistentvolumeclaim/production-auto-deploy-data", "persistentvolumeclaim/data-my-app-postgres-0",
+				},
+				Missing: []string{"release/my-app-postgres"},
+			},
+			expectedClaims: []string{"other-app-data"},
+		},
+		{
+			name:      "legacy names that can't be releases",
+			namespace: "review",
+			releases:  []string{"my-app"},
+			config:    Config{AppName: "My_App", Namespace: "review"},
+			expectedReport: Report{
+				Namespace: "review",
+				Removed:   []string{"release/my-app"},
+				Missing:   []string{"release/My_App-postgres"},
+			},
+			expectedSecret: true,
+			expectedClaims: []string{"data-my-app-postgres-0", "other-app-data", "production-auto-deploy-data"},
+		},
+		{
+			name:      "KUBE_NAMESPACE and derived names",
+			namespace: "review",
+			releases:  []string{"my-app", "my-app-postgres"},
+			config:    Config{AppName: "My_App", DeriveNames: true, Namespace: "review", DeleteSecret: true, DeleteClaims: true},
+			expectedReport: Report{
+				Namespace: "review",
+				Removed: []string{
+					"release/my-app", "release/my-app-postgres", "secret/my-app",
+					"persistentvolumeclaim/production-auto-deploy-data", "persistentvolumeclaim/data-my-app-postgres-0",
+				},
+			},
+			expectedClaims: []string{"other-app-data"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newFakeCluster(t, tc.namespace, tc.releases, objects...)
+			report, err := stopper(cluster).Stop(context.Background(), tc.config)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedReport, *report)
+
+			releases, err := cluster.Storage(tc.namespace).ListReleases()
+			require.NoError(t, err)
+			for _, rel := range releases {
+				require.NotContains(t, report.Removed, "release/"+rel.Name)
+			}
+
+			_, err = cluster.Clientset.CoreV1().Secrets(tc.namespace).Get(context.Background(), "my-app", metav1.GetOptions{})
+			require.Equal(t, tc.expectedSecret, err == nil)
+			claims, err := cluster.Clientset.CoreV1().PersistentVolumeClaims(tc.namespace).List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			var names []string
+			for _, claim := range claims.Items {
+				names = append(names, claim.Name)
+			}
+			require.Equal(t, tc.expectedClaims, names)
+		})
+	}
+}
+
+// TestStopper_Stop_Branch stops the deployment of a branch next to the one of the default branch, which is in the
+// namespace of the app and has the same names.
+func TestStopper_Stop_Branch(t *testing.T) {
+	newCluster := func(t *testing.T) *clustertest.Cluster {
+		var objects []runtime.Object
+		for _, namespace := range []string{"my-app", "my-app-feature-x"} {
+			objects = append(objects,
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: namespace}},
+				claim("production-auto-deploy-data", namespace, map[string]string{"release": "my-app"}),
+				claim("data-my-app-postgres-0", namespace, map[string]string{"app.kubernetes.io/instance": "my-app-postgres"}),
+			)
+		}
+		cluster := newFakeCluster(t, "my-app", []string{"my-app", "my-app-postgres"}, objects...)
+		require.NoError(t, cluster.AddRelease("my-app-feature-x", "my-app"))
+		require.NoError(t, cluster.AddRelease("my-app-feature-x", "my-app-postgres"))
+		return cluster
+	}
+	requireMain := func(t *testing.T, cluster *clustertest.Cluster) {
+		releases, err := cluster.Storage("my-app").ListDeployed()
+		require.NoError(t, err)
+		require.Len(t, releases, 2)
+		_, err = cluster.Clientset.CoreV1().Secrets("my-app").Get(context.Background(), "my-app", metav1.GetOptions{})
+		require.NoError(t, err)
+		claims, err := cluster.Clientset.CoreV1().PersistentVolumeClaims("my-app").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, claims.Items, 2)
+	}
+
+	t.Run("namespace of the branch", func(t *testing.T) {
+		cluster := newCluster(t)
+		report, err := stopper(cluster).Stop(context.Background(), Config{AppName: "my-app", Namespace: "my-app-feature-x", DeleteSecret: true, DeleteClaims: true})
+		require.NoError(t, err)
+		require.Len(t, report.Removed, 5)
+		requireMain(t, cluster)
+	})
+
+	for _, config := range []Config{
+		{AppName: "my-app"},
+		{AppName: "my-app", Namespace: "my-app"},
+		{AppName: "My_App", Namespace: "my-app", DeriveNames: true},
+		{AppName: "My_App", Namespace: "My_App"},
+	} {
+		t.Run("shared namespace "+config.Namespace, func(t *testing.T) {
+			config.DeleteSecret = true
+			config.DeleteClaims = true
+			cluster := newCluster(t)
+			_, err := stopper(cluster).Stop(context.Background(), config)
+			require.ErrorIs(t, err, ErrSharedNamespace)
+			requireMain(t, cluster)
+		})
+	}
+}
+
+func TestStopper_Stop_Error(t *testing.T) {
+	cluster := newFakeCluster(t, "review", []string{"my-app"})
+	cluster.Clientset.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "my-app", fmt.Errorf("no access"))
+	})
+
+	report, err := stopper(cluster).Stop(context.Background(), Config{AppName: "my-app", Namespace: "review", DeleteSecret: true, DeleteClaims: true})
+	require.EqualError(t, err, `secret my-app: secrets "my-app" is forbidden: no access`)
+	require.Equal(t, []string{"release/my-app"}, report.Removed)
+}
+
+func TestReport_Write(t *testing.T) {
+	report := Report{
+		Namespace: "review",
+		Removed:   []string{"release/my-app", "secret/my-app"},
+		Missing:   []string{"release/my-app-postgres"},
+	}
+	var out bytes.Buffer
+	require.NoError(t, report.Write(&out))
+	require.Equal(t, `removed release/my-app from review
+removed secret/my-app from review
+release/my-app-postgres doesn't exist in review
+`, out.String())
+}
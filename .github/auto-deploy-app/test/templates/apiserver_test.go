@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/apiserver"
+)
+
+// TestAPIServerValidation validates complete renderings of the key scenarios like an API server, e.g. label values,
+// resource quantities and port names, which the schemas of the resources don't check. The manifests are validated
+// in memory by apiserver.Fake, or with -apiserver applied with a dry run to a kube-apiserver started with envtest.
+func TestAPIServerValidation(t *testing.T) {
+	var validator apiserver.Validator = apiserver.Fake{}
+	if *apiServer {
+		server, err := apiserver.Start()
+		require.NoError(t, err)
+		defer func() { require.NoError(t, server.Stop()) }()
+		validator = server
+	}
+
+	for _, tc := range []struct {
+		CaseName    string
+		Release     string
+		Values      map[string]string
+		ValuesFiles []string
+
+		ExpectedProblems []string
+	}{
+		{
+			CaseName: "stable",
+			Release:  "production",
+			Values:   map[string]string{"application.track": "stable"},
+		},
+		{
+			CaseName: "canary",
+			Release:  "production-canary",
+			Values: map[string]string{
+				"application.track": "canary",
+				"releaseOverride":   "production",
+			},
+		},
+		{
+			CaseName: "autoscaling v2",
+			Release:  "production",
+			Values: map[string]string{
+				"hpa.metrics[0].type":                               "Resource",
+				"hpa.metrics[0].resource.name":                      "cpu",
+				"hpa.metrics[0].resource.target.type":               "Utilization",
+				"hpa.metrics[0].resource.target.averageUtilization": "80",
+			},
+		},
+		{
+			CaseName: "database jobs",
+			Release:  "production",
+			Values: map[string]string{
+				"application.initializeCommand": "echo initialize",
+				"application.migrateCommand":    "echo migrate",
+			},
+		},
+		{
+			CaseName:    "persistence",
+			Release:     "production",
+			ValuesFiles: []string{"../testdata/volume-mounts.yaml"},
+		},
+		{
+			CaseName:    "network policy, modsecurity and extra ports",
+			Release:     "production",
+			ValuesFiles: []string{"../testdata/custom-policy.yaml", "../testdata/modsecurity-ingress.yaml", "../testdata/service-definition.yaml"},
+		},
+		{
+			CaseName: "resource requests above the limits",
+			Release:  "production",
+			Values:   map[string]string{"resources.limits.cpu": "250m"},
+			ExpectedProblems: []string{
+				`Deployment/production: spec.template.spec.containers[0].resources.requests[cpu]: Invalid value: "500m": must be less than or equal to cpu limit`,
+				`Deployment/production-worker1: spec.template.spec.containers[0].resources.requests[cpu]: Invalid value: "500m": must be less than or equal to cpu limit`,
+				`CronJob/production-job1: spec.jobTemplate.spec.template.spec.containers[0].resources.requests[cpu]: Invalid value: "500m": must be less than or equal to cpu limit`,
+			},
+		},
+	} {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			values := map[string]string{}
+			mergeStringMap(values, integrityValues)
+			mergeStringMap(values, tc.Values)
+
+			opts := &helm.Options{
+				SetValues:   values,
+				ValuesFiles: tc.ValuesFiles,
+			}
+			output, err := renderTemplateE(t, opts, tc.Release, nil)
+			require.NoError(t, err)
+
+			problems, err := validator.Validate(context.Background(), "auto-deploy-app", output)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.ElementsMatch(t, tc.ExpectedProblems, messages, "rejected fields:\n%s", strings.Join(messages, "\n"))
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const casesPath = "../testdata/cases"
+
+// caseFile is a file of declarative test cases in testdata/cases, see "Declarative test cases" in CONTRIBUTING.md.
+type caseFile struct {
+	// Templates are rendered by every case that doesn't set its own, all templates if empty.
+	Templates []string          `yaml:"templates"`
+	Cases     []declarativeCase `yaml:"cases"`
+}
+
+type declarativeCase struct {
+	Name      string   `yaml:"name"`
+	Release   string   `yaml:"release"`
+	Templates []string `yaml:"templates"`
+	// Values are set like `helm --set`, e.g. `workers.worker1.command[0]: echo`.
+	Values map[string]string `yaml:"values"`
+	// ValuesFiles are relative to the case file.
+	ValuesFiles []string `yaml:"valuesFiles"`
+	APIVersions []string `yaml:"apiVersions"`
+
+	// ExpectedError is a regular expression matching the rendering error.
+	ExpectedError string        `yaml:"expectedError"`
+	Expect        []expectation `yaml:"expect"`
+}
+
+// expectation checks a rendered resource. Exactly one of Equals, Matches and Absent is set.
+type expectation struct {
+	// Resource is Kind/name, e.g. CronJob/production-job1.
+	Resource string `yaml:"resource"`
+	// Path is a JSONPath (https://kubernetes.io/docs/reference/kubectl/jsonpath/) in the resource,
+	// with or without the surrounding braces, e.g. .spec.schedule.
+	Path string `yaml:"path"`
+	// Equals is the expected value at the path, a list if the path matches more than one value.
+	Equals yaml.Node `yaml:"equals"`
+	// Matches is a regular expression every value at the path must match.
+	Matches string `yaml:"matches"`
+	// Absent expects the path not to be rendered or null, or the resource not to be rendered if there is no path.
+	Absent bool `yaml:"absent"`
+}
+
+func TestDeclarativeCases(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(casesPath, "*.yaml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		cases := mustLoadCases(t, file)
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".yaml"), func(t *testing.T) {
+			for _, tc := range cases.Cases {
+				tc := tc
+				t.Run(tc.Name, func(t *testing.T) {
+					mustRunDeclarativeCase(t, file, cases.Templates, tc)
+				})
+			}
+		})
+	}
+}
+
+func mustLoadCases(t *testing.T, file string) caseFile {
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	var cases caseFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	require.NoError(t, decoder.Decode(&cases), file)
+
+	names := map[string]bool{}
+	for _, tc := range cases.Cases {
+		require.NotEmptyf(t, tc.Name, "%s: every case needs a name", file)
+		require.Falsef(t, names[tc.Name], "%s: case %q is defined more than once", file, tc.Name)
+		names[tc.Name] = true
+		for _, e := range tc.Expect {
+			set := 0
+			for _, isSet := range []bool{!e.Equals.IsZero(), e.Matches != "", e.Absent} {
+				if isSet {
+					set++
+				}
+			}
+			require.Equalf(t, 1, set, "%s: case %q: %s %s needs exactly one of equals, matches and absent", file, tc.Name, e.Resource, e.Path)
+			require.Truef(t, e.Path != "" || e.Absent, "%s: case %q: %s needs a path", file, tc.Name, e.Resource)
+		}
+	}
+	return cases
+}
+
+func mustRunDeclarativeCase(t *testing.T, file string, defaultTemplates []string, tc declarativeCase) {
+	release := tc.Release
+	if release == "" {
+		release = "production"
+	}
+	templates := tc.Templates
+	if len(templates) == 0 {
+		templates = defaultTemplates
+	}
+
+	opts := &helm.Options{SetValues: tc.Values}
+	for _, valuesFile := range tc.ValuesFiles {
+		opts.ValuesFiles = append(opts.ValuesFiles, filepath.Join(filepath.Dir(file), valuesFile))
+	}
+	var helmArgs []string
+	for _, apiVersion := range tc.APIVersions {
+		helmArgs = append(helmArgs, "--api-versions", apiVersion)
+	}
+	var expectedError *regexp.Regexp
+	if tc.ExpectedError != "" {
+		expectedError = regexp.MustCompile(tc.ExpectedError)
+	}
+
+	output := mustRenderTemplate(t, opts, release, templates, expectedError, helmArgs...)
+	if expectedError != nil {
+		return
+	}
+
+	// decode strictly, the expectations are evaluated on the unstructured resources
+	mustParseObjects(t, output)
+	rendered, err := integrity.Parse(output)
+	require.NoError(t, err)
+
+	for _, e := range tc.Expect {
+		kind, name, _ := strings.Cut(e.Resource, "/")
+		obj := rendered.Get(kind, name)
+		if e.Absent && e.Path == "" {
+			require.Nilf(t, obj, "%s is rendered", e.Resource)
+			continue
+		}
+		require.NotNilf(t, obj, "%s is not rendered", e.Resource)
+
+		values, err := findJSONPath(obj.Object, e.Path)
+		if e.Absent {
+			if err != nil {
+				require.Containsf(t, err.Error(), "not found", "%s: %s", e.Resource, e.Path)
+			}
+			// an empty key is rendered as null, which the API server treats like an unset field
+			for _, value := range values {
+				require.Nilf(t, value, "%s: %s is rendered", e.Resource, e.Path)
+			}
+			continue
+		}
+		require.NoErrorf(t, err, "%s: %s", e.Resource, e.Path)
+		require.NotEmptyf(t, values, "%s: %s is not rendered", e.Resource, e.Path)
+
+		switch {
+		case e.Matches != "":
+			for _, value := range values {
+				require.Regexpf(t, e.Matches, formatJSONPathValue(value), "%s: %s", e.Resource, e.Path)
+			}
+		default:
+			var expected interface{}
+			require.NoError(t, e.Equals.Decode(&expected))
+			var actual interface{} = values
+			if len(values) == 1 {
+				actual = values[0]
+			}
+			expectedJSON, err := json.Marshal(expected)
+			require.NoError(t, err)
+			actualJSON, err := json.Marshal(actual)
+			require.NoError(t, err)
+			require.JSONEqf(t, string(expectedJSON), string(actualJSON), "%s: %s", e.Resource, e.Path)
+		}
+	}
+}
+
+// findJSONPath returns the values at the path, no values and an error if the path isn't rendered.
+func findJSONPath(obj map[string]interface{}, path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	jp := jsonpath.New("expect")
+	if err := jp.Parse(path); err != nil {
+		return nil, err
+	}
+	results, err := jp.FindResults(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	for _, result := range results {
+		for _, value := range result {
+			values = append(values, value.Interface())
+		}
+	}
+	return values, nil
+}
+
+func formatJSONPathValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/slug"
 	batchV1beta1 "k8s.io/api/batch/v1beta1"
 	coreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -87,7 +88,7 @@ func TestCronjobMeta(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, map[string]string{
@@ -126,6 +127,73 @@ func TestCronjobMeta(t *testing.T) {
 	}
 }
 
+func TestCronjobName(t *testing.T) {
+	for _, tc := range []struct {
+		CaseName string
+		Release  string
+		Values   map[string]string
+
+		ExpectedNames []string
+	}{
+		{
+			CaseName:      "release name and job name",
+			Release:       "production",
+			ExpectedNames: []string{"production-job1"},
+		},
+		{
+			CaseName:      "canary",
+			Release:       "production-canary",
+			Values:        map[string]string{"application.track": "canary", "releaseOverride": "production"},
+			ExpectedNames: []string{"production-canary-job1"},
+		},
+		{
+			// the Job controller appends an 11 character suffix to the name of the CronJob
+			CaseName:      "52 characters",
+			Release:       strings.Repeat("a", 47),
+			ExpectedNames: []string{strings.Repeat("a", 47) + "-job1"},
+		},
+		{
+			CaseName:      "cut with a hash",
+			Release:       strings.Repeat("a", 48),
+			ExpectedNames: []string{slug.Slug(strings.Repeat("a", 48)+"-job1", 52)},
+		},
+		{
+			CaseName:      "cut before a dash",
+			Release:       strings.Repeat("a", 42) + "-production",
+			ExpectedNames: []string{slug.Slug(strings.Repeat("a", 42)+"-production-job1", 52)},
+		},
+		{
+			CaseName: "long job names",
+			Release:  "review-a-long-feature-branch-name-app",
+			Values: map[string]string{
+				"cronjobs.nightly-backups-1.schedule": "0 3 * * *",
+				"cronjobs.nightly-backups-2.schedule": "0 4 * * *",
+			},
+			ExpectedNames: []string{
+				"review-a-long-feature-branch-name-app-job1",
+				slug.Slug("review-a-long-feature-branch-name-app-nightly-backups-1", 52),
+				slug.Slug("review-a-long-feature-branch-name-app-nightly-backups-2", 52),
+			},
+		},
+	} {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			values := map[string]string{"cronjobs.job1.schedule": "*/2 * * * *"}
+			mergeStringMap(values, tc.Values)
+
+			output := mustRenderTemplate(t, &helm.Options{SetValues: values}, tc.Release, []string{"templates/cronjob.yaml"}, nil)
+
+			var cronjobs batchV1beta1.CronJobList
+			mustUnmarshalStrict(t, output, &cronjobs)
+
+			var names []string
+			for _, cronjob := range cronjobs.Items {
+				names = append(names, cronjob.Name)
+			}
+			require.Equal(t, tc.ExpectedNames, names)
+		})
+	}
+}
+
 func TestCronjobSchedule(t *testing.T) {
 	for _, tc := range []struct {
 		CaseName string
@@ -164,7 +232,7 @@ func TestCronjobSchedule(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedSchedule, cronjob.Spec.Schedule)
@@ -222,7 +290,7 @@ func TestCronjobImage(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedImage, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)
@@ -438,7 +506,7 @@ func TestCronjobLivenessAndReadiness(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedLivenessProbe, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].LivenessProbe)
@@ -499,7 +567,7 @@ func TestCronjobNodeSelector(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedNodeSelector, cronjob.Spec.JobTemplate.Spec.Template.Spec.NodeSelector)
@@ -583,7 +651,7 @@ func TestCronjobTolerations(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedTolerations, cronjob.Spec.JobTemplate.Spec.Template.Spec.Tolerations)
@@ -656,7 +724,7 @@ func TestCronjobResources(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedResources, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Resources )
@@ -688,12 +756,12 @@ func TestCronjobTemplateWithVolumeMounts(t *testing.T) {
 					Name: "config-volume",
 					VolumeSource: coreV1.VolumeSource{
 						ConfigMap: &coreV1.ConfigMapVolumeSource{
-							coreV1.LocalObjectReference{
+							LocalObjectReference: coreV1.LocalObjectReference{
 								Name: "test-config",
 							},
-							[]coreV1.KeyToPath{},
-							&configMapDefaultMode,
-							&configMapOptional,
+							Items:       []coreV1.KeyToPath{},
+							DefaultMode: &configMapDefaultMode,
+							Optional:    &configMapOptional,
 						},
 					},
 				},
@@ -744,7 +812,7 @@ func TestCronjobTemplateWithVolumeMounts(t *testing.T) {
 			output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				for i, expectedVolume := range tc.expectedVolumes {
@@ -853,7 +921,7 @@ func TestCronjobAffinity(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedAffinity, cronjob.Spec.JobTemplate.Spec.Template.Spec.Affinity)
@@ -923,7 +991,7 @@ func TestCronJobTemplateWithExtraEnvFrom(t *testing.T) {
 			output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 			for _, cronjob := range cronjobs.Items {
 				require.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].EnvFrom, tc.expectedEnvFrom)
 			}
@@ -957,7 +1025,7 @@ func TestCronJobTemplateWithSecurityContext(t *testing.T) {
 			output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, *cronjob.Spec.JobTemplate.Spec.Template.Spec.SecurityContext.WindowsOptions.GMSACredentialSpecName, tc.expectedSecurityContextName)
 			}
@@ -993,7 +1061,7 @@ func TestCronJobTemplateWithContainerSecurityContext(t *testing.T) {
 			output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].SecurityContext.Capabilities.Drop, tc.expectedSecurityContextCapabilities)
 			}
@@ -1095,7 +1163,7 @@ func TestCronjobImagePullSecrets(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedImagePullSecrets, cronjob.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets)
@@ -1185,7 +1253,7 @@ func TestCronjobPodAnnotations(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/cronjob.yaml"}, nil)
 
 			var cronjobs batchV1beta1.CronJobList
-			helm.UnmarshalK8SYaml(t, output, &cronjobs)
+			mustUnmarshalStrict(t, output, &cronjobs)
 
 			for _, cronjob := range cronjobs.Items {
 				require.Equal(t, tc.ExpectedPodAnnotations, cronjob.Spec.JobTemplate.Spec.Template.ObjectMeta.Annotations)
@@ -8,6 +8,7 @@ import (
 	"github.com/gruntwork-io/terratest/modules/helm"
 	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/gruntwork-io/terratest/modules/random"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -18,6 +19,8 @@ func TestCustomResource(t *testing.T) {
 	tcs := []struct {
 		CaseName string
 		Values   map[string]string
+
+		ExpectedNames []string
 	}{
 		{
 			CaseName: "test-single-custom-resource",
@@ -26,6 +29,7 @@ func TestCustomResource(t *testing.T) {
 				"customResources[0].kind":          "IngressRoute",
 				"customResources[0].metadata.name": "ingress-route",
 			},
+			ExpectedNames: []string{"ingress-route"},
 		},
 		{
 			CaseName: "test-multiple-custom-resources",
@@ -37,6 +41,7 @@ func TestCustomResource(t *testing.T) {
 				"customResources[1].kind":          "Pod",
 				"customResources[1].metadata.name": "my-pod",
 			},
+			ExpectedNames: []string{"ingress-route", "my-pod"},
 		},
 	}
 
@@ -52,8 +57,13 @@ func TestCustomResource(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, []string{Template}, nil)
 
-			var renderedObjects *unstructured.Unstructured
-			helm.UnmarshalK8SYaml(t, output, &renderedObjects)
+			var names []string
+			for _, obj := range mustParseObjects(t, output).objects {
+				accessor, err := meta.Accessor(obj)
+				require.NoError(t, err)
+				names = append(names, accessor.GetName())
+			}
+			require.ElementsMatch(t, tc.ExpectedNames, names)
 		})
 	}
 }
@@ -91,7 +101,7 @@ func TestCustomResourceWithTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, releaseName, []string{Template}, nil)
 
 			var renderedObjects *unstructured.Unstructured
-			helm.UnmarshalK8SYaml(t, output, &renderedObjects)
+			mustUnmarshalStrict(t, output, &renderedObjects)
 
 			// Check the name of the rendered object
 			require.Equal(t, tc.expectedName, renderedObjects.GetName(), "The name of the custom resource should be %s as it is templated", tc.expectedName)
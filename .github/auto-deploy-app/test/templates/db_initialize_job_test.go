@@ -8,7 +8,7 @@ import (
 	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/stretchr/testify/require"
-	appsV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
 	coreV1 "k8s.io/api/core/v1"
 )
 
@@ -58,13 +58,13 @@ func TestInitializeDatabaseUrlEnvironmentVariable(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
 
-			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			job := new(batchV1.Job)
+			mustUnmarshalStrict(t, output, job)
 
 			if tc.ExpectedDatabaseUrl != "" {
-				require.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, coreV1.EnvVar{Name: "DATABASE_URL", Value: tc.ExpectedDatabaseUrl})
+				require.Contains(t, job.Spec.Template.Spec.Containers[0].Env, coreV1.EnvVar{Name: "DATABASE_URL", Value: tc.ExpectedDatabaseUrl})
 			} else {
-				for _, envVar := range deployment.Spec.Template.Spec.Containers[0].Env {
+				for _, envVar := range job.Spec.Template.Spec.Containers[0].Env {
 					require.NotEqual(t, "DATABASE_URL", envVar.Name)
 				}
 			}
@@ -153,10 +153,10 @@ func TestInitializeDatabaseImagePullSecrets(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
 
-			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			job := new(batchV1.Job)
+			mustUnmarshalStrict(t, output, job)
 
-			require.Equal(t, tc.ExpectedImagePullSecrets, deployment.Spec.Template.Spec.ImagePullSecrets)
+			require.Equal(t, tc.ExpectedImagePullSecrets, job.Spec.Template.Spec.ImagePullSecrets)
 		})
 	}
 }
@@ -221,12 +221,12 @@ func TestInitializeDatabaseLabels(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
 
-			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			job := new(batchV1.Job)
+			mustUnmarshalStrict(t, output, job)
 
 			for key, value := range tc.ExpectedLabels {
-				require.Equal(t, deployment.ObjectMeta.Labels[key], value)
-				require.Equal(t, deployment.Spec.Template.ObjectMeta.Labels[key], value)
+				require.Equal(t, job.ObjectMeta.Labels[key], value)
+				require.Equal(t, job.Spec.Template.ObjectMeta.Labels[key], value)
 			}
 		})
 	}
@@ -245,6 +245,7 @@ func TestInitializeDatabaseTemplateWithExtraEnvFrom(t *testing.T) {
 			name: "with extra envfrom secret test",
 			values: map[string]string{
 				"application.initializeCommand":  "echo initialize",
+				"application.secretName":         "gitlab-secretname-test",
 				"extraEnvFrom[0].secretRef.name": "secret-name-test",
 			},
 			expectedEnvFrom: coreV1.EnvFromSource{
@@ -259,6 +260,7 @@ func TestInitializeDatabaseTemplateWithExtraEnvFrom(t *testing.T) {
 			name: "test with extra env from secret using templating values",
 			values: map[string]string{
 				"application.initializeCommand":  "echo initialize",
+				"application.secretName":         "gitlab-secretname-test",
 				"extraEnvFrom[0].secretRef.name": "secret-name-{{ .Release.Name }}",
 			},
 			expectedEnvFrom: coreV1.EnvFromSource{
@@ -282,10 +284,10 @@ func TestInitializeDatabaseTemplateWithExtraEnvFrom(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, templates, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for _, deployment := range deployments.Items {
-				require.Contains(t, deployment.Spec.Template.Spec.Containers[0].EnvFrom, tc.expectedEnvFrom)
+			jobs := objectsOfType[*batchV1.Job](mustParseObjects(t, output))
+			require.Len(t, jobs, 1)
+			for _, job := range jobs {
+				require.Contains(t, job.Spec.Template.Spec.Containers[0].EnvFrom, tc.expectedEnvFrom)
 			}
 		})
 	}
@@ -325,10 +327,10 @@ func TestInitializeDatabaseTemplateWithExtraEnv(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, templates, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for _, deployment := range deployments.Items {
-				require.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, tc.expectedEnv)
+			jobs := objectsOfType[*batchV1.Job](mustParseObjects(t, output))
+			require.Len(t, jobs, 1)
+			for _, job := range jobs {
+				require.Contains(t, job.Spec.Template.Spec.Containers[0].Env, tc.expectedEnv)
 			}
 		})
 	}
@@ -96,7 +96,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			}
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedName, deployment.Name)
 			require.Equal(t, tc.ExpectedStrategyType, deployment.Spec.Strategy.Type)
@@ -174,7 +174,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedImageRepository, deployment.Spec.Template.Spec.Containers[0].Image)
 		})
@@ -226,7 +226,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedCommand, deployment.Spec.Template.Spec.Containers[0].Command)
 			require.Equal(t, tc.ExpectedArgs, deployment.Spec.Template.Spec.Containers[0].Args)
@@ -266,7 +266,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedHostNetwork, deployment.Spec.Template.Spec.HostNetwork)
 		})
@@ -344,7 +344,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedImagePullSecrets, deployment.Spec.Template.Spec.ImagePullSecrets)
 		})
@@ -414,7 +414,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedPodAnnotations, deployment.Spec.Template.ObjectMeta.Annotations)
 		})
@@ -467,7 +467,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedServiceAccountName, deployment.Spec.Template.Spec.ServiceAccountName)
 		})
@@ -530,7 +530,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedServiceAccountName, deployment.Spec.Template.Spec.ServiceAccountName)
 		})
@@ -579,7 +579,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedLifecycle, deployment.Spec.Template.Spec.Containers[0].Lifecycle)
 		})
@@ -771,7 +771,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedLivenessProbe, deployment.Spec.Template.Spec.Containers[0].LivenessProbe)
 			require.Equal(t, tc.ExpectedReadinessProbe, deployment.Spec.Template.Spec.Containers[0].ReadinessProbe)
@@ -833,7 +833,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedHostAliases, deployment.Spec.Template.Spec.HostAliases)
 		})
@@ -888,7 +888,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedDnsConfig, deployment.Spec.Template.Spec.DNSConfig)
 		})
@@ -952,7 +952,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedResources, deployment.Spec.Template.Spec.Containers[0].Resources)
 		})
@@ -1159,7 +1159,7 @@ func TestDeploymentTemplate(t *testing.T) {
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/deployment.yaml"}, nil)
 
 			var deployment appsV1.Deployment
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			require.Equal(t, tc.ExpectedName, deployment.Name)
 			require.Equal(t, map[string]string{
@@ -1236,7 +1236,7 @@ func TestServiceExtraPortServicePortDefinition(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
 			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, deployment)
+			mustUnmarshalStrict(t, output, deployment)
 			require.Equal(t, tc.expectedPorts, deployment.Spec.Template.Spec.Containers[0].Ports)
 		})
 	}
@@ -1299,12 +1299,12 @@ func TestDeploymentTemplateWithVolumeMounts(t *testing.T) {
 					Name: "config-volume",
 					VolumeSource: coreV1.VolumeSource{
 						ConfigMap: &coreV1.ConfigMapVolumeSource{
-							coreV1.LocalObjectReference{
+							LocalObjectReference: coreV1.LocalObjectReference{
 								Name: "test-config",
 							},
-							[]coreV1.KeyToPath{},
-							&configMapDefaultMode,
-							&configMapOptional,
+							Items:       []coreV1.KeyToPath{},
+							DefaultMode: &configMapDefaultMode,
+							Optional:    &configMapOptional,
 						},
 					},
 				},
@@ -1360,12 +1360,12 @@ func TestDeploymentTemplateWithVolumeMounts(t *testing.T) {
 					Name: "config-volume",
 					VolumeSource: coreV1.VolumeSource{
 						ConfigMap: &coreV1.ConfigMapVolumeSource{
-							coreV1.LocalObjectReference{
+							LocalObjectReference: coreV1.LocalObjectReference{
 								Name: "test-config",
 							},
-							[]coreV1.KeyToPath{},
-							&configMapDefaultMode,
-							&configMapOptional,
+							Items:       []coreV1.KeyToPath{},
+							DefaultMode: &configMapDefaultMode,
+							Optional:    &configMapOptional,
 						},
 					},
 				},
@@ -1393,7 +1393,7 @@ func TestDeploymentTemplateWithVolumeMounts(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
 			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, deployment)
+			mustUnmarshalStrict(t, output, deployment)
 
 			for i, expectedVolume := range tc.expectedVolumes {
 				require.Equal(t, expectedVolume.Name, deployment.Spec.Template.Spec.Volumes[i].Name)
@@ -1464,7 +1464,7 @@ func TestDeploymentDatabaseUrlEnvironmentVariable(t *testing.T) {
 			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
 
 			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, &deployment)
+			mustUnmarshalStrict(t, output, &deployment)
 
 			if tc.ExpectedDatabaseUrl != "" {
 				require.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, coreV1.EnvVar{Name: "DATABASE_URL", Value: tc.ExpectedDatabaseUrl})
@@ -1551,7 +1551,7 @@ func TestDeploymentTemplateWithExtraEnvFrom(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
 			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, deployment)
+			mustUnmarshalStrict(t, output, deployment)
 			require.Contains(t, deployment.Spec.Template.Spec.Containers[0].EnvFrom, tc.expectedEnvFrom)
 		})
 	}
@@ -1587,7 +1587,7 @@ func TestDeploymentTemplateWithExtraEnv(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
 			deployment := new(appsV1.Deployment)
-			helm.UnmarshalK8SYaml(t, output, deployment)
+			mustUnmarshalStrict(t, output, deployment)
 			require.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, tc.expectedEnv)
 		})
 	}
@@ -1620,7 +1620,7 @@ func TestDeploymentTemplateWithSecurityContext(t *testing.T) {
 
 			deployment := new(appsV1.Deployment)
 
-			helm.UnmarshalK8SYaml(t, output, deployment)
+			mustUnmarshalStrict(t, output, deployment)
 			require.Equal(t, *deployment.Spec.Template.Spec.SecurityContext.WindowsOptions.GMSACredentialSpecName, tc.expectedSecurityContextName)
 		})
 	}
@@ -1655,7 +1655,7 @@ func TestDeploymentTemplateWithContainerSecurityContext(t *testing.T) {
 
 			deployment := new(appsV1.Deployment)
 
-			helm.UnmarshalK8SYaml(t, output, deployment)
+			mustUnmarshalStrict(t, output, deployment)
 			require.Equal(t, deployment.Spec.Template.Spec.Containers[0].SecurityContext.Capabilities.Drop, tc.expectedSecurityContextCapabilities)
 		})
 	}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/apiserver"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/yamllint"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// The fuzz targets render the chart with generated release names and values and check that the output parses,
+// passes the YAML style checks and that an API server accepts the names, hosts and labels (see apiserver.Fake).
+// `go test` runs them with the seed corpus and the failing inputs in testdata/fuzz, to fuzz one of them run e.g.
+//
+//	go test ./templates -run '^$' -fuzz FuzzReleaseName -fuzztime 1m
+
+// fuzzValues enable every resource with a name derived from the release name, except the database initialization
+// job, which replaces the Deployments and CronJobs.
+var fuzzValues = map[string]interface{}{
+	"application":         map[string]interface{}{"migrateCommand": "echo migrate"},
+	"hpa":                 map[string]interface{}{"enabled": true},
+	"resources":           map[string]interface{}{"requests": map[string]interface{}{"cpu": "500m"}},
+	"podDisruptionBudget": map[string]interface{}{"enabled": true},
+	"ingress":             map[string]interface{}{"tls": map[string]interface{}{"enabled": true}},
+	"networkPolicy":       map[string]interface{}{"enabled": true},
+	"workers":             map[string]interface{}{"worker1": map[string]interface{}{"command": []string{"echo"}}},
+	"cronjobs":            map[string]interface{}{"job1": map[string]interface{}{"schedule": "*/2 * * * *"}},
+	"persistence": map[string]interface{}{
+		"enabled": true,
+		"volumes": []interface{}{map[string]interface{}{
+			"name":  "log-dir",
+			"mount": map[string]interface{}{"path": "/log"},
+			"claim": map[string]interface{}{"accessMode": "ReadWriteOnce", "size": "1Gi"},
+		}},
+	},
+}
+
+// renderFuzzed renders the chart with the values, which are merged into fuzzValues.
+func renderFuzzed(t *testing.T, releaseName string, values map[string]interface{}) (string, error) {
+	merged := chartutil.CoalesceTables(values, chartutil.Values(fuzzValues).AsMap())
+	data, err := json.Marshal(merged)
+	require.NoError(t, err)
+	valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, data, 0644))
+
+	return renderTemplateE(t, &helm.Options{ValuesFiles: []string{valuesFile}}, releaseName, nil)
+}
+
+// mustRenderFuzzed renders the chart like renderFuzzed and checks the output.
+func mustRenderFuzzed(t *testing.T, releaseName string, values map[string]interface{}) *integrity.Release {
+	output, err := renderFuzzed(t, releaseName, values)
+	require.NoError(t, err)
+
+	if problems := yamllint.Lint(output+"\n", yamllint.DefaultConfig); len(problems) > 0 {
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.String()
+		}
+		t.Fatalf("rendered template had yamllint errors:\n%s", strings.Join(messages, "\n"))
+	}
+	mustParseObjects(t, output)
+
+	problems, err := apiserver.Fake{}.Validate(context.Background(), "default", output)
+	require.NoError(t, err)
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.String()
+	}
+	require.Empty(t, messages, "rejected fields:\n%s", strings.Join(messages, "\n"))
+
+	release, err := integrity.Parse(output)
+	require.NoError(t, err)
+	return release
+}
+
+func FuzzReleaseName(f *testing.F) {
+	for _, name := range []string{
+		"production",
+		"review-feature-app",
+		"production-canary",
+		"r",
+		"on",
+		"y",
+		"null",
+		"true",
+		strings.Repeat("a", 48),
+		"review-ab-cd-ef-gh-ij-kl-mn-op-qr-st-uv-wx-yz-app",
+		"1-production",
+		"review.example",
+		"Production",
+		"",
+	} {
+		f.Add(name, false, false)
+		f.Add(name, true, false)
+		f.Add(name, false, true)
+	}
+
+	f.Fuzz(func(t *testing.T, releaseName string, canary, initialize bool) {
+		application := map[string]interface{}{}
+		if canary {
+			application["track"] = "canary"
+		}
+		if initialize {
+			application["initializeCommand"] = "echo initialize"
+		}
+		values := map[string]interface{}{"application": application}
+
+		if err := chartutil.ValidateReleaseName(releaseName); err != nil {
+			_, err := renderFuzzed(t, releaseName, values)
+			require.Error(t, err, "helm rejects the release name: %s", err)
+			return
+		}
+		// the Service name of the fullname helper
+		serviceName := releaseName + "-auto-deploy"
+		if len(serviceName) > 63 {
+			serviceName = strings.TrimSuffix(serviceName[:63], "-")
+		}
+		if len(validation.IsDNS1035Label(serviceName)) > 0 {
+			t.Skip("the API server rejects the Service name, it has to be a DNS-1035 label, e.g. start with a letter")
+		}
+		mustRenderFuzzed(t, releaseName, values)
+	})
+}
+
+func FuzzServiceURL(f *testing.F) {
+	for _, serviceURL := range []string{
+		"http://example.com",
+		"https://example.com/",
+		"example.com",
+		" https://example.com ",
+		"https://example.com:8443",
+		"https://example.com/app/",
+		"https://user@example.com:8443/app?query#fragment",
+		"HTTPS://Example.COM",
+		"A0",
+	} {
+		f.Add(serviceURL)
+	}
+
+	f.Fuzz(func(t *testing.T, serviceURL string) {
+		host, ok := urlHost(serviceURL)
+		if !ok {
+			t.Skip("not an URL with a DNS name")
+		}
+		release := mustRenderFuzzed(t, "production", map[string]interface{}{
+			"service": map[string]interface{}{"url": serviceURL},
+		})
+
+		ingress := release.Get("Ingress", "production-auto-deploy")
+		require.NotNil(t, ingress)
+		rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+		require.Equal(t, host, rules[0].(map[string]interface{})["host"])
+	})
+}
+
+func FuzzAdditionalHosts(f *testing.F) {
+	f.Add("additional.example.com", "other.example.com")
+	f.Add("https://additional.example.com/", "*.example.com")
+	f.Add("additional.example.com:8080", "ADDITIONAL.example.com")
+
+	f.Fuzz(func(t *testing.T, first, second string) {
+		hosts := []string{first, second}
+		for _, host := range hosts {
+			if _, ok := urlHost(host); !ok {
+				t.Skip("not a host with a DNS name")
+			}
+		}
+		release := mustRenderFuzzed(t, "production", map[string]interface{}{
+			"service": map[string]interface{}{"additionalHosts": hosts},
+		})
+
+		ingress := release.Get("Ingress", "production-auto-deploy")
+		require.NotNil(t, ingress)
+		rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+		require.Len(t, rules, 3)
+	})
+}
+
+// secRuleVariable are the ModSecurity variables the chart can render, printable ASCII without spaces, because they
+// are not quoted.
+var secRuleVariable = regexp.MustCompile(`^[!-~]+$`)
+
+func FuzzModSecurityRules(f *testing.F) {
+	f.Add("REQUEST_HEADERS:User-Agent", "scanner", "log,deny,id:107,status:403,msg:'Scanner Identified'")
+	f.Add("REQUEST_HEADERS:Content-Type", "text/plain", `log,deny,id:'20010',status:403,msg:"Text plain not allowed"`)
+	f.Add("ARGS", `@rx <script>`, "deny,msg:'a \\' quote'")
+	f.Add("ARGS", "@rx \\d+\n", "deny,\tstatus:403")
+
+	f.Fuzz(func(t *testing.T, variable, operator, action string) {
+		if !secRuleVariable.MatchString(variable) {
+			t.Skip("not a ModSecurity variable")
+		}
+		if !utf8.ValidString(operator) || !utf8.ValidString(action) {
+			t.Skip("values are UTF-8")
+		}
+		release := mustRenderFuzzed(t, "production", map[string]interface{}{
+			"ingress": map[string]interface{}{"modSecurity": map[string]interface{}{
+				"enabled":  true,
+				"secRules": []interface{}{map[string]interface{}{"variable": variable, "operator": operator, "action": action}},
+			}},
+		})
+
+		ingress := release.Get("Ingress", "production-auto-deploy")
+		require.NotNil(t, ingress)
+		snippet := strings.Split(strings.TrimSuffix(ingress.GetAnnotations()["nginx.ingress.kubernetes.io/modsecurity-snippet"], "\n"), "\n")
+		require.Len(t, snippet, 2, "every rule is one line")
+		rule, err := parseSecRule(snippet[1])
+		require.NoError(t, err)
+		require.Equal(t, secRule{Variable: variable, Operator: operator, Action: action}, rule)
+	})
+}
+
+type secRule struct {
+	Variable, Operator, Action string
+}
+
+// parseSecRule parses a rule of the secrule helper: it unescapes the quotes of the operator and action and unquotes
+// them like strconv.Unquote, because the helper quotes them with the quote function, which uses Go syntax.
+func parseSecRule(line string) (secRule, error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 || fields[0] != "SecRule" {
+		return secRule{}, fmt.Errorf("not a SecRule: %s", line)
+	}
+	rule := secRule{Variable: fields[1]}
+	arguments := strings.ReplaceAll(strings.ReplaceAll(fields[2], `\'`, `'`), `\"`, `"`)
+	operator, err := strconv.QuotedPrefix(arguments)
+	if err != nil {
+		return secRule{}, fmt.Errorf("operator of %s: %w", line, err)
+	}
+	action := strings.TrimPrefix(arguments[len(operator):], " ")
+	if len(action) != len(arguments)-len(operator)-1 {
+		return secRule{}, fmt.Errorf("no space after the operator of %s", line)
+	}
+	if rule.Operator, err = strconv.Unquote(operator); err != nil {
+		return secRule{}, fmt.Errorf("operator of %s: %w", line, err)
+	}
+	if rule.Action, err = strconv.Unquote(action); err != nil {
+		return secRule{}, fmt.Errorf("action of %s: %w", line, err)
+	}
+	return rule, nil
+}
+
+// urlHost returns the host of a service URL or host the way the chart's hostname helper does, ok is false unless
+// it is a DNS name, optionally with a scheme, port and path.
+func urlHost(value string) (host string, ok bool) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+	host = strings.ToLower(u.Hostname())
+	if strings.HasPrefix(host, "*.") {
+		return host, len(validation.IsWildcardDNS1123Subdomain(host)) == 0
+	}
+	return host, len(validation.IsDNS1123Subdomain(host)) == 0
+}
@@ -79,7 +79,7 @@ func TestHPA_AutoscalingV1(t *testing.T) {
             }
 
 			hpa := new(autoscalingV1.HorizontalPodAutoscaler)
-			helm.UnmarshalK8SYaml(t, output, hpa)
+			mustUnmarshalStrict(t, output, hpa)
 			require.Equal(t, tc.expectedName, hpa.ObjectMeta.Name)
 			require.Equal(t, tc.expectedMinReplicas, *hpa.Spec.MinReplicas)
 			require.Equal(t, tc.expectedMaxReplicas, hpa.Spec.MaxReplicas)
@@ -148,7 +148,7 @@ resources:
             }
 
 			hpa := new(autoscalingV2.HorizontalPodAutoscaler)
-			helm.UnmarshalK8SYaml(t, output, hpa)
+			mustUnmarshalStrict(t, output, hpa)
 			require.Equal(t, tc.expectedName, hpa.ObjectMeta.Name)
 			require.Equal(t, tc.expectedMinReplicas, *hpa.Spec.MinReplicas)
 			require.Equal(t, tc.expectedMaxReplicas, hpa.Spec.MaxReplicas)
@@ -156,3 +156,52 @@ resources:
 		})
 	}
 }
+
+func TestHPA_ScaleTargetRef(t *testing.T) {
+	templates := []string{"templates/hpa.yaml"}
+
+	tcs := []struct {
+		name        string
+		releaseName string
+		values      map[string]string
+
+		expectedTarget string
+	}{
+		{
+			name:           "stable track",
+			releaseName:    "production",
+			expectedTarget: "production",
+		},
+		{
+			name:           "canary track",
+			releaseName:    "production-canary",
+			values:         map[string]string{"application.track": "canary"},
+			expectedTarget: "production-canary-canary",
+		},
+		{
+			name:           "canary track with releaseOverride",
+			releaseName:    "production-canary",
+			values:         map[string]string{"application.track": "canary", "releaseOverride": "production"},
+			expectedTarget: "production-canary",
+		},
+		{
+			name:           "stable track with releaseOverride",
+			releaseName:    "production-stable",
+			values:         map[string]string{"releaseOverride": "production"},
+			expectedTarget: "production",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			values := map[string]string{"hpa.enabled": "true", "resources.requests.cpu": "500m"}
+			mergeStringMap(values, tc.values)
+			output := mustRenderTemplate(t, &helm.Options{SetValues: values}, tc.releaseName, templates, nil)
+
+			hpa := new(autoscalingV1.HorizontalPodAutoscaler)
+			mustUnmarshalStrict(t, output, hpa)
+			require.Equal(t, "Deployment", hpa.Spec.ScaleTargetRef.Kind)
+			require.Equal(t, tc.expectedTarget, hpa.Spec.ScaleTargetRef.Name)
+		})
+	}
+}
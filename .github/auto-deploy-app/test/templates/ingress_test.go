@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"regexp"
 	"testing"
 
@@ -64,8 +65,7 @@ SecRule REQUEST_HEADERS:Content-Type \"text/plain\" \"log,deny,id:\'20010\',stat
 			}
 			output := mustRenderTemplate(t, opts, "modsecurity-test-release", templates, nil)
 
-			ingress := new(extensions.Ingress)
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			ingress := mustUnmarshalIngress(t, output)
 
 			require.Equal(t, tc.meta.Annotations, ingress.ObjectMeta.Annotations)
 		})
@@ -117,8 +117,7 @@ func TestIngressTemplate_DifferentTracks(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, tc.releaseName, templates, tc.expectedErrorRegexp)
 
-			ingress := new(extensions.Ingress)
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			ingress := mustUnmarshalIngress(t, output)
 			require.Equal(t, tc.expectedName, ingress.ObjectMeta.Name)
 			for key, value := range tc.expectedAnnotations {
 				require.Equal(t, ingress.ObjectMeta.Annotations[key], value)
@@ -138,14 +137,14 @@ func TestIngressTemplate_TLS(t *testing.T) {
 		values map[string]string
 
 		expectedAnnotations map[string]string
-		expectedIngressTLS  []extensions.IngressTLS
+		expectedIngressTLS  []networkingv1.IngressTLS
 		expectedErrorRegexp *regexp.Regexp
 	}{
 		{
 			name:                "defaults",
 			expectedAnnotations: map[string]string{"kubernetes.io/ingress.class": "nginx", "kubernetes.io/tls-acme": "true"},
-			expectedIngressTLS: []extensions.IngressTLS{
-				extensions.IngressTLS{
+			expectedIngressTLS: []networkingv1.IngressTLS{
+				networkingv1.IngressTLS{
 					Hosts:      []string{"my.host.com"},
 					SecretName: releaseName + "-auto-deploy-tls",
 				},
@@ -155,7 +154,7 @@ func TestIngressTemplate_TLS(t *testing.T) {
 			name:                "with tls disabled",
 			values:              map[string]string{"ingress.tls.enabled": "false"},
 			expectedAnnotations: map[string]string{"kubernetes.io/ingress.class": "nginx"},
-			expectedIngressTLS:  []extensions.IngressTLS(nil),
+			expectedIngressTLS:  []networkingv1.IngressTLS(nil),
 		},
 	}
 
@@ -166,14 +165,86 @@ func TestIngressTemplate_TLS(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
 
-			ingress := new(extensions.Ingress)
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			ingress := mustUnmarshalIngress(t, output)
 			require.Equal(t, tc.expectedAnnotations, ingress.ObjectMeta.Annotations)
 			require.Equal(t, tc.expectedIngressTLS, ingress.Spec.TLS)
 		})
 	}
 }
 
+func TestIngressTemplate_Hosts(t *testing.T) {
+	templates := []string{"templates/ingress.yaml"}
+	releaseName := "ingress-hosts-test"
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedHosts []string
+	}{
+		{
+			name:          "defaults",
+			expectedHosts: []string{"my.host.com"},
+		},
+		{
+			name:          "without scheme",
+			values:        map[string]string{"service.url": "example.com"},
+			expectedHosts: []string{"example.com"},
+		},
+		{
+			name:          "with spaces",
+			values:        map[string]string{"service.url": " https://example.com "},
+			expectedHosts: []string{"example.com"},
+		},
+		{
+			name:          "with port",
+			values:        map[string]string{"service.url": "https://example.com:8443"},
+			expectedHosts: []string{"example.com"},
+		},
+		{
+			name:          "with path",
+			values:        map[string]string{"service.url": "https://example.com/app/"},
+			expectedHosts: []string{"example.com"},
+		},
+		{
+			name:          "with user, port, query and fragment",
+			values:        map[string]string{"service.url": "https://user@example.com:8443/app?query#fragment"},
+			expectedHosts: []string{"example.com"},
+		},
+		{
+			name:          "upper case",
+			values:        map[string]string{"service.url": "HTTPS://Example.COM"},
+			expectedHosts: []string{"example.com"},
+		},
+		{
+			name: "common name and additional hosts",
+			values: map[string]string{
+				"service.commonName":         "Common.example.com",
+				"service.additionalHosts[0]": "additional.example.com:8080",
+				"service.additionalHosts[1]": "https://other.example.com/",
+			},
+			expectedHosts: []string{"my.host.com", "common.example.com", "additional.example.com", "other.example.com"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				SetValues: tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
+
+			ingress := mustUnmarshalIngress(t, output)
+			var hosts []string
+			for _, rule := range ingress.Spec.Rules {
+				hosts = append(hosts, rule.Host)
+			}
+			require.Equal(t, tc.expectedHosts, hosts)
+			require.Len(t, ingress.Spec.TLS, 1)
+			require.ElementsMatch(t, tc.expectedHosts, ingress.Spec.TLS[0].Hosts)
+		})
+	}
+}
+
 func TestIngressTemplate_Disable(t *testing.T) {
 	templates := []string{"templates/ingress.yaml"}
 	releaseName := "ingress-disable-test"
@@ -231,8 +302,7 @@ func TestIngressTemplate_Disable(t *testing.T) {
 				return
             }
 
-			ingress := new(extensions.Ingress)
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			ingress := mustUnmarshalIngress(t, output)
 			require.Equal(t, tc.expectedName, ingress.ObjectMeta.Name)
 		})
 	}
@@ -270,9 +340,7 @@ func TestIngressTemplate_HTTPPath(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
-			ingress := new(extensions.Ingress)
-
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			ingress := mustUnmarshalIngress(t, output)
 			require.Equal(t, tc.expectedpath, ingress.Spec.Rules[0].IngressRuleValue.HTTP.Paths[0].Path)
 		})
 	}
@@ -310,9 +378,7 @@ func TestIngressTemplate_TLSSecret(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
-			ingress := new(extensions.Ingress)
-
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			ingress := mustUnmarshalIngress(t, output)
 			require.Equal(t, tc.expectedsecretname, ingress.Spec.TLS[0].SecretName)
 		})
 	}
@@ -345,7 +411,7 @@ func TestIngressTemplate_NetworkingV1Beta1(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil, "--api-versions", "networking.k8s.io/v1beta1/Ingress")
 			ingress := new(networkingv1beta.Ingress)
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			mustUnmarshalStrict(t, output, ingress)
 			require.Equal(t, "networking.k8s.io/v1beta1", ingress.APIVersion)
 			require.Equal(t, tc.expectedIngressClassAnnotation, ingress.Annotations["kubernetes.io/ingress.class"])
 		})
@@ -381,7 +447,7 @@ func TestIngressTemplate_NetworkingV1(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil, "--api-versions", "networking.k8s.io/v1/Ingress")
 			ingress := new(networkingv1.Ingress)
-			helm.UnmarshalK8SYaml(t, output, ingress)
+			mustUnmarshalStrict(t, output, ingress)
 			require.Equal(t, "networking.k8s.io/v1", ingress.APIVersion)
 			if tc.expectedIngressClassName == "" {
 				require.Nil(t, ingress.Spec.IngressClassName)
@@ -401,7 +467,30 @@ func TestIngressTemplate_Extensions(t *testing.T) {
 	}
 	output := mustRenderTemplate(t, opts, releaseName, templates, nil, "--api-versions", "extensions/v1beta1/Ingress")
 	ingress := new(extensions.Ingress)
-	helm.UnmarshalK8SYaml(t, output, ingress)
+	mustUnmarshalStrict(t, output, ingress)
 	require.Equal(t, "extensions/v1beta1", ingress.APIVersion)
 	require.Equal(t, "nginx", ingress.Annotations["kubernetes.io/ingress.class"])
 }
+
+// mustUnmarshalIngress decodes the rendered Ingress strictly into the type of its apiVersion, which depends on the
+// API versions it is rendered with (see -kube-version), and returns the fields all versions share, the metadata,
+// the TLS hosts and the rule paths, as a networking.k8s.io/v1 Ingress.
+func mustUnmarshalIngress(t *testing.T, output string) *networkingv1.Ingress {
+	var typed interface{}
+	switch apiVersion := regexp.MustCompile(`(?m)^apiVersion: (.+)$`).FindStringSubmatch(output); {
+	case apiVersion == nil || apiVersion[1] == "extensions/v1beta1":
+		typed = new(extensions.Ingress)
+	case apiVersion[1] == "networking.k8s.io/v1beta1":
+		typed = new(networkingv1beta.Ingress)
+	default:
+		typed = new(networkingv1.Ingress)
+	}
+	mustUnmarshalStrict(t, output, typed)
+
+	data, err := json.Marshal(typed)
+	require.NoError(t, err)
+	ingress := new(networkingv1.Ingress)
+	// the backends differ between the versions
+	require.NoError(t, json.Unmarshal(data, ingress))
+	return ingress
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+)
+
+// integrityValues enable every resource that references another one.
+var integrityValues = map[string]string{
+	"gitlab.app":                           "auto-devops-examples/minimal-ruby-app",
+	"gitlab.env":                           "prod",
+	"hpa.enabled":                          "true",
+	"resources.requests.cpu":               "500m",
+	"podDisruptionBudget.enabled":          "true",
+	"ingress.tls.enabled":                  "true",
+	"service.commonName":                   "common.example.com",
+	"service.additionalHosts[0]":           "additional.example.com",
+	"roles.reader.rules[0].verbs[0]":       "get",
+	"roles.reader.rules[0].apiGroups[0]":   "",
+	"roles.reader.rules[0].resources[0]":   "pods",
+	"roleBindings.reader.roleRefName":      "reader",
+	"roleBindings.reader.subjects[0].kind": "ServiceAccount",
+	"roleBindings.reader.subjects[0].name": "default",
+	"workers.worker1.command[0]":           "echo",
+	"cronjobs.job1.schedule":               "*/2 * * * *",
+}
+
+func TestReleaseIntegrity(t *testing.T) {
+	for _, tc := range []struct {
+		CaseName    string
+		Release     string
+		Values      map[string]string
+		ValuesFiles []string
+		HelmArgs    []string
+
+		ExpectedProblems []string
+		// ExpectedLintProblems are the YAML style problems of a rendering that doesn't parse as expected
+		ExpectedLintProblems []string
+	}{
+		{
+			CaseName: "stable",
+			Release:  "production",
+			Values:   map[string]string{"application.track": "stable"},
+		},
+		{
+			CaseName: "canary",
+			Release:  "production-canary",
+			Values: map[string]string{
+				"application.track": "canary",
+				"releaseOverride":   "production",
+			},
+		},
+		{
+			CaseName: "autoscaling v2",
+			Release:  "production",
+			Values: map[string]string{
+				"hpa.metrics[0].type":                               "Resource",
+				"hpa.metrics[0].resource.name":                      "cpu",
+				"hpa.metrics[0].resource.target.type":               "Utilization",
+				"hpa.metrics[0].resource.target.averageUtilization": "80",
+			},
+		},
+		{
+			CaseName: "networking v1 ingress",
+			Release:  "production",
+			Values:   map[string]string{"service.externalPort": "8080"},
+			HelmArgs: []string{"--api-versions", "networking.k8s.io/v1/Ingress"},
+		},
+		{
+			CaseName: "networking v1beta1 ingress",
+			Release:  "production",
+			HelmArgs: []string{"--api-versions", "networking.k8s.io/v1beta1/Ingress"},
+		},
+		{
+			CaseName:    "persistence",
+			Release:     "production",
+			ValuesFiles: []string{"../testdata/volume-mounts.yaml"},
+		},
+		{
+			CaseName: "role binding to a role that is not rendered",
+			Release:  "production",
+			Values:   map[string]string{"roleBindings.reader.roleRefName": "writer"},
+			ExpectedProblems: []string{
+				`RoleBinding/reader: roleRef: Role "writer" is not rendered (rendered: reader)`,
+			},
+		},
+		{
+			// sharedlabels renders the extra labels after the built-in ones, so app is a duplicate key
+			CaseName: "extra label overriding the app label",
+			Release:  "production",
+			Values:   map[string]string{"extraLabels.app": "other"},
+			ExpectedLintProblems: []string{
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+				`duplication of key "app" in mapping (key-duplicates)`,
+			},
+		},
+	} {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			values := map[string]string{}
+			mergeStringMap(values, integrityValues)
+			mergeStringMap(values, tc.Values)
+
+			opts := &helm.Options{
+				SetValues:   values,
+				ValuesFiles: tc.ValuesFiles,
+			}
+			if tc.ExpectedLintProblems != nil {
+				require.Equal(t, tc.ExpectedLintProblems, mustRenderLintProblems(t, opts, tc.Release, nil, tc.HelmArgs...))
+				return
+			}
+			output := mustRenderTemplate(t, opts, tc.Release, nil, nil, tc.HelmArgs...)
+
+			problems, err := integrity.Check(output)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.ElementsMatch(t, tc.ExpectedProblems, messages, "broken references:\n%s", strings.Join(messages, "\n"))
+		})
+	}
+}
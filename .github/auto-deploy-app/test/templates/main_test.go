@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain checks for unused golden files and writes the values coverage reports after the tests,
+// see checkGoldenFiles and writeValuesCoverage.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	// only a complete, passing run renders every golden file
+	if code == 0 && *kubeVersion == "" && flag.Lookup("test.run").Value.String() == "" {
+		if err := checkGoldenFiles(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	if *valuesCoverageText != "" || *valuesCoverageJSON != "" {
+		if err := writeValuesCoverage(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write the values coverage: %s\n", err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
@@ -111,7 +111,7 @@ func TestNetworkPolicy(t *testing.T) {
             }
 			
 			policy := new(netV1.NetworkPolicy)
-			helm.UnmarshalK8SYaml(t, output, policy)
+			mustUnmarshalStrict(t, output, policy)
 
 			require.Equal(t, tc.meta, policy.ObjectMeta)
 			require.Equal(t, tc.podSelector, policy.Spec.PodSelector)
@@ -65,7 +65,7 @@ func TestPdbTemplate(t *testing.T) {
             }
 			
 			var podDisruptionBudget v1beta1.PodDisruptionBudget
-			helm.UnmarshalK8SYaml(t, output, &podDisruptionBudget)
+			mustUnmarshalStrict(t, output, &podDisruptionBudget)
 
 			require.Equal(t, tc.ExpectedName, podDisruptionBudget.Name)
 			require.Equal(t, tc.ExpectedSelector, podDisruptionBudget.Spec.Selector)
@@ -2,7 +2,6 @@ package main
 
 import (
 	"regexp"
-	"strings"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/helm"
@@ -80,7 +79,7 @@ func TestPvcTemplate_Single(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
 
 			pvc := new(coreV1.PersistentVolumeClaim)
-			helm.UnmarshalK8SYaml(t, output, pvc)
+			mustUnmarshalStrict(t, output, pvc)
 
 			require.Equal(t, tc.expectedMeta, pvc.ObjectMeta)
 			require.Equal(t, tc.expectedPVC.AccessModes, pvc.Spec.AccessModes)
@@ -157,10 +156,9 @@ func TestPvcTemplate_Multiple(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
 
-			pvcList := strings.Split(output, "---")
-			for i, pvcOutput := range pvcList[1:] {
-				pvc := new(coreV1.PersistentVolumeClaim)
-				helm.UnmarshalK8SYaml(t, pvcOutput, pvc)
+			pvcs := objectsOfType[*coreV1.PersistentVolumeClaim](mustParseObjects(t, output))
+			require.Len(t, pvcs, len(tc.expectedPVCs))
+			for i, pvc := range pvcs {
 
 				require.Equal(t, tc.expectedPVCs[i].AccessModes, pvc.Spec.AccessModes)
 				require.Equal(t, tc.expectedPVCs[i].Resources.Requests["storage"], pvc.Spec.Resources.Requests["storage"])
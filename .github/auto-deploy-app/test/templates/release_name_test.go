@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+)
+
+// TestReleaseNameLabels renders every resource for release names YAML reads as another type than a string unless they
+// are quoted, e.g. `on` is a bool, and checks that the labels, selectors and names are still the release name.
+func TestReleaseNameLabels(t *testing.T) {
+	for _, tc := range []struct {
+		CaseName string
+		Release  string
+		Values   map[string]string
+
+		ExpectedNames map[string]string
+	}{
+		{
+			CaseName:      "string",
+			Release:       "production",
+			ExpectedNames: map[string]string{"Deployment": "production", "PostgreSQLInstance": "production"},
+		},
+		{
+			CaseName:      "bool",
+			Release:       "on",
+			ExpectedNames: map[string]string{"Deployment": "on", "PostgreSQLInstance": "on"},
+		},
+		{
+			CaseName:      "true",
+			Release:       "true",
+			ExpectedNames: map[string]string{"Deployment": "true", "PostgreSQLInstance": "true"},
+		},
+		{
+			CaseName:      "null",
+			Release:       "null",
+			ExpectedNames: map[string]string{"Deployment": "null", "PostgreSQLInstance": "null"},
+		},
+		{
+			CaseName:      "releaseOverride",
+			Release:       "production",
+			Values:        map[string]string{"releaseOverride": "yes"},
+			ExpectedNames: map[string]string{"Deployment": "yes", "PostgreSQLInstance": "yes"},
+		},
+	} {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			values := map[string]string{"postgresql.managed": "true"}
+			mergeStringMap(values, integrityValues)
+			mergeStringMap(values, tc.Values)
+			output := mustRenderTemplate(t, &helm.Options{SetValues: values}, tc.Release, nil, nil)
+
+			release, err := integrity.Parse(output)
+			require.NoError(t, err)
+			for kind, name := range tc.ExpectedNames {
+				require.NotNil(t, release.Get(kind, name), "%s %q is not rendered", kind, name)
+			}
+
+			appName := tc.Values["releaseOverride"]
+			if appName == "" {
+				appName = tc.Release
+			}
+			expected := map[string]string{
+				"app":                        appName,
+				"app.kubernetes.io/name":     appName,
+				"release":                    tc.Release,
+				"app.kubernetes.io/instance": tc.Release,
+			}
+			var mismatches []string
+			for _, obj := range release.Objects() {
+				for _, mismatch := range releaseNameMismatches(obj.Object, expected, "") {
+					mismatches = append(mismatches, fmt.Sprintf("%s/%s: %s", obj.GetKind(), obj.GetName(), mismatch))
+				}
+			}
+			require.Empty(t, mismatches)
+		})
+	}
+}
+
+// releaseNameMismatches returns the paths of the labels and selectors in value whose value isn't the string expected
+// for their key.
+func releaseNameMismatches(value interface{}, expected map[string]string, path string) []string {
+	var mismatches []string
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if name, ok := expected[key]; ok {
+				if field != name {
+					mismatches = append(mismatches, fmt.Sprintf("%s.%s is %#v", path, key, field))
+				}
+				continue
+			}
+			mismatches = append(mismatches, releaseNameMismatches(field, expected, path+"."+key)...)
+		}
+	case []interface{}:
+		for i, item := range value {
+			mismatches = append(mismatches, releaseNameMismatches(item, expected, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return mismatches
+}
@@ -210,13 +210,13 @@ func TestRoleTemplate(t *testing.T) {
 			}
 
 			var list coreV1.List
-			helm.UnmarshalK8SYaml(t, output, &list)
+			mustUnmarshalStrict(t, output, &list)
 
 			require.Equal(t, len(tc.ExpectedRoles), len(list.Items))
 
 			for i, expectedRole := range tc.ExpectedRoles {
 				var role rbacV1.Role
-				helm.UnmarshalK8SYaml(t, string(list.Items[i].Raw), &role)
+				mustUnmarshalStrict(t, string(list.Items[i].Raw), &role)
 
 				require.Equal(t, expectedRole.Name, role.Name)
 				require.Equal(t, expectedRole.Rules, role.Rules)
@@ -236,13 +236,13 @@ func TestRoleBindingTemplate(t *testing.T) {
 			}
 
 			var list coreV1.List
-			helm.UnmarshalK8SYaml(t, output, &list)
+			mustUnmarshalStrict(t, output, &list)
 
 			require.Equal(t, len(tc.ExpectedRoleBindings), len(list.Items))
 
 			for i, expectedRoleBinding := range tc.ExpectedRoleBindings {
 				var roleBinding rbacV1.RoleBinding
-				helm.UnmarshalK8SYaml(t, string(list.Items[i].Raw), &roleBinding)
+				mustUnmarshalStrict(t, string(list.Items[i].Raw), &roleBinding)
 
 				require.Equal(t, expectedRoleBinding.Name, roleBinding.Name)
 				require.Equal(t, expectedRoleBinding.RoleRef, roleBinding.RoleRef)
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+)
+
+var selectorTemplates = []string{
+	"templates/deployment.yaml",
+	"templates/worker-deployment.yaml",
+	"templates/cronjob.yaml",
+	"templates/service.yaml",
+	"templates/pdb.yaml",
+	"templates/network-policy.yaml",
+}
+
+// selectorValues render every resource with a pod template or a pod selector.
+var selectorValues = map[string]string{
+	"workers.worker1.command[0]":  "echo",
+	"cronjobs.job1.schedule":      "*/2 * * * *",
+	"podDisruptionBudget.enabled": "true",
+	"networkPolicy.enabled":       "true",
+}
+
+// TestServiceSelectors renders the stable and the canary release of every combination of tiers, releaseOverride and
+// extraLabels into one namespace and checks that each Service selects the pods of its own web Deployment only.
+func TestServiceSelectors(t *testing.T) {
+	tiers := []string{"web", "api", "worker"}
+	releaseOverrides := []string{"", "shop"}
+	extraLabels := map[string]map[string]string{
+		"no extra labels": nil,
+		"team label":      {"extraLabels.team": "backend"},
+		"part-of label":   {"extraLabels.app\\.kubernetes\\.io/part-of": "shop"},
+	}
+
+	for _, tier := range tiers {
+		for _, releaseOverride := range releaseOverrides {
+			for labelsName, labels := range extraLabels {
+				values := map[string]string{
+					"application.tier": tier,
+					"releaseOverride":  releaseOverride,
+				}
+				mergeStringMap(values, labels)
+
+				name := fmt.Sprintf("%s tier, release name", tier)
+				if releaseOverride != "" {
+					name = fmt.Sprintf("%s tier, releaseOverride %s", tier, releaseOverride)
+				}
+				t.Run(name+", "+labelsName, func(t *testing.T) {
+					mustSelectOwnPods(t, values, nil)
+				})
+			}
+		}
+	}
+}
+
+func TestServiceSelectors_Problems(t *testing.T) {
+	for _, tc := range []struct {
+		CaseName string
+		Values   map[string]string
+
+		ExpectedProblems []string
+		// ExpectedLintProblems are the YAML style problems of the stable release if it doesn't parse as expected
+		ExpectedLintProblems []string
+	}{
+		{
+			CaseName: "tier of the cronjob pods",
+			Values:   map[string]string{"application.tier": "cronjob"},
+			ExpectedProblems: []string{
+				"Service/production-auto-deploy: spec.selector: app=production,tier=cronjob,track=stable selects the pods of more than one workload: Deployment/production, CronJob/production-job1",
+				"Service/production-canary-auto-deploy: spec.selector: app=production,tier=cronjob,track=canary selects the pods of more than one workload: Deployment/production-canary, CronJob/production-canary-job1",
+			},
+		},
+		{
+			// the Deployment renders the extra labels after its tier label, so tier is a duplicate key
+			CaseName: "extra label overriding the tier",
+			Values:   map[string]string{"extraLabels.tier": "frontend"},
+			ExpectedLintProblems: []string{
+				`duplication of key "tier" in mapping (key-duplicates)`,
+				`duplication of key "tier" in mapping (key-duplicates)`,
+				`duplication of key "tier" in mapping (key-duplicates)`,
+			},
+		},
+	} {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			if tc.ExpectedLintProblems != nil {
+				values := map[string]string{}
+				mergeStringMap(values, selectorValues)
+				mergeStringMap(values, tc.Values)
+				problems := mustRenderLintProblems(t, &helm.Options{SetValues: values}, "production", selectorTemplates)
+				require.Equal(t, tc.ExpectedLintProblems, problems)
+				return
+			}
+			mustSelectOwnPods(t, tc.Values, tc.ExpectedProblems)
+		})
+	}
+}
+
+// mustSelectOwnPods renders the stable release "production" and the canary release "production-canary" with the values
+// and compares the selector problems of both releases together with the expected ones.
+// Like the deploy job, the canary release overrides the release name with the one of the stable release.
+func mustSelectOwnPods(t *testing.T, values map[string]string, expectedProblems []string) {
+	var outputs []string
+	for _, track := range []string{"stable", "canary"} {
+		trackValues := map[string]string{"application.track": track}
+		mergeStringMap(trackValues, selectorValues)
+		mergeStringMap(trackValues, values)
+
+		releaseName := "production"
+		if track != "stable" {
+			releaseName += "-" + track
+			if trackValues["releaseOverride"] == "" {
+				trackValues["releaseOverride"] = "production"
+			}
+		}
+		opts := &helm.Options{SetValues: trackValues}
+		outputs = append(outputs, mustRenderTemplate(t, opts, releaseName, selectorTemplates, nil))
+	}
+
+	release, err := integrity.Parse(strings.Join(outputs, "\n---\n"))
+	require.NoError(t, err)
+
+	selections, err := release.Selections()
+	require.NoError(t, err)
+	for _, selection := range selections {
+		t.Log(selection)
+	}
+
+	problems, err := release.CheckSelectors()
+	require.NoError(t, err)
+
+	var messages []string
+	for _, problem := range problems {
+		messages = append(messages, problem.String())
+	}
+	require.Equal(t, expectedProblems, messages)
+}
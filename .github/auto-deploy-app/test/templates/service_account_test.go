@@ -104,7 +104,7 @@ func TestServiceAccountTemplate(t *testing.T) {
             }
 
 			var serviceAccount coreV1.ServiceAccount
-			helm.UnmarshalK8SYaml(t, output, &serviceAccount)
+			mustUnmarshalStrict(t, output, &serviceAccount)
 
 			require.Equal(t, tc.ExpectedName, serviceAccount.Name)
 			require.Equal(t, tc.ExpectedAnnotations, serviceAccount.Annotations)
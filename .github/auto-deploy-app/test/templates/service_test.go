@@ -69,7 +69,7 @@ func TestServiceTemplate_ServiceType(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
 
 			service := new(coreV1.Service)
-			helm.UnmarshalK8SYaml(t, output, service)
+			mustUnmarshalStrict(t, output, service)
 			require.Equal(t, service.Spec.Type, v1.ServiceType(tc.expectedType))
 			require.Equal(t, service.Spec.Ports, []coreV1.ServicePort{tc.expectedPort})
 		})
@@ -129,7 +129,7 @@ func TestServiceTemplate_DifferentTracks(t *testing.T) {
 			output := mustRenderTemplate(t, opts, tc.releaseName, templates, tc.expectedErrorRegexp)
 
 			service := new(coreV1.Service)
-			helm.UnmarshalK8SYaml(t, output, service)
+			mustUnmarshalStrict(t, output, service)
 			require.Equal(t, tc.expectedName, service.ObjectMeta.Name)
 			for key, value := range tc.expectedLabels {
 				require.Equal(t, service.ObjectMeta.Labels[key], value)
@@ -175,7 +175,7 @@ func TestServiceTemplate_Disable(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
 
 			service := new(coreV1.Service)
-			helm.UnmarshalK8SYaml(t, output, service)
+			mustUnmarshalStrict(t, output, service)
 			require.Equal(t, tc.expectedName, service.ObjectMeta.Name)
 		})
 	}
@@ -222,7 +222,7 @@ func TestServiceExtraPortsServiceDefinition(t *testing.T) {
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
 			service := new(coreV1.Service)
-			helm.UnmarshalK8SYaml(t, output, service)
+			mustUnmarshalStrict(t, output, service)
 			require.Equal(t, tc.expectedPorts, service.Spec.Ports)
 		})
 	}
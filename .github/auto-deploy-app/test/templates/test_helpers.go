@@ -1,29 +1,92 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sync"
 	"testing"
 	"strings"
 
 	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/coverage"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/render"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/schema"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/yamllint"
 	"gopkg.in/yaml.v3"
 	appsV1 "k8s.io/api/apps/v1"
 	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8syaml "sigs.k8s.io/yaml"
 )
 
 const (
 	helmChartPath = "../.."
+	goldenPath    = "../testdata/golden"
 )
 
 var chartName string // dynamically initialized
 
+// run `go test ./... -update` to rewrite the golden files with the current rendering
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// run `go test ./... -kube-version 1.22` to render every template with the APIs served by that Kubernetes version,
+// `go run ./cmd/matrix` does this for all versions in schema.KubernetesVersions
+var kubeVersion = flag.String("kube-version", "", "render with --kube-version and only the API versions served by this Kubernetes minor version, e.g. 1.22")
+
+// run `go test ./... -renderer helm` to render with the helm binary instead of helm's Go packages
+var renderer = flag.String("renderer", "engine", "render the chart in-process with helm's template engine (engine) or with the helm binary (helm)")
+
+// run `go test ./templates -run TestUpgradeSafety -upgrade-from v2.118.0` to check upgrades from that git revision,
+// by default from the latest tag before HEAD
+var upgradeFrom = flag.String("upgrade-from", "", "git revision of the chart TestUpgradeSafety upgrades from, the latest tag before HEAD by default")
+
+// run `go test ./templates -run TestAPIServerValidation -apiserver` to apply the key scenarios with a dry run to a
+// kube-apiserver started from the binaries in $KUBEBUILDER_ASSETS instead of validating them in memory
+var apiServer = flag.Bool("apiserver", false, "validate with a kube-apiserver started from $KUBEBUILDER_ASSETS instead of the in-memory fake")
+
+// run `go test ./templates -values-coverage coverage.txt` to report the values references of the templates
+// no test sets, -values-coverage-json writes the report as JSON
+var (
+	valuesCoverageText = flag.String("values-coverage", "", "write the values coverage report to this file")
+	valuesCoverageJSON = flag.String("values-coverage-json", "", "write the values coverage report as JSON to this file")
+)
+
+var valuesCoverage coverage.Recorder
+
+var chartRenderer struct {
+	sync.Once
+	renderer *render.Renderer
+	err      error
+}
+
+var schemaValidators = struct {
+	sync.Mutex
+	validators map[string]*schema.Validator
+}{validators: map[string]*schema.Validator{}}
+
+// goldenCalls counts the renderings per test, so a test rendering more than once gets one golden file per call,
+// and records the golden files of all renderings, so checkGoldenFiles finds the ones no test uses anymore
+var goldenCalls = struct {
+	sync.Mutex
+	count map[string]int
+	used  map[string]bool
+}{count: map[string]int{}, used: map[string]bool{}}
+
 func init() {
 	// init chartName dynamically because it is annoying to update this value, but it is needed for some expected labels
 	f, err := os.Open(helmChartPath + "/Chart.yaml")
@@ -44,7 +107,16 @@ func init() {
 
 func mustRenderTemplate(t *testing.T, opts *helm.Options, releaseName string, templates []string, expectedErrorRegexp *regexp.Regexp, extraHelmArgs ...string) (string) {
 
-	output, err := helm.RenderTemplateE(t, opts, helmChartPath, releaseName, templates, extraHelmArgs...)
+	validateVersion := *kubeVersion
+	if *kubeVersion != "" {
+		extraHelmArgs = append([]string{"--kube-version", *kubeVersion}, extraHelmArgs...)
+		if pinsAPIVersions(extraHelmArgs) {
+			// the test renders for a specific API set, which may not be served by this version
+			validateVersion = ""
+		}
+	}
+
+	output, err := renderTemplateE(t, opts, releaseName, templates, extraHelmArgs...)
 	if expectedErrorRegexp != nil {
 		if err == nil {
 			t.Fatalf("Expected error but didn't happen")
@@ -58,26 +130,442 @@ func mustRenderTemplate(t *testing.T, opts *helm.Options, releaseName string, te
 		return ""
 	}
 
-	// yamllint with extra config
-	// check indenting of sequences with the default k8s style
-	// disable trailing-space check, because sometimes we have empty variables and we don't want to use if blocks around every option
-	cmd := exec.Command("yamllint", "-s", "-d", "{extends: default, rules: {line-length: {max: 160}, indentation: {indent-sequences: false}, trailing-spaces: disable}}", "-")
-	cmd.Stdin = strings.NewReader(output + "\n")
-	var out strings.Builder
-	cmd.Stdout = &out
-	err = cmd.Run()
-
-	if err != nil {
-		t.Fatalf("rendered template had yamllint errors: %s", out.String())
+	// check indenting of sequences with the default k8s style, trailing spaces are not checked,
+	// because sometimes we have empty variables and we don't want to use if blocks around every option
+	if problems := yamllint.Lint(output+"\n", yamllint.DefaultConfig); len(problems) > 0 {
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.String()
+		}
+		t.Fatalf("rendered template had yamllint errors:\n%s", strings.Join(messages, "\n"))
 		return ""
 	}
 
-	// needed, because yamllint does not detect empty lines containing spaces
-	require.NotRegexpf(t, regexp.MustCompile("\n[[:space:]]*\n"), output, "found empty lines in output")
+	// helm ignores unknown fields, so also check the rendered resources against the Kubernetes schemas
+	mustMatchSchema(t, validateVersion, output)
+
+	// the golden files are rendered with helm's default capabilities
+	if *kubeVersion == "" {
+		mustMatchGolden(t, output)
+	}
 
 	return output
 }
 
+// lintLineReference is the reference to another line in a yamllint message.
+var lintLineReference = regexp.MustCompile(` \(first defined in line \d+\)`)
+
+// mustRenderLintProblems renders the templates like mustRenderTemplate for a case that expects the rendering to fail
+// the YAML style checks, and returns the problems instead of failing the test. The rendering still has to match its
+// golden file. The problems are the message and the rule without line numbers, which differ between the renderings of
+// the Kubernetes versions.
+func mustRenderLintProblems(t *testing.T, opts *helm.Options, releaseName string, templates []string, extraHelmArgs ...string) []string {
+	if *kubeVersion != "" {
+		extraHelmArgs = append([]string{"--kube-version", *kubeVersion}, extraHelmArgs...)
+	}
+	output, err := renderTemplateE(t, opts, releaseName, templates, extraHelmArgs...)
+	require.NoError(t, err)
+
+	var messages []string
+	for _, problem := range yamllint.Lint(output+"\n", yamllint.DefaultConfig) {
+		message := lintLineReference.ReplaceAllString(problem.Message, "")
+		messages = append(messages, fmt.Sprintf("%s (%s)", message, problem.Rule))
+	}
+	if *kubeVersion == "" {
+		mustMatchGolden(t, output)
+	}
+	return messages
+}
+
+// renderTemplateE renders like helm.RenderTemplateE. With the engine renderer, the chart is rendered by
+// the render package, unless the options or extraHelmArgs use flags it doesn't support.
+func renderTemplateE(t *testing.T, opts *helm.Options, releaseName string, templates []string, extraHelmArgs ...string) (string, error) {
+	if *valuesCoverageText != "" || *valuesCoverageJSON != "" {
+		recordValuesCoverage(t, opts, templates)
+	}
+
+	// with -kube-version, render with the APIs that version serves, unless the test passes its own
+	var servedAPIs []string
+	if *kubeVersion != "" && !pinsAPIVersions(extraHelmArgs) {
+		servedAPIs = servedAPIVersions(*kubeVersion)
+	}
+
+	renderOpts, ok := renderOptions(opts, templates, extraHelmArgs)
+	if *renderer != "engine" || !ok {
+		// the helm binary can only add to its default API versions
+		for _, api := range servedAPIs {
+			extraHelmArgs = append(extraHelmArgs, "--api-versions", api)
+		}
+		return helm.RenderTemplateE(t, opts, helmChartPath, releaseName, templates, extraHelmArgs...)
+	}
+	if servedAPIs != nil {
+		renderOpts.APIVersions = servedAPIs
+		renderOpts.OnlyAPIVersions = true
+	}
+
+	chartRenderer.Do(func() {
+		chartRenderer.renderer, chartRenderer.err = render.Load(helmChartPath)
+	})
+	require.NoError(t, chartRenderer.err)
+
+	for _, template := range templates {
+		if _, err := os.Stat(filepath.Join(helmChartPath, template)); err != nil {
+			absChartDir, _ := filepath.Abs(helmChartPath)
+			return "", helm.TemplateFileNotFoundError{Path: template, ChartDir: absChartDir}
+		}
+	}
+
+	output, err := chartRenderer.renderer.Render(releaseName, renderOpts)
+	if err != nil {
+		// the same message terratest returns for a failing helm binary, the tests match it
+		return "", fmt.Errorf("error while running command: exit status 1; Error: %w", err)
+	}
+	// terratest returns the output of helm without the final newline
+	return strings.TrimSuffix(output, "\n"), nil
+}
+
+// recordValuesCoverage records the values the options set for the rendered templates.
+func recordValuesCoverage(t *testing.T, opts *helm.Options, templates []string) {
+	var paths []coverage.Path
+	for _, values := range []map[string]string{opts.SetValues, opts.SetStrValues, opts.SetFiles} {
+		for key := range values {
+			paths = append(paths, coverage.ParseSetPath(key))
+		}
+	}
+	for _, file := range opts.ValuesFiles {
+		filePaths, err := coverage.ValuesFilePaths(file)
+		require.NoError(t, err)
+		paths = append(paths, filePaths...)
+	}
+	valuesCoverage.Record(templates, paths)
+}
+
+// writeValuesCoverage writes the values coverage reports requested with -values-coverage and -values-coverage-json.
+func writeValuesCoverage() error {
+	report, err := valuesCoverage.Analyze(helmChartPath)
+	if err != nil {
+		return err
+	}
+	if *valuesCoverageText != "" {
+		var text strings.Builder
+		if err := report.WriteText(&text); err != nil {
+			return err
+		}
+		if err := os.WriteFile(*valuesCoverageText, []byte(text.String()), 0o644); err != nil {
+			return err
+		}
+	}
+	if *valuesCoverageJSON != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*valuesCoverageJSON, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderOptions converts the terratest options and the extra helm arguments, ok is false if they use an unsupported flag.
+func renderOptions(opts *helm.Options, templates []string, extraHelmArgs []string) (renderOpts render.Options, ok bool) {
+	if opts.HomePath != "" || opts.EnvVars != nil {
+		return renderOpts, false
+	}
+	if opts.KubectlOptions != nil {
+		renderOpts.Namespace = opts.KubectlOptions.Namespace
+	}
+	renderOpts.SetValues = opts.SetValues
+	renderOpts.SetStrValues = opts.SetStrValues
+	renderOpts.SetFiles = opts.SetFiles
+	renderOpts.ValuesFiles = opts.ValuesFiles
+	renderOpts.ShowOnly = templates
+
+	for i := 0; i < len(extraHelmArgs); i++ {
+		flag, value, hasValue := strings.Cut(extraHelmArgs[i], "=")
+		if !hasValue && i+1 < len(extraHelmArgs) && (flag == "--api-versions" || flag == "-a" || flag == "--kube-version") {
+			i++
+			value = extraHelmArgs[i]
+		}
+		switch flag {
+		case "--api-versions", "-a":
+			renderOpts.APIVersions = append(renderOpts.APIVersions, value)
+		case "--kube-version":
+			renderOpts.KubeVersion = value
+		case "--is-upgrade":
+			renderOpts.IsUpgrade = true
+		default:
+			return renderOpts, false
+		}
+	}
+	return renderOpts, true
+}
+
+// renderedObjects are the resources of a rendering, decoded into the k8s.io/api types and indexed by kind and name.
+// Items of `v1 List` resources and the documents of multi-document templates are expanded,
+// resources of unknown kinds (e.g. custom resources) are kept as *unstructured.Unstructured.
+type renderedObjects struct {
+	objects []runtime.Object
+	byKind  map[string]map[string]runtime.Object
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// mustRenderObjects renders the templates and parses the output with mustParseObjects.
+func mustRenderObjects(t *testing.T, opts *helm.Options, releaseName string, templates []string, extraHelmArgs ...string) *renderedObjects {
+	output := mustRenderTemplate(t, opts, releaseName, templates, nil, extraHelmArgs...)
+	return mustParseObjects(t, output)
+}
+
+func mustParseObjects(t *testing.T, output string) *renderedObjects {
+	rendered := &renderedObjects{byKind: map[string]map[string]runtime.Object{}}
+	for _, document := range documentSeparator.Split(output, -1) {
+		var obj map[string]interface{}
+		require.NoError(t, k8syaml.UnmarshalStrict([]byte(document), &obj))
+		if obj == nil {
+			continue
+		}
+		if obj["apiVersion"] == "v1" && obj["kind"] == "List" {
+			items, _ := obj["items"].([]interface{})
+			for _, item := range items {
+				rendered.mustAdd(t, item)
+			}
+			continue
+		}
+		rendered.mustAdd(t, obj)
+	}
+	return rendered
+}
+
+// strictDecoder decodes into the k8s.io/api types and fails on fields unknown to the type.
+var strictDecoder = kjson.NewSerializerWithOptions(kjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme, kjson.SerializerOptions{Strict: true})
+
+func (r *renderedObjects) mustAdd(t *testing.T, obj interface{}) {
+	data, err := json.Marshal(obj)
+	require.NoError(t, err)
+
+	decoded, _, err := strictDecoder.Decode(data, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		decoded = &unstructured.Unstructured{}
+		err = json.Unmarshal(data, decoded)
+	}
+	require.NoError(t, err)
+
+	kind := decoded.GetObjectKind().GroupVersionKind().Kind
+	accessor, err := meta.Accessor(decoded)
+	require.NoError(t, err)
+	if r.byKind[kind] == nil {
+		r.byKind[kind] = map[string]runtime.Object{}
+	}
+	_, exists := r.byKind[kind][accessor.GetName()]
+	require.Falsef(t, exists, "%s %s is rendered more than once", kind, accessor.GetName())
+
+	r.byKind[kind][accessor.GetName()] = decoded
+	r.objects = append(r.objects, decoded)
+}
+
+// mustUnmarshalStrict decodes a rendered resource into obj like helm.UnmarshalK8SYaml, but fails the test if the YAML
+// has duplicate keys or fields unknown to the type of obj, e.g. a field rendered at the wrong indentation level,
+// which helm.UnmarshalK8SYaml silently drops. The output must contain at most one resource, obj is left unchanged
+// if there is none; use mustParseObjects for multi-document outputs.
+func mustUnmarshalStrict(t *testing.T, output string, obj interface{}) {
+	var documents []string
+	for _, document := range documentSeparator.Split(output, -1) {
+		var content interface{}
+		require.NoError(t, k8syaml.Unmarshal([]byte(document), &content))
+		if content != nil {
+			documents = append(documents, document)
+		}
+	}
+	require.LessOrEqualf(t, len(documents), 1, "expected at most one resource in the rendered output:\n%s", output)
+
+	if len(documents) == 1 {
+		require.NoError(t, k8syaml.UnmarshalStrict([]byte(documents[0]), obj))
+	}
+}
+
+// get returns the object of the kind with the name or nil.
+func (r *renderedObjects) get(kind, name string) runtime.Object {
+	return r.byKind[kind][name]
+}
+
+// ofKind returns all objects of the kind in the order they were rendered.
+func (r *renderedObjects) ofKind(kind string) []runtime.Object {
+	var objects []runtime.Object
+	for _, obj := range r.objects {
+		if obj.GetObjectKind().GroupVersionKind().Kind == kind {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// mustGetObject returns the object of the kind with the name, e.g.
+// mustGetObject[*batchV1.CronJob](t, objects, "CronJob", "production-job1")
+func mustGetObject[T runtime.Object](t *testing.T, r *renderedObjects, kind, name string) T {
+	obj := r.get(kind, name)
+	require.NotNilf(t, obj, "%s %s is not rendered", kind, name)
+	typed, ok := obj.(T)
+	require.Truef(t, ok, "%s %s is a %T", kind, name, obj)
+	return typed
+}
+
+// objectsOfType returns all objects of the type in the order they were rendered, e.g. objectsOfType[*appsV1.Deployment](objects)
+func objectsOfType[T runtime.Object](r *renderedObjects) []T {
+	var objects []T
+	for _, obj := range r.objects {
+		if typed, ok := obj.(T); ok {
+			objects = append(objects, typed)
+		}
+	}
+	return objects
+}
+
+// servedAPIVersions returns the capabilities of a cluster of the Kubernetes version: the served group versions, e.g.
+// batch/v1, and kinds, e.g. batch/v1/Job.
+func servedAPIVersions(kubeVersion string) []string {
+	var apis []string
+	groupVersions := map[string]bool{}
+	for _, api := range schema.ServedAPIs(kubeVersion) {
+		groupVersion := api[:strings.LastIndex(api, "/")]
+		if !groupVersions[groupVersion] {
+			groupVersions[groupVersion] = true
+			apis = append(apis, groupVersion)
+		}
+		apis = append(apis, api)
+	}
+	return apis
+}
+
+func pinsAPIVersions(helmArgs []string) bool {
+	for _, arg := range helmArgs {
+		if arg == "--api-versions" || arg == "-a" || strings.HasPrefix(arg, "--api-versions=") {
+			return true
+		}
+	}
+	return false
+}
+
+// mustMatchSchema validates the fields of all rendered resources against the vendored schemas and checks that a
+// Kubernetes version serves their apiVersion and kind, or any of the versions in schema.KubernetesVersions if
+// kubeVersion is empty.
+func mustMatchSchema(t *testing.T, kubeVersion string, output string) {
+	schemaValidators.Lock()
+	validator, ok := schemaValidators.validators[kubeVersion]
+	if !ok {
+		var err error
+		validator, err = schema.NewValidator(kubeVersion)
+		if err != nil {
+			schemaValidators.Unlock()
+			t.Fatalf("failed to load the Kubernetes schemas: %s", err.Error())
+		}
+		schemaValidators.validators[kubeVersion] = validator
+	}
+	schemaValidators.Unlock()
+
+	violations, err := validator.ValidateManifests(output)
+	require.NoError(t, err)
+	if len(violations) > 0 {
+		messages := make([]string, len(violations))
+		for i, violation := range violations {
+			messages[i] = violation.String()
+		}
+		t.Fatalf("rendered template does not match the Kubernetes schemas:\n%s", strings.Join(messages, "\n"))
+	}
+}
+
+// mustMatchGolden compares the complete rendered output with the golden file of the current test case,
+// so changes in fields that are not asserted explicitly are caught as well.
+func mustMatchGolden(t *testing.T, output string) {
+	path := goldenFile(t)
+
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(output), 0644))
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("golden file %s does not exist, run the tests with -update to create it", path)
+		return
+	}
+	require.NoError(t, err)
+
+	if string(expected) == output {
+		return
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(output),
+		FromFile: path,
+		ToFile:   "rendered",
+		Context:  3,
+	})
+	require.NoError(t, err)
+	t.Fatalf("rendered template does not match golden file, run the tests with -update if the change is intended:\n%s", diff)
+}
+
+// goldenFile maps the test name to a file below goldenPath, e.g.
+// TestHPA_AutoscalingV1/with_hpa_enabled -> TestHPA_AutoscalingV1/with_hpa_enabled.golden
+func goldenFile(t *testing.T) string {
+	goldenCalls.Lock()
+	defer goldenCalls.Unlock()
+
+	name := t.Name()
+	call := goldenCalls.count[name]
+	if call == 0 {
+		t.Cleanup(func() {
+			goldenCalls.Lock()
+			defer goldenCalls.Unlock()
+			delete(goldenCalls.count, name)
+		})
+	}
+	goldenCalls.count[name] = call + 1
+
+	file := regexp.MustCompile(`[^A-Za-z0-9_./-]`).ReplaceAllString(name, "_")
+	file = strings.ReplaceAll(file, "..", "_")
+	if call > 0 {
+		file = fmt.Sprintf("%s-%d", file, call)
+	}
+	path := filepath.Join(goldenPath, filepath.FromSlash(file)+".golden")
+	goldenCalls.used[path] = true
+	return path
+}
+
+// checkGoldenFiles returns an error listing the golden files no test rendered, or removes them with -update.
+// It is only meaningful after all tests ran and passed, with the default capabilities.
+func checkGoldenFiles() error {
+	goldenCalls.Lock()
+	defer goldenCalls.Unlock()
+
+	var unused []string
+	err := filepath.WalkDir(goldenPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || goldenCalls.used[path] {
+			return err
+		}
+		unused = append(unused, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	if !*updateGolden {
+		return fmt.Errorf("golden files no test renders, run the tests with -update to remove them:\n%s", strings.Join(unused, "\n"))
+	}
+	for _, path := range unused {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		// the directory of a test without golden files left
+		_ = os.Remove(filepath.Dir(path))
+	}
+	return nil
+}
+
 type workerDeploymentTestCase struct {
 	ExpectedName           string
 	ExpectedCmd            []string
@@ -112,18 +600,6 @@ type workerDeploymentHostNetworkTestCase struct {
 	ExpectedHostNetwork bool
 }
 
-type deploymentList struct {
-	metav1.TypeMeta `json:",inline"`
-
-	Items []appsV1.Deployment `json:"items" protobuf:"bytes,2,rep,name=items"`
-}
-
-type deploymentAppsV1List struct {
-	metav1.TypeMeta `json:",inline"`
-
-	Items []appsV1.Deployment `json:"items" protobuf:"bytes,2,rep,name=items"`
-}
-
 func mergeStringMap(dst, src map[string]string) {
 	for k, v := range src {
 		dst[k] = v
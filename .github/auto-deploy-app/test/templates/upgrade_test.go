@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/render"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/upgrade"
+)
+
+// TestUpgradeSafety renders the chart of a previous git revision and the current chart with the same values and fails
+// if an immutable field changes, which breaks `helm upgrade --atomic` for apps deployed with the previous version.
+// Without -upgrade-from and a tag before HEAD, e.g. in a shallow clone, it is skipped: no other revision is a release
+// apps are deployed with.
+func TestUpgradeSafety(t *testing.T) {
+	from := *upgradeFrom
+	if from == "" {
+		tag, err := upgrade.PreviousTag(helmChartPath)
+		if err != nil {
+			t.Skipf("no release to upgrade from, run `git fetch --tags` or set -upgrade-from: %v", err)
+		}
+		from = tag
+	}
+
+	previousChart, cleanup, err := upgrade.ChartAt(helmChartPath, from)
+	require.NoError(t, err)
+	defer cleanup()
+	previousRenderer, err := render.Load(previousChart)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		CaseName    string
+		Release     string
+		Values      map[string]string
+		ValuesFiles []string
+	}{
+		{
+			CaseName: "stable",
+			Release:  "production",
+			Values:   map[string]string{"application.track": "stable"},
+		},
+		{
+			CaseName: "canary",
+			Release:  "production-canary",
+			Values: map[string]string{
+				"application.track": "canary",
+				"releaseOverride":   "production",
+			},
+		},
+		{
+			CaseName: "database jobs",
+			Release:  "production",
+			Values: map[string]string{
+				"application.initializeCommand": "echo initialize",
+				"application.migrateCommand":    "echo migrate",
+			},
+		},
+		{
+			CaseName:    "persistence",
+			Release:     "production",
+			ValuesFiles: []string{"../testdata/volume-mounts.yaml"},
+		},
+	} {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			values := map[string]string{}
+			mergeStringMap(values, integrityValues)
+			mergeStringMap(values, tc.Values)
+
+			previous, err := previousRenderer.Render(tc.Release, render.Options{SetValues: values, ValuesFiles: tc.ValuesFiles})
+			require.NoError(t, err, "rendering the chart at %s", from)
+
+			opts := &helm.Options{
+				SetValues:   values,
+				ValuesFiles: tc.ValuesFiles,
+			}
+			current, err := renderTemplateE(t, opts, tc.Release, nil)
+			require.NoError(t, err)
+
+			problems, err := upgrade.Check(previous, current)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.Emptyf(t, messages, "upgrading from %s changes immutable fields:\n%s", from, strings.Join(messages, "\n"))
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xeipuuv/gojsonschema"
+	"sigs.k8s.io/yaml"
+)
+
+func TestValuesSchema_Conformance(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.yaml")
+	require.NoError(t, err)
+	files = append([]string{helmChartPath + "/values.yaml"}, files...)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			values, err := os.ReadFile(file)
+			require.NoError(t, err)
+
+			require.Empty(t, validateValues(t, string(values)))
+		})
+	}
+}
+
+func TestValuesSchema_Rejects(t *testing.T) {
+	tcs := []struct {
+		name   string
+		values string
+
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:                "replicaCount as string",
+			values:              `replicaCount: "two"`,
+			expectedErrorRegexp: regexp.MustCompile(`replicaCount: Invalid type\. Expected: integer, given: string`),
+		},
+		{
+			name: "hpa.metrics as map",
+			values: `
+hpa:
+  enabled: true
+  metrics:
+    type: Resource
+`,
+			expectedErrorRegexp: regexp.MustCompile(`hpa\.metrics: Invalid type\. Expected: \[array,null\], given: object`),
+		},
+		{
+			name: "workers as list",
+			values: `
+workers:
+- name: worker
+`,
+			expectedErrorRegexp: regexp.MustCompile(`workers: Invalid type\. Expected: \[object,null\], given: array`),
+		},
+		{
+			name: "cronjobs as list",
+			values: `
+cronjobs:
+- schedule: "*/2 * * * *"
+`,
+			expectedErrorRegexp: regexp.MustCompile(`cronjobs: Invalid type\. Expected: \[object,null\], given: array`),
+		},
+		{
+			name: "worker command as string",
+			values: `
+workers:
+  sidekiq:
+    command: bundle exec sidekiq
+`,
+			expectedErrorRegexp: regexp.MustCompile(`workers\.sidekiq\.command: Invalid type\. Expected: \[array,null\], given: string`),
+		},
+		{
+			name: "unknown cronjob concurrencyPolicy",
+			values: `
+cronjobs:
+  job:
+    schedule: "*/2 * * * *"
+    concurrencyPolicy: Sometimes
+`,
+			expectedErrorRegexp: regexp.MustCompile(`cronjobs\.job\.concurrencyPolicy: .* must be one of the following: "Allow", "Forbid", "Replace"`),
+		},
+		{
+			name: "persistence volume without name",
+			values: `
+persistence:
+  enabled: true
+  volumes:
+  - mount:
+      path: /data
+`,
+			expectedErrorRegexp: regexp.MustCompile(`persistence\.volumes\.0: name is required`),
+		},
+		{
+			name: "unknown access mode",
+			values: `
+persistence:
+  volumes:
+  - name: data
+    claim:
+      accessMode: ReadWriteAll
+`,
+			expectedErrorRegexp: regexp.MustCompile(`persistence\.volumes\.0\.claim\.accessMode: .* must be one of the following`),
+		},
+		{
+			name: "role rules as map",
+			values: `
+roles:
+  pod-reader:
+    rules:
+      apiGroups: [""]
+`,
+			expectedErrorRegexp: regexp.MustCompile(`roles\.pod-reader\.rules: Invalid type\. Expected: array, given: object`),
+		},
+		{
+			name: "roleBinding subjects as string",
+			values: `
+roleBindings:
+  read-pods:
+    roleRefName: pod-reader
+    subjects: default
+`,
+			expectedErrorRegexp: regexp.MustCompile(`roleBindings\.read-pods\.subjects: Invalid type\. Expected: array, given: string`),
+		},
+		{
+			name: "probe delay as string",
+			values: `
+livenessProbe:
+  initialDelaySeconds: 15s
+`,
+			expectedErrorRegexp: regexp.MustCompile(`livenessProbe\.initialDelaySeconds: Invalid type\. Expected: integer, given: string`),
+		},
+		{
+			name: "servicePort out of range",
+			values: `
+service:
+  externalPort: 80000
+`,
+			expectedErrorRegexp: regexp.MustCompile(`service\.externalPort: Must be less than or equal to 65535`),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			errors := validateValues(t, tc.values)
+			require.Len(t, errors, 1)
+			require.Regexp(t, tc.expectedErrorRegexp, errors[0])
+		})
+	}
+}
+
+// validateValues validates a values file against values.schema.json the way helm does and returns the errors.
+func validateValues(t *testing.T, values string) []string {
+	schema, err := os.ReadFile(helmChartPath + "/values.schema.json")
+	require.NoError(t, err)
+	document, err := yaml.YAMLToJSON([]byte(values))
+	require.NoError(t, err)
+	if string(document) == "null" {
+		document = []byte("{}")
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewBytesLoader(document))
+	require.NoError(t, err)
+
+	var errors []string
+	for _, resultError := range result.Errors() {
+		errors = append(errors, resultError.String())
+	}
+	return errors
+}
@@ -211,12 +211,11 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 				return
             }
 
-			var deployments deploymentList
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 
 				require.Equal(t, expectedDeployment.ExpectedName, deployment.Name)
 				require.Equal(t, expectedDeployment.ExpectedStrategyType, deployment.Spec.Strategy.Type)
@@ -313,10 +312,9 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentList
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for i := range deployments.Items {
-				deployment := deployments.Items[i]
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for i := range deployments {
+				deployment := deployments[i]
 				require.Equal(
 					t,
 					tc.ExpectedImageRepository,
@@ -390,11 +388,9 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentList
-
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for i := range deployments.Items {
-				deployment := deployments.Items[i]
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for i := range deployments {
+				deployment := deployments[i]
 				require.Equal(
 					t,
 					tc.ExpectedImagePullSecrets,
@@ -500,11 +496,9 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentList
-
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for i := range deployments.Items {
-				deployment := deployments.Items[i]
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for i := range deployments {
+				deployment := deployments[i]
 				require.Equal(t, tc.ExpectedPodAnnotations, deployment.Spec.Template.ObjectMeta.Annotations)
 				for key, value := range tc.ExpectedPodLabels {
 					require.Equal(t, deployment.Spec.Template.ObjectMeta.Labels[key], value)
@@ -559,11 +553,9 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentList
-
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for i := range deployments.Items {
-				deployment := deployments.Items[i]
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for i := range deployments {
+				deployment := deployments[i]
 				require.Equal(t, tc.ExpectedHostAliases, deployment.Spec.Template.Spec.HostAliases)
 			}
 		})
@@ -610,11 +602,9 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentList
-
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for i := range deployments.Items {
-				deployment := deployments.Items[i]
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for i := range deployments {
+				deployment := deployments[i]
 				require.Equal(t, tc.ExpectedDnsConfig, deployment.Spec.Template.Spec.DNSConfig)
 			}
 		})
@@ -671,13 +661,12 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 				require.Equal(
 					t,
 					expectedDeployment.ExpectedHostNetwork,
@@ -749,12 +738,11 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 
 				require.Equal(t, expectedDeployment.ExpectedName, deployment.Name)
 
@@ -838,13 +826,12 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 				require.Equal(t, expectedDeployment.ExpectedServiceAccountName, deployment.Spec.Template.Spec.ServiceAccountName)
 			}
 		})
@@ -924,13 +911,12 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 				require.Equal(
 					t,
 					expectedDeployment.ExpectedServiceAccountName,
@@ -1046,13 +1032,12 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 				require.Equal(t, expectedDeployment.ExpectedName, deployment.Name)
 				require.Len(t, deployment.Spec.Template.Spec.Containers, 1)
 				require.Equal(t, expectedDeployment.ExpectedCmd, deployment.Spec.Template.Spec.Containers[0].Command)
@@ -1373,13 +1358,12 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 				require.Equal(t, expectedDeployment.ExpectedName, deployment.Name)
 				require.Len(t, deployment.Spec.Template.Spec.Containers, 1)
 				require.Equal(t, expectedDeployment.ExpectedCmd, deployment.Spec.Template.Spec.Containers[0].Command)
@@ -1504,13 +1488,12 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, tc.Release, []string{"templates/worker-deployment.yaml"}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			require.Len(t, deployments.Items, len(tc.ExpectedDeployments))
+			require.Len(t, deployments, len(tc.ExpectedDeployments))
 
 			for i, expectedDeployment := range tc.ExpectedDeployments {
-				deployment := deployments.Items[i]
+				deployment := deployments[i]
 				require.Equal(t, expectedDeployment.ExpectedName, deployment.Name)
 				require.Len(t, deployment.Spec.Template.Spec.Containers, 1)
 				require.Equal(t, expectedDeployment.ExpectedCmd, deployment.Spec.Template.Spec.Containers[0].Command)
@@ -1544,12 +1527,12 @@ func TestWorkerTemplateWithVolumeMounts(t *testing.T) {
 					Name: "config-volume",
 					VolumeSource: coreV1.VolumeSource{
 						ConfigMap: &coreV1.ConfigMapVolumeSource{
-							coreV1.LocalObjectReference{
+							LocalObjectReference: coreV1.LocalObjectReference{
 								Name: "test-config",
 							},
-							[]coreV1.KeyToPath{},
-							&configMapDefaultMode,
-							&configMapOptional,
+							Items:       []coreV1.KeyToPath{},
+							DefaultMode: &configMapDefaultMode,
+							Optional:    &configMapOptional,
 						},
 					},
 				},
@@ -1599,10 +1582,9 @@ func TestWorkerTemplateWithVolumeMounts(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
-			for _, deployment := range deployments.Items {
+			for _, deployment := range deployments {
 				for i, expectedVolume := range tc.expectedVolumes {
 					require.Equal(t, expectedVolume.Name, deployment.Spec.Template.Spec.Volumes[i].Name)
 					if deployment.Spec.Template.Spec.Volumes[i].PersistentVolumeClaim != nil {
@@ -1678,13 +1660,12 @@ func TestWorkerDatabaseUrlEnvironmentVariable(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
 
 			if tc.ExpectedDatabaseUrl != "" {
-				require.Contains(t, deployments.Items[0].Spec.Template.Spec.Containers[0].Env, coreV1.EnvVar{Name: "DATABASE_URL", Value: tc.ExpectedDatabaseUrl})
+				require.Contains(t, deployments[0].Spec.Template.Spec.Containers[0].Env, coreV1.EnvVar{Name: "DATABASE_URL", Value: tc.ExpectedDatabaseUrl})
 			} else {
-				for _, envVar := range deployments.Items[0].Spec.Template.Spec.Containers[0].Env {
+				for _, envVar := range deployments[0].Spec.Template.Spec.Containers[0].Env {
 					require.NotEqual(t, "DATABASE_URL", envVar.Name)
 				}
 			}
@@ -1756,9 +1737,8 @@ func TestWorkerDeploymentTemplateWithExtraEnvFrom(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for _, deployment := range deployments.Items {
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for _, deployment := range deployments {
 				require.Contains(t, deployment.Spec.Template.Spec.Containers[0].EnvFrom, tc.expectedEnvFrom)
 			}
 		})
@@ -1800,9 +1780,8 @@ func TestWorkerDeploymentTemplateWithExtraEnv(t *testing.T) {
 
 			output := mustRenderTemplate(t, options, releaseName, templates, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for _, deployment := range deployments.Items {
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for _, deployment := range deployments {
 				require.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, tc.expectedEnv)
 			}
 		})
@@ -1834,9 +1813,8 @@ func TestWorkerDeploymentTemplateWithSecurityContext(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for _, deployment := range deployments.Items {
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for _, deployment := range deployments {
 				require.Equal(t, *deployment.Spec.Template.Spec.SecurityContext.WindowsOptions.GMSACredentialSpecName, tc.expectedSecurityContextName)
 			}
 		})
@@ -1870,9 +1848,8 @@ func TestWorkerDeploymentTemplateWithContainerSecurityContext(t *testing.T) {
 			}
 			output := mustRenderTemplate(t, opts, releaseName, templates, nil)
 
-			var deployments deploymentAppsV1List
-			helm.UnmarshalK8SYaml(t, output, &deployments)
-			for _, deployment := range deployments.Items {
+			deployments := objectsOfType[*appsV1.Deployment](mustParseObjects(t, output))
+			for _, deployment := range deployments {
 				require.Equal(t, deployment.Spec.Template.Spec.Containers[0].SecurityContext.Capabilities.Drop, tc.expectedSecurityContextCapabilities)
 			}
 		})
@@ -0,0 +1,105 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// PreviousTag returns the latest tag before HEAD of the git repository containing dir.
+func PreviousTag(dir string) (string, error) {
+	return git(dir, "describe", "--tags", "--abbrev=0", "HEAD^")
+}
+
+// ChartAt exports the chart in chartDir as of the git revision ref, e.g. a tag, into a temporary directory.
+// It returns the chart directory of the export and a function removing it.
+func ChartAt(chartDir, ref string) (string, func(), error) {
+	root, err := git(chartDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", nil, err
+	}
+	prefix, err := git(chartDir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", nil, err
+	}
+	pathspec := prefix
+	if pathspec == "" {
+		pathspec = "."
+	}
+
+	cmd := exec.Command("git", "-C", root, "archive", "--format=tar", ref, "--", pathspec)
+	archive, err := cmd.Output()
+	if err != nil {
+		return "", nil, gitError(cmd, err)
+	}
+
+	tmp, err := os.MkdirTemp("", "chart-"+strings.ReplaceAll(ref, "/", "-")+"-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	if err := extract(archive, tmp); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to extract the chart at %s: %w", ref, err)
+	}
+	return filepath.Join(tmp, prefix), cleanup, nil
+}
+
+// extract writes the directories and regular files of a tar archive into dir.
+func extract(archive []byte, dir string) error {
+	r := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("%s is outside of the archive", header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, data, os.FileMode(header.Mode)&0o777); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", gitError(cmd, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func gitError(cmd *exec.Cmd, err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%s: %w: %s", strings.Join(cmd.Args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return fmt.Errorf("%s: %w", strings.Join(cmd.Args, " "), err)
+}
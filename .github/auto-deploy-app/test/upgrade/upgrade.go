@@ -0,0 +1,161 @@
+// Package upgrade checks that `helm upgrade` from a previous version of the chart can patch the resources of an
+// existing release. The API server rejects changes of immutable fields, e.g. the selector of a Deployment, so a chart
+// change that renders them differently breaks `helm upgrade --atomic` for every app deployed with the previous version.
+//
+// ChartAt exports the chart of a previous git revision, which is rendered with the same values as the current chart,
+// and Check compares both renderings.
+package upgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/test/integrity"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Problem is a change of an immutable field between the previous and the current rendering.
+type Problem struct {
+	Resource string
+	Path     string
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Resource, p.Path, p.Message)
+}
+
+// immutableFields are the fields of each kind the API server doesn't allow to change on update.
+var immutableFields = map[string][][]string{
+	"Deployment":            {{"spec", "selector"}},
+	"StatefulSet":           {{"spec", "selector"}},
+	"DaemonSet":             {{"spec", "selector"}},
+	"PersistentVolumeClaim": {{"spec", "storageClassName"}, {"spec", "accessModes"}},
+	"Job":                   {{"spec", "selector"}, {"spec", "template"}},
+	"Service":               {{"spec", "clusterIP"}, {"spec", "clusterIPs"}},
+}
+
+// Check parses the previous and the current rendering and compares the resources rendered by both.
+// Helm hooks are skipped, they are recreated instead of patched.
+//
+// Besides the immutableFields, a Service can't change its type from or to ExternalName:
+// helm's patch doesn't release or allocate the cluster IP, which the API server requires before Kubernetes 1.20.
+func Check(previous, current string) ([]Problem, error) {
+	previousRelease, err := integrity.Parse(previous)
+	if err != nil {
+		return nil, fmt.Errorf("previous rendering: %w", err)
+	}
+	currentRelease, err := integrity.Parse(current)
+	if err != nil {
+		return nil, fmt.Errorf("current rendering: %w", err)
+	}
+
+	var problems []Problem
+	for _, obj := range currentRelease.Objects() {
+		old := previousRelease.Get(obj.GetKind(), obj.GetName())
+		if old == nil || isHook(obj) || isHook(old) {
+			continue
+		}
+		resource := obj.GetKind() + "/" + obj.GetName()
+
+		for _, path := range immutableFields[obj.GetKind()] {
+			oldValue, _, _ := unstructured.NestedFieldNoCopy(old.Object, path...)
+			value, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+			for _, change := range changes(strings.Join(path, "."), oldValue, value) {
+				problems = append(problems, Problem{
+					Resource: resource,
+					Path:     change.path,
+					Message:  fmt.Sprintf("is immutable, changes from %s to %s", format(change.old), format(change.new)),
+				})
+			}
+		}
+
+		if obj.GetKind() == "Service" {
+			oldType := serviceType(old)
+			newType := serviceType(obj)
+			if oldType != newType && (oldType == "ExternalName" || newType == "ExternalName") {
+				problems = append(problems, Problem{
+					Resource: resource,
+					Path:     "spec.type",
+					Message:  fmt.Sprintf("changes from %s to %s, which requires deleting the Service before Kubernetes 1.20", oldType, newType),
+				})
+			}
+		}
+	}
+	return problems, nil
+}
+
+func isHook(obj *unstructured.Unstructured) bool {
+	_, ok := obj.GetAnnotations()["helm.sh/hook"]
+	return ok
+}
+
+func serviceType(service *unstructured.Unstructured) string {
+	serviceType, _, _ := unstructured.NestedString(service.Object, "spec", "type")
+	if serviceType == "" {
+		return "ClusterIP"
+	}
+	return serviceType
+}
+
+type change struct {
+	path     string
+	old, new interface{}
+}
+
+// changes returns the differences of the values as the paths of the changed leaves,
+// e.g. spec.selector.matchLabels.app instead of spec.selector.
+func changes(path string, old, new interface{}) []change {
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := map[string]bool{}
+		for key := range oldMap {
+			keys[key] = true
+		}
+		for key := range newMap {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		var result []change
+		for _, key := range sorted {
+			result = append(result, changes(path+"."+key, oldMap[key], newMap[key])...)
+		}
+		return result
+	}
+
+	oldSlice, oldIsSlice := old.([]interface{})
+	newSlice, newIsSlice := new.([]interface{})
+	if oldIsSlice && newIsSlice && len(oldSlice) == len(newSlice) {
+		var result []change
+		for i := range oldSlice {
+			result = append(result, changes(fmt.Sprintf("%s[%d]", path, i), oldSlice[i], newSlice[i])...)
+		}
+		return result
+	}
+
+	return []change{{path: path, old: old, new: new}}
+}
+
+func format(value interface{}) string {
+	if value == nil {
+		return "<unset>"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
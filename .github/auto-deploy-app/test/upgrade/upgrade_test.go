@@ -0,0 +1,318 @@
+package upgrade
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const deployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: production
+      track: stable
+`
+
+const pvc = `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: production-auto-deploy-data
+spec:
+  storageClassName: standard
+  accessModes:
+  - ReadWriteOnce
+  resources:
+    requests:
+      storage: 8Gi
+`
+
+const service = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: production-auto-deploy
+spec:
+  type: ClusterIP
+  ports:
+  - port: 5000
+`
+
+func TestCheck(t *testing.T) {
+	tcs := []struct {
+		name     string
+		previous string
+		current  string
+
+		expectedProblems []string
+	}{
+		{
+			name:     "unchanged",
+			previous: deployment + "---" + pvc + "---" + service,
+			current:  deployment + "---" + pvc + "---" + service,
+		},
+		{
+			name:     "mutable fields",
+			previous: deployment + "---" + pvc,
+			current: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+  labels:
+    app: production
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: production
+      track: stable
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: production-auto-deploy-data
+spec:
+  storageClassName: standard
+  accessModes:
+  - ReadWriteOnce
+  resources:
+    requests:
+      storage: 16Gi
+`,
+		},
+		{
+			name:     "added and removed resources",
+			previous: deployment,
+			current:  service,
+		},
+		{
+			name:     "deployment selector",
+			previous: deployment,
+			current: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production
+spec:
+  selector:
+    matchLabels:
+      app: production
+      tier: web
+      track: stable
+`,
+			expectedProblems: []string{
+				`Deployment/production: spec.selector.matchLabels.tier: is immutable, changes from <unset> to "web"`,
+			},
+		},
+		{
+			name: "statefulset selector",
+			previous: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: production-db
+spec:
+  selector:
+    matchLabels:
+      app: db
+`,
+			current: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: production-db
+spec:
+  selector:
+    matchExpressions:
+    - key: app
+      operator: In
+      values: [db]
+`,
+			expectedProblems: []string{
+				`StatefulSet/production-db: spec.selector.matchExpressions: is immutable, changes from <unset> to [{"key":"app","operator":"In","values":["db"]}]`,
+				`StatefulSet/production-db: spec.selector.matchLabels: is immutable, changes from {"app":"db"} to <unset>`,
+			},
+		},
+		{
+			name:     "persistent volume claim",
+			previous: pvc,
+			current: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: production-auto-deploy-data
+spec:
+  accessModes:
+  - ReadWriteMany
+  - ReadOnlyMany
+  resources:
+    requests:
+      storage: 8Gi
+`,
+			expectedProblems: []string{
+				`PersistentVolumeClaim/production-auto-deploy-data: spec.storageClassName: is immutable, changes from "standard" to <unset>`,
+				`PersistentVolumeClaim/production-auto-deploy-data: spec.accessModes: is immutable, changes from ["ReadWriteOnce"] to ["ReadWriteMany","ReadOnlyMany"]`,
+			},
+		},
+		{
+			name:     "service cluster IP and type",
+			previous: service,
+			current: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: production-auto-deploy
+spec:
+  type: ExternalName
+  externalName: example.com
+  clusterIP: None
+`,
+			expectedProblems: []string{
+				`Service/production-auto-deploy: spec.clusterIP: is immutable, changes from <unset> to "None"`,
+				`Service/production-auto-deploy: spec.type: changes from ClusterIP to ExternalName, which requires deleting the Service before Kubernetes 1.20`,
+			},
+		},
+		{
+			name:     "service type with cluster IP",
+			previous: service,
+			current: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: production-auto-deploy
+spec:
+  type: NodePort
+  ports:
+  - port: 5000
+    nodePort: 30001
+`,
+		},
+		{
+			name: "job template",
+			previous: `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: production-migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: app:1
+`,
+			current: `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: production-migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: app:2
+`,
+			expectedProblems: []string{
+				`Job/production-migrate: spec.template.spec.containers[0].image: is immutable, changes from "app:1" to "app:2"`,
+			},
+		},
+		{
+			name: "hook job",
+			previous: `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: production-db-migrate
+  annotations:
+    helm.sh/hook: pre-upgrade
+spec:
+  template:
+    spec:
+      containers:
+      - image: app:1
+`,
+			current: `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: production-db-migrate
+  annotations:
+    helm.sh/hook: pre-upgrade
+spec:
+  template:
+    spec:
+      containers:
+      - image: app:2
+`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			problems, err := Check(tc.previous, tc.current)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.Equal(t, tc.expectedProblems, messages)
+		})
+	}
+}
+
+func TestChartAt(t *testing.T) {
+	repo := t.TempDir()
+	chartDir := filepath.Join(repo, "charts", "app")
+	require.NoError(t, os.MkdirAll(filepath.Join(chartDir, "templates"), 0o755))
+
+	runGit := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	writeTemplate := func(content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(chartDir, "templates", "service.yaml"), []byte(content), 0o644))
+	}
+
+	runGit("init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: app\n"), 0o644))
+	writeTemplate("v1\n")
+	runGit("add", "-A")
+	runGit("commit", "-q", "-m", "v1")
+	runGit("tag", "v1.0.0")
+	writeTemplate("v2\n")
+	runGit("commit", "-q", "-am", "v2")
+
+	tag, err := PreviousTag(chartDir)
+	require.NoError(t, err)
+	require.Equal(t, "v1.0.0", tag)
+
+	dir, cleanup, err := ChartAt(chartDir, tag)
+	require.NoError(t, err)
+	defer cleanup()
+
+	template, err := os.ReadFile(filepath.Join(dir, "templates", "service.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "v1\n", string(template))
+	_, err = os.Stat(filepath.Join(dir, "Chart.yaml"))
+	require.NoError(t, err)
+
+	cleanup()
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+
+	_, _, err = ChartAt(chartDir, "v0.1.0")
+	require.Error(t, err)
+}
@@ -0,0 +1,296 @@
+// Package valueslint checks the values file of an app, e.g. the `.github/auto-deploy-values.yaml` deploy.yml passes
+// to `helm upgrade`, against the chart before Helm or Kubernetes fail in CI:
+//
+//   - keys values.schema.json doesn't describe are errors, with a suggestion for misspelled keys,
+//   - keys values.schema.json describes as deprecated are warnings,
+//   - combinations of values the chart ignores are warnings, e.g. hpa.enabled without resources.requests.
+//
+// An object of the schema with `properties` is closed unless it allows `additionalProperties`. Objects without
+// `properties`, e.g. nodeSelector, accept any key.
+package valueslint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/copystructure"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chartutil"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// Severity is the severity of a problem.
+type Severity string
+
+const (
+	// Error is a value the chart doesn't know.
+	Error Severity = "error"
+	// Warning is a value that works, but is deprecated or has no effect.
+	Warning Severity = "warning"
+)
+
+// Problem is a problem of a value at a line of the values file, Line is 0 for values the file doesn't set.
+type Problem struct {
+	Line     int
+	Path     string
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", p.Severity, p.Path, p.Message)
+	}
+	return fmt.Sprintf("%d: %s: %s: %s", p.Line, p.Severity, p.Path, p.Message)
+}
+
+// Linter lints values files against a chart.
+type Linter struct {
+	schema      map[string]interface{}
+	definitions map[string]interface{}
+	defaults    map[string]interface{}
+	// keyPaths are the paths of the properties of the schema by key, for suggestions of keys at the wrong level
+	keyPaths map[string][]string
+}
+
+// Load loads values.schema.json and values.yaml of the chart in chartDir.
+func Load(chartDir string) (*Linter, error) {
+	schema, err := os.ReadFile(filepath.Join(chartDir, "values.schema.json"))
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := os.ReadFile(filepath.Join(chartDir, "values.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	return New(schema, defaults)
+}
+
+// New creates a linter for a chart with the values schema and the default values.
+func New(schemaJSON, defaultValues []byte) (*Linter, error) {
+	l := &Linter{keyPaths: map[string][]string{}}
+	if err := json.Unmarshal(schemaJSON, &l.schema); err != nil {
+		return nil, fmt.Errorf("values.schema.json: %w", err)
+	}
+	l.definitions, _ = l.schema["definitions"].(map[string]interface{})
+	if err := k8syaml.Unmarshal(defaultValues, &l.defaults); err != nil {
+		return nil, fmt.Errorf("values.yaml: %w", err)
+	}
+	l.indexKeys("", l.schema)
+	return l, nil
+}
+
+func (l *Linter) indexKeys(prefix string, schema map[string]interface{}) {
+	properties, _ := l.resolve(schema)["properties"].(map[string]interface{})
+	for key, property := range properties {
+		path := joinPath(prefix, key)
+		l.keyPaths[key] = append(l.keyPaths[key], path)
+		if property, ok := property.(map[string]interface{}); ok {
+			l.indexKeys(path, property)
+		}
+	}
+}
+
+// resolve follows a $ref to the definitions of the schema.
+func (l *Linter) resolve(schema map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 10; i++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		definition, _ := l.definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+		if definition == nil {
+			return map[string]interface{}{}
+		}
+		schema = definition
+	}
+	return schema
+}
+
+// Lint lints the content of a values file.
+func (l *Linter) Lint(content []byte) ([]Problem, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := k8syaml.Unmarshal(content, &values); err != nil {
+		return nil, err
+	}
+
+	c := &checker{linter: l, lines: map[string]int{}}
+	if len(document.Content) > 0 {
+		c.walk(document.Content[0], l.schema, "")
+	}
+	if err := c.checkCombinations(values); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(c.problems, func(i, j int) bool { return c.problems[i].Line < c.problems[j].Line })
+	return c.problems, nil
+}
+
+type checker struct {
+	linter   *Linter
+	problems []Problem
+	// lines are the lines of the keys of the values file by path
+	lines map[string]int
+}
+
+func (c *checker) report(line int, path string, severity Severity, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Line: line, Path: path, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) walk(node *yaml.Node, schema map[string]interface{}, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	schema = c.linter.resolve(schema)
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		properties, hasProperties := schema["properties"].(map[string]interface{})
+		additional, additionalSchema := schema["additionalProperties"].(map[string]interface{})
+		openObject := !hasProperties || schema["additionalProperties"] == true
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				continue
+			}
+			keyPath := joinPath(path, key.Value)
+			c.lines[keyPath] = key.Line
+
+			if property, ok := properties[key.Value].(map[string]interface{}); ok {
+				if description, _ := property["description"].(string); strings.HasPrefix(description, "Deprecated") {
+					c.report(key.Line, keyPath, Warning, "%s", strings.ToLower(description[:1])+description[1:])
+				}
+				c.walk(value, property, keyPath)
+				continue
+			}
+			if additionalSchema {
+				c.walk(value, additional, keyPath)
+				continue
+			}
+			if !openObject {
+				c.report(key.Line, keyPath, Error, "unknown key%s", c.suggestion(key.Value, path, properties))
+			}
+		}
+	case yaml.SequenceNode:
+		items, ok := schema["items"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range node.Content {
+			c.walk(item, items, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// suggestion returns ", did you mean <key>?" for a misspelled key or a key at the wrong level, or "".
+func (c *checker) suggestion(key, parent string, properties map[string]interface{}) string {
+	best := ""
+	bestDistance := len(key)/3 + 1
+	for candidate := range properties {
+		distance := levenshtein(strings.ToLower(key), strings.ToLower(candidate))
+		if distance < bestDistance || (distance == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf(", did you mean %s?", joinPath(parent, best))
+	}
+	if paths := c.linter.keyPaths[key]; len(paths) == 1 {
+		return fmt.Sprintf(", did you mean %s?", paths[0])
+	}
+	return ""
+}
+
+// checkCombinations checks the values merged into the default values of the chart.
+func (c *checker) checkCombinations(values map[string]interface{}) error {
+	defaults, err := copystructure.Copy(c.linter.defaults)
+	if err != nil {
+		return err
+	}
+	userValues, err := copystructure.Copy(values)
+	if err != nil {
+		return err
+	}
+	if userValues.(map[string]interface{}) == nil {
+		userValues = map[string]interface{}{}
+	}
+	merged := chartutil.CoalesceTables(userValues.(map[string]interface{}), defaults.(map[string]interface{}))
+
+	if enabled, _ := lookup(merged, "hpa", "enabled").(bool); enabled {
+		if requests, _ := lookup(merged, "resources", "requests").(map[string]interface{}); len(requests) == 0 {
+			c.report(c.lines["hpa.enabled"], "hpa.enabled", Warning,
+				"the HorizontalPodAutoscaler is only rendered with resources.requests, e.g. resources.requests.cpu")
+		}
+	}
+
+	if metrics, _ := lookup(values, "hpa", "metrics").([]interface{}); len(metrics) > 0 {
+		if lookup(values, "hpa", "targetCPUUtilizationPercentage") != nil {
+			c.report(c.lines["hpa.targetCPUUtilizationPercentage"], "hpa.targetCPUUtilizationPercentage", Warning,
+				"is ignored, because hpa.metrics takes precedence")
+		}
+	}
+
+	if lookup(merged, "service", "type") == "NodePort" && lookup(merged, "service", "nodePort") == nil {
+		c.report(c.lines["service.type"], "service.type", Warning,
+			"NodePort without service.nodePort renders an empty nodePort, Kubernetes allocates a random port on every install")
+	}
+	return nil
+}
+
+func lookup(values map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = values
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minimum(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minimum(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
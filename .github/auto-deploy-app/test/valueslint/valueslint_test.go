@@ -0,0 +1,174 @@
+package valueslint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const chartPath = "../.."
+
+func TestLint(t *testing.T) {
+	linter, err := Load(chartPath)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name   string
+		values string
+
+		expectedProblems []string
+	}{
+		{
+			name: "valid values",
+			values: `
+replicaCount: 2
+extraLabels:
+  team: backend
+nodeSelector:
+  disktype: ssd
+hpa:
+  enabled: true
+  targetCPUUtilizationPercentage: 80
+resources:
+  requests:
+    cpu: 100m
+workers:
+  sidekiq:
+    command: [bundle, exec, sidekiq]
+customResources:
+- apiVersion: v1
+  kind: ConfigMap
+  data:
+    key: value
+`,
+		},
+		{
+			name:   "empty file",
+			values: "",
+		},
+		{
+			name: "unknown keys",
+			values: `
+replicaCont: 2
+nodePort: 30001
+service:
+  enabeld: true
+  extraPorts:
+  - port: 8080
+    protocl: TCP
+workers:
+  sidekiq:
+    comand: [sidekiq]
+unknown: true
+`,
+			expectedProblems: []string{
+				"2: error: replicaCont: unknown key, did you mean replicaCount?",
+				"3: error: nodePort: unknown key, did you mean service.nodePort?",
+				"5: error: service.enabeld: unknown key, did you mean service.enabled?",
+				"8: error: service.extraPorts[0].protocl: unknown key, did you mean service.extraPorts[0].protocol?",
+				"11: error: workers.sidekiq.comand: unknown key, did you mean workers.sidekiq.command?",
+				"12: error: unknown: unknown key",
+			},
+		},
+		{
+			name: "deprecated keys",
+			values: `
+serviceAccountName: app
+`,
+			expectedProblems: []string{
+				"2: warning: serviceAccountName: deprecated in favor of serviceAccount.name",
+			},
+		},
+		{
+			name: "hpa without resource requests",
+			values: `
+hpa:
+  enabled: true
+`,
+			expectedProblems: []string{
+				"3: warning: hpa.enabled: the HorizontalPodAutoscaler is only rendered with resources.requests, e.g. resources.requests.cpu",
+			},
+		},
+		{
+			name: "hpa metrics and target CPU utilization",
+			values: `
+hpa:
+  enabled: true
+  targetCPUUtilizationPercentage: 80
+  metrics:
+  - type: Resource
+    resource:
+      name: cpu
+      target:
+        type: Utilization
+        averageUtilization: 60
+resources:
+  requests:
+    cpu: 100m
+`,
+			expectedProblems: []string{
+				"4: warning: hpa.targetCPUUtilizationPercentage: is ignored, because hpa.metrics takes precedence",
+			},
+		},
+		{
+			name: "node port service without node port",
+			values: `
+service:
+  type: NodePort
+`,
+			expectedProblems: []string{
+				"3: warning: service.type: NodePort without service.nodePort renders an empty nodePort, Kubernetes allocates a random port on every install",
+			},
+		},
+		{
+			name: "node port service",
+			values: `
+service:
+  type: NodePort
+  nodePort: 30001
+`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			problems, err := linter.Lint([]byte(tc.values))
+			require.NoError(t, err)
+
+			var messages []string
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.Equal(t, tc.expectedProblems, messages)
+		})
+	}
+}
+
+// TestLint_ChartValues lints the default values and the values files of the template tests, which use every key.
+func TestLint_ChartValues(t *testing.T) {
+	linter, err := Load(chartPath)
+	require.NoError(t, err)
+
+	files, err := filepath.Glob("../testdata/*.yaml")
+	require.NoError(t, err)
+	for _, file := range append(files, filepath.Join(chartPath, "values.yaml")) {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		problems, err := linter.Lint(content)
+		require.NoError(t, err)
+		for _, problem := range problems {
+			require.NotEqual(t, Error, problem.Severity, "%s:%s", file, problem)
+		}
+	}
+}
+
+func TestLint_SyntaxError(t *testing.T) {
+	linter, err := Load(chartPath)
+	require.NoError(t, err)
+
+	_, err = linter.Lint([]byte("service:\n  type: [NodePort\n"))
+	require.Error(t, err)
+}
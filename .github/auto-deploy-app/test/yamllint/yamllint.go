@@ -0,0 +1,233 @@
+// Package yamllint checks the style of YAML documents. It replaces the call of `yamllint -s -d "{extends: default,
+// rules: {line-length: {max: 160}, indentation: {indent-sequences: false}, trailing-spaces: disable}}"` in the
+// template tests, but only implements these rules of that configuration:
+//
+//   - document-start: every document starts with "---"
+//   - empty-lines: no blank lines, including lines containing only whitespace (stricter than yamllint)
+//   - indentation: consistent indentation of block mappings and sequences, sequences not indented
+//   - key-duplicates: no duplicate keys in a mapping
+//   - line-length: at most 160 characters, unless the line is a single word
+//   - new-line-at-end-of-file
+//
+// The other rules yamllint's default configuration enables are dropped: anchors, braces, brackets, colons, commas,
+// comments, comments-indentation, hyphens, new-lines and truthy. A document that breaks only these rules, e.g. with
+// `key:  value` or an unquoted `yes`, passes.
+//
+// Problems are reported with the line and column, both starting at 1, like yamllint does.
+package yamllint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config configures the rules.
+type Config struct {
+	// MaxLineLength is the maximum number of characters of a line, 0 disables the rule.
+	MaxLineLength int
+	// IndentSequences requires block sequences to be indented relative to their mapping key.
+	IndentSequences bool
+	// AllowBlankLines allows empty lines and lines containing only whitespace.
+	AllowBlankLines bool
+}
+
+// DefaultConfig is the configuration of the template tests.
+var DefaultConfig = Config{MaxLineLength: 160}
+
+// Problem is a rule violation at a position of the linted input.
+type Problem struct {
+	Line    int
+	Column  int
+	Rule    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", p.Line, p.Column, p.Message, p.Rule)
+}
+
+// Lint checks the input, e.g. a multi-document stream rendered by helm, and returns the problems sorted by position.
+func Lint(input string, config Config) []Problem {
+	l := &linter{config: config}
+	l.checkLines(input)
+	l.checkDocuments(input)
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		if l.problems[i].Line != l.problems[j].Line {
+			return l.problems[i].Line < l.problems[j].Line
+		}
+		return l.problems[i].Column < l.problems[j].Column
+	})
+	return l.problems
+}
+
+type linter struct {
+	config   Config
+	problems []Problem
+	// indent is the indentation width of the input, set by the first indented block
+	indent int
+}
+
+func (l *linter) report(line, column int, rule, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{Line: line, Column: column, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+var (
+	documentStart = regexp.MustCompile(`^---(\s|$)`)
+	documentEnd   = regexp.MustCompile(`^\.\.\.(\s|$)`)
+	directive     = regexp.MustCompile(`^%`)
+)
+
+// checkLines runs the rules that only need the raw lines.
+func (l *linter) checkLines(input string) {
+	if input != "" && !strings.HasSuffix(input, "\n") {
+		lines := strings.Split(input, "\n")
+		l.report(len(lines), utf8.RuneCountInString(lines[len(lines)-1])+1, "new-line-at-end-of-file", "no new line character at the end of file")
+	}
+
+	expectStart := true
+	for i, line := range strings.Split(strings.TrimSuffix(input, "\n"), "\n") {
+		lineNumber := i + 1
+
+		if strings.TrimSpace(line) == "" {
+			if !l.config.AllowBlankLines && input != "" {
+				if line == "" {
+					l.report(lineNumber, 1, "empty-lines", "empty line")
+				} else {
+					l.report(lineNumber, 1, "empty-lines", "blank line contains whitespace")
+				}
+			}
+			continue
+		}
+
+		if l.config.MaxLineLength > 0 {
+			if length := utf8.RuneCountInString(line); length > l.config.MaxLineLength && !nonBreakable(line) {
+				l.report(lineNumber, l.config.MaxLineLength+1, "line-length", "line too long (%d > %d characters)", length, l.config.MaxLineLength)
+			}
+		}
+
+		switch {
+		case documentStart.MatchString(line):
+			expectStart = false
+		case documentEnd.MatchString(line):
+			expectStart = true
+		case directive.MatchString(line), strings.HasPrefix(strings.TrimSpace(line), "#"):
+		case expectStart:
+			l.report(lineNumber, 1, "document-start", "missing document start \"---\"")
+			expectStart = false
+		}
+	}
+}
+
+// nonBreakable reports whether the line only consists of one word, e.g. a long URL,
+// optionally after a comment sign, a sequence hyphen or a key.
+func nonBreakable(line string) bool {
+	content := strings.TrimLeft(line, " ")
+	if strings.HasPrefix(content, "#") {
+		content = strings.TrimLeft(content, "#")
+		content = strings.TrimPrefix(content, " ")
+	} else if strings.HasPrefix(content, "- ") {
+		content = content[2:]
+	}
+	return !strings.Contains(content, " ")
+}
+
+// checkDocuments runs the rules that need the parsed documents.
+func (l *linter) checkDocuments(input string) {
+	decoder := yaml.NewDecoder(strings.NewReader(input))
+	for {
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			l.report(syntaxErrorLine(err), 1, "syntax", "syntax error: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+			return
+		}
+		for _, node := range document.Content {
+			if node.Column != 1 {
+				l.report(node.Line, node.Column, "indentation", "wrong indentation: expected 0 but found %d", node.Column-1)
+			}
+			l.checkNode(node)
+		}
+	}
+}
+
+var syntaxErrorLinePattern = regexp.MustCompile(`line (\d+)`)
+
+func syntaxErrorLine(err error) int {
+	line := 1
+	if m := syntaxErrorLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		fmt.Sscan(m[1], &line)
+	}
+	return line
+}
+
+func (l *linter) checkNode(node *yaml.Node) {
+	if node.Style&yaml.FlowStyle != 0 {
+		return
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		keys := map[string]*yaml.Node{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Kind == yaml.ScalarNode && key.Value != "<<" {
+				if first, ok := keys[key.Value]; ok {
+					l.report(key.Line, key.Column, "key-duplicates", "duplication of key %q in mapping (first defined in line %d)", key.Value, first.Line)
+				} else {
+					keys[key.Value] = key
+				}
+			}
+			if value.Line > key.Line && value.Style&yaml.FlowStyle == 0 {
+				l.checkChildIndentation(key, value)
+			}
+			l.checkNode(value)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			l.checkNode(item)
+		}
+	}
+}
+
+// checkChildIndentation checks the indentation of a block mapping or sequence starting on the line after its key.
+func (l *linter) checkChildIndentation(key, value *yaml.Node) {
+	var expected int
+	switch value.Kind {
+	case yaml.MappingNode:
+		expected = l.indented(key.Column, value.Column)
+	case yaml.SequenceNode:
+		if !l.config.IndentSequences {
+			expected = key.Column
+		} else {
+			expected = l.indented(key.Column, value.Column)
+		}
+	default:
+		// multi-line strings and aliases are not checked
+		return
+	}
+	if value.Column != expected {
+		l.report(value.Line, value.Column, "indentation", "wrong indentation: expected %d but found %d", expected-1, value.Column-1)
+	}
+}
+
+// indented returns the expected column of a block nested in a parent at parentColumn.
+// The first indented block decides the indentation width of the input.
+func (l *linter) indented(parentColumn, column int) int {
+	if l.indent == 0 && column > parentColumn {
+		l.indent = column - parentColumn
+	}
+	if l.indent == 0 {
+		return parentColumn + 2
+	}
+	return parentColumn + l.indent
+}
@@ -0,0 +1,176 @@
+package yamllint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	tcs := []struct {
+		name   string
+		input  string
+		config Config
+
+		expectedProblems []string
+	}{
+		{
+			name: "helm output",
+			input: `---
+# Source: auto-deploy-app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: production-auto-deploy
+  annotations:
+  labels:
+    app: production
+spec:
+  ports:
+  - port: 5000
+    targetPort: 5000
+  selector:
+    app: production
+---
+# Source: auto-deploy-app/templates/ingress.yaml
+spec:
+  rules:
+  - host: "example.com"
+    http:
+      &httpRule
+      paths:
+      - path: "/"
+  - host: "other.example.com"
+    http:
+      <<: *httpRule
+  script: |
+    echo "a"
+      echo "b"
+`,
+			config: DefaultConfig,
+		},
+		{
+			name: "document markers",
+			input: `# comment
+a: 1
+---
+b: 2
+`,
+			config: DefaultConfig,
+			expectedProblems: []string{
+				`2:1: missing document start "---" (document-start)`,
+			},
+		},
+		{
+			name:   "blank lines",
+			input:  "---\na: 1\n\nb: 2\n  \nc: 3\n",
+			config: DefaultConfig,
+			expectedProblems: []string{
+				"3:1: empty line (empty-lines)",
+				"5:1: blank line contains whitespace (empty-lines)",
+			},
+		},
+		{
+			name:   "allowed blank lines",
+			input:  "---\na: 1\n\nb: 2\n",
+			config: Config{AllowBlankLines: true},
+		},
+		{
+			name:   "new line at end of file",
+			input:  "---\na: 1",
+			config: DefaultConfig,
+			expectedProblems: []string{
+				"2:5: no new line character at the end of file (new-line-at-end-of-file)",
+			},
+		},
+		{
+			name: "line length",
+			input: "---\na: " + strings.Repeat("word ", 40) + "\n" +
+				"url: https://example.com/" + strings.Repeat("x", 200) + "\n" +
+				"urls:\n" +
+				"- https://example.com/" + strings.Repeat("x", 200) + "\n" +
+				"# https://example.com/" + strings.Repeat("x", 200) + "\n",
+			config: DefaultConfig,
+			expectedProblems: []string{
+				"2:161: line too long (203 > 160 characters) (line-length)",
+				"3:161: line too long (225 > 160 characters) (line-length)",
+			},
+		},
+		{
+			name: "duplicate keys",
+			input: `---
+metadata:
+  name: a
+  labels:
+    app: a
+    app: b
+  name: b
+`,
+			config: DefaultConfig,
+			expectedProblems: []string{
+				`6:5: duplication of key "app" in mapping (first defined in line 5) (key-duplicates)`,
+				`7:3: duplication of key "name" in mapping (first defined in line 3) (key-duplicates)`,
+			},
+		},
+		{
+			name: "indentation",
+			input: `---
+spec:
+    replicas: 1
+    template:
+      spec:
+        containers:
+          - name: a
+            args:
+            - b
+`,
+			config: DefaultConfig,
+			expectedProblems: []string{
+				"5:7: wrong indentation: expected 8 but found 6 (indentation)",
+				"6:9: wrong indentation: expected 10 but found 8 (indentation)",
+				"7:11: wrong indentation: expected 8 but found 10 (indentation)",
+			},
+		},
+		{
+			name: "indented sequences",
+			input: `---
+spec:
+  ports:
+  - port: 1
+  hosts:
+    - a
+`,
+			config: Config{IndentSequences: true},
+			expectedProblems: []string{
+				"4:3: wrong indentation: expected 4 but found 2 (indentation)",
+			},
+		},
+		{
+			name:   "indented document",
+			input:  "---\n  a: 1\n",
+			config: DefaultConfig,
+			expectedProblems: []string{
+				"2:3: wrong indentation: expected 0 but found 2 (indentation)",
+			},
+		},
+		{
+			name:   "syntax error",
+			input:  "---\na: b: c\n",
+			config: DefaultConfig,
+			expectedProblems: []string{
+				"2:1: syntax error: line 2: mapping values are not allowed in this context (syntax)",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var problems []string
+			for _, problem := range Lint(tc.input, tc.config) {
+				problems = append(problems, problem.String())
+			}
+			require.Equal(t, tc.expectedProblems, problems)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+// Package appsecret converts the `K8S_SECRET_*` and `LC_K8S_SECRET_*` secrets and variables of a GitHub workflow
+// into the environment of the app, the way deploy.yml, herokuish-tests-db-url.yaml and
+// build-herokuish-and-push-to-registry.yaml do with jq:
+//
+//   - K8S_SECRET_<NAME> is the variable <NAME>, LC_K8S_SECRET_<NAME> the variable <name> in lower case,
+//   - values that aren't strings are passed as JSON, like `tostring` in jq,
+//   - for the Secret of deploy.yml, the variables SERVICE_ID and PUBLIC_URL of the workflow are passed as they are,
+//     PUBLIC_URL is replaced with the input of the workflow if it is set (see Sources.DeployExtras).
+//
+// The environment is written as a Secret manifest for `kubectl replace`, an env file for `docker --env-file` or
+// shell exports, and its checksum can be passed as application.secretChecksum, so pods are replaced when a secret
+// changes.
+package appsecret
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Prefix is the prefix of the secrets and variables passed to the app.
+	Prefix = "K8S_SECRET_"
+	// LowerCasePrefix is the prefix of the secrets and variables passed to the app in lower case.
+	LowerCasePrefix = "LC_K8S_SECRET_"
+)
+
+// Sources are the contexts of a workflow the environment is collected from.
+type Sources struct {
+	// Secrets is the secrets context, `toJson(secrets)`.
+	Secrets map[string]interface{}
+	// Vars is the vars context, `toJson(vars)`.
+	Vars map[string]interface{}
+	// DeployExtras adds the SERVICE_ID and PUBLIC_URL variables to the environment, like deploy.yml does for the
+	// Secret of the app.
+	DeployExtras bool
+	// PublicURL is the PUBLIC_URL input of the workflow, which replaces the PUBLIC_URL variable with DeployExtras if
+	// it is set.
+	PublicURL string
+}
+
+// ParseContext parses a context of a workflow, e.g. `toJson(secrets)`. An empty context is empty.
+func ParseContext(data []byte) (map[string]interface{}, error) {
+	context := map[string]interface{}{}
+	if strings.TrimSpace(string(data)) == "" {
+		return context, nil
+	}
+	if err := json.Unmarshal(data, &context); err != nil {
+		return nil, fmt.Errorf("invalid context: %w", err)
+	}
+	return context, nil
+}
+
+// Env is the environment of the app.
+type Env map[string]string
+
+// Collect returns the environment of the app. If several secrets or variables set the same name, the last of
+// K8S_SECRET_ secrets, K8S_SECRET_ variables, SERVICE_ID and PUBLIC_URL with DeployExtras, LC_K8S_SECRET_ secrets and
+// LC_K8S_SECRET_ variables wins, like the last of the lines the jq commands write.
+func Collect(sources Sources) (Env, error) {
+	env := Env{}
+	add := func(context map[string]interface{}, prefix string, lowerCase bool) error {
+		for key, value := range context {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			name := strings.TrimPrefix(key, prefix)
+			if lowerCase {
+				name = strings.ToLower(name)
+			}
+			if errs := validation.IsConfigMapKey(name); len(errs) > 0 {
+				return fmt.Errorf("%s: %s", key, strings.Join(errs, ", "))
+			}
+			s, err := toString(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			env[name] = s
+		}
+		return nil
+	}
+	if err := add(sources.Secrets, Prefix, false); err != nil {
+		return nil, err
+	}
+	if err := add(sources.Vars, Prefix, false); err != nil {
+		return nil, err
+	}
+	if sources.DeployExtras {
+		for _, name := range []string{"SERVICE_ID", "PUBLIC_URL"} {
+			if value, ok := sources.Vars[name]; ok {
+				s, err := toString(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				env[name] = s
+			}
+		}
+		if sources.PublicURL != "" {
+			env["PUBLIC_URL"] = sources.PublicURL
+		}
+	}
+	if err := add(sources.Secrets, LowerCasePrefix, true); err != nil {
+		return nil, err
+	}
+	if err := add(sources.Vars, LowerCasePrefix, true); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// DatabaseVariables are the variables deploy.yml adds to the Secret from its environment if they are set. The
+// POSTGRES_ variables are only added with POSTGRES_HOST.
+var DatabaseVariables = []string{"POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB", "POSTGRES_HOST", "DATABASE_URL", "DEPLOY_DATABASE"}
+
+// AddDatabase adds the DatabaseVariables that getenv returns to the environment.
+func (e Env) AddDatabase(getenv func(string) string) {
+	for _, name := range DatabaseVariables {
+		if strings.HasPrefix(name, "POSTGRES_") && getenv("POSTGRES_HOST") == "" {
+			continue
+		}
+		if value := getenv(name); value != "" {
+			e[name] = value
+		}
+	}
+}
+
+// toString converts a value of a context to a string like `tostring` in jq.
+func toString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// Names returns the names of the variables in alphabetical order.
+func (e Env) Names() []string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Manifest returns the Secret with the environment, for `kubectl replace --force`. The namespace is omitted if it
+// is empty.
+func (e Env) Manifest(name, namespace string) ([]byte, error) {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid secret name %q: %s", name, strings.Join(errs, ", "))
+	}
+	metadata := map[string]interface{}{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   metadata,
+		"type":       "Opaque",
+		"data":       e.data(),
+	})
+}
+
+func (e Env) data() map[string]string {
+	data := make(map[string]string, len(e))
+	for name, value := range e {
+		data[name] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return data
+}
+
+// shellIdentifier matches the names of shell variables. The names of a Secret can also contain '.' and '-'.
+var shellIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvFile returns the environment as an env file for `docker --env-file`, which can't contain values with line
+// breaks. Like Exports, the names have to be shell identifiers.
+func (e Env) EnvFile() ([]byte, error) {
+	var b strings.Builder
+	for _, name := range e.Names() {
+		if !shellIdentifier.MatchString(name) {
+			return nil, fmt.Errorf("%s: an env file can only contain names of shell variables", name)
+		}
+		if strings.ContainsAny(e[name], "\r\n") {
+			return nil, fmt.Errorf("%s: an env file can't contain values with line breaks", name)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, e[name])
+	}
+	return []byte(b.String()), nil
+}
+
+// Exports returns the environment as shell exports, quoted like `@sh` in jq. The names have to be shell
+// identifiers, `export my.var=…` is a syntax error.
+func (e Env) Exports() ([]byte, error) {
+	var b strings.Builder
+	for _, name := range e.Names() {
+		if !shellIdentifier.MatchString(name) {
+			return nil, fmt.Errorf("%s: shell exports can only contain names of shell variables", name)
+		}
+		fmt.Fprintf(&b, "export %s=%s\n", name, shellQuote(e[name]))
+	}
+	return []byte(b.String()), nil
+}
+
+// shellQuote quotes s in single quotes for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Checksum returns the SHA-256 checksum of the data of the Secret, which changes with every name and value.
+func (e Env) Checksum() string {
+	// json.Marshal sorts the keys
+	data, _ := json.Marshal(e.data())
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,250 @@
+package appsecret
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollect(t *testing.T) {
+	tcs := []struct {
+		name    string
+		secrets string
+		vars    string
+
+		deployExtras  bool
+		publicURL     string
+		expectedEnv   Env
+		expectedError string
+	}{
+		{
+			name:        "empty contexts",
+			expectedEnv: Env{},
+		},
+		{
+			name:    "prefixes",
+			secrets: `{"github_token": "***", "K8S_SECRET_API_KEY": "secret", "LC_K8S_SECRET_SMTP_HOST": "smtp", "DATABASE_URL": "postgres://"}`,
+			vars:    `{"K8S_SECRET_LOG_LEVEL": "debug", "LC_K8S_SECRET_NODE_ENV": "production", "KUBE_NAMESPACE": "app", "SERVICE_ID": "42", "PUBLIC_URL": "https://app.example.com"}`,
+			expectedEnv: Env{
+				"API_KEY":   "secret",
+				"smtp_host": "smtp",
+				"LOG_LEVEL": "debug",
+				"node_env":  "production",
+			},
+		},
+		{
+			name:         "deploy extras",
+			secrets:      `{"K8S_SECRET_API_KEY": "secret"}`,
+			vars:         `{"K8S_SECRET_LOG_LEVEL": "debug", "KUBE_NAMESPACE": "app", "SERVICE_ID": "42", "PUBLIC_URL": "https://app.example.com"}`,
+			deployExtras: true,
+			expectedEnv: Env{
+				"API_KEY":    "secret",
+				"LOG_LEVEL":  "debug",
+				"SERVICE_ID": "42",
+				"PUBLIC_URL": "https://app.example.com",
+			},
+		},
+		{
+			name:         "public URL input",
+			vars:         `{"PUBLIC_URL": "https://app.example.com"}`,
+			deployExtras: true,
+			publicURL:    "https://review.example.com",
+			expectedEnv:  Env{"PUBLIC_URL": "https://review.example.com"},
+		},
+		{
+			name:        "public URL input without deploy extras",
+			vars:        `{"PUBLIC_URL": "https://app.example.com"}`,
+			publicURL:   "https://review.example.com",
+			expectedEnv: Env{},
+		},
+		{
+			name:         "later sources win",
+			secrets:      `{"K8S_SECRET_MODE": "secret", "K8S_SECRET_SERVICE_ID": "secret", "LC_K8S_SECRET_NAME": "lower case secret"}`,
+			vars:         `{"K8S_SECRET_MODE": "variable", "SERVICE_ID": "variable", "K8S_SECRET_name": "variable", "LC_K8S_SECRET_NAME": "lower case variable"}`,
+			deployExtras: true,
+			expectedEnv: Env{
+				"MODE":       "variable",
+				"SERVICE_ID": "variable",
+				"name":       "lower case variable",
+			},
+		},
+		{
+			name:        "values that aren't strings",
+			vars:        `{"K8S_SECRET_REPLICAS": 3, "K8S_SECRET_DEBUG": true, "K8S_SECRET_OPTIONS": {"a": [1, null]}}`,
+			expectedEnv: Env{"REPLICAS": "3", "DEBUG": "true", "OPTIONS": `{"a":[1,null]}`},
+		},
+		{
+			name:          "empty name",
+			secrets:       `{"K8S_SECRET_": "value"}`,
+			expectedError: "K8S_SECRET_: a valid config key must consist of alphanumeric characters, '-', '_' or '.' (e.g. 'key.name',  or 'KEY_NAME',  or 'key-name', regex used for validation is '[-._a-zA-Z0-9]+')",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			secrets, err := ParseContext([]byte(tc.secrets))
+			require.NoError(t, err)
+			vars, err := ParseContext([]byte(tc.vars))
+			require.NoError(t, err)
+
+			env, err := Collect(Sources{Secrets: secrets, Vars: vars, DeployExtras: tc.deployExtras, PublicURL: tc.publicURL})
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedEnv, env)
+		})
+	}
+}
+
+// TestCollect_Formats collects the environment like cmd/appsecret for each format: only the Secret of deploy.yml and
+// its checksum have SERVICE_ID and PUBLIC_URL.
+func TestCollect_Formats(t *testing.T) {
+	sources := Sources{
+		Secrets:   map[string]interface{}{"K8S_SECRET_API_KEY": "secret"},
+		Vars:      map[string]interface{}{"SERVICE_ID": "42", "PUBLIC_URL": "https://app.example.com"},
+		PublicURL: "https://review.example.com",
+	}
+	format := func(deployExtras bool, write func(Env) ([]byte, error)) string {
+		sources := sources
+		sources.DeployExtras = deployExtras
+		env, err := Collect(sources)
+		require.NoError(t, err)
+		data, err := write(env)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("manifest", func(t *testing.T) {
+		manifest := format(true, func(env Env) ([]byte, error) { return env.Manifest("my-app", "") })
+		require.Equal(t, `apiVersion: v1
+data:
+  API_KEY: c2VjcmV0
+  PUBLIC_URL: aHR0cHM6Ly9yZXZpZXcuZXhhbXBsZS5jb20=
+  SERVICE_ID: NDI=
+kind: Secret
+metadata:
+  name: my-app
+type: Opaque
+`, manifest)
+	})
+	t.Run("checksum", func(t *testing.T) {
+		checksum := format(true, func(env Env) ([]byte, error) { return []byte(env.Checksum()), nil })
+		require.Equal(t, Env{"API_KEY": "secret", "SERVICE_ID": "42", "PUBLIC_URL": "https://review.example.com"}.Checksum(), checksum)
+	})
+	t.Run("env", func(t *testing.T) {
+		envFile := format(false, Env.EnvFile)
+		require.Equal(t, "API_KEY=secret\n", envFile)
+	})
+	t.Run("exports", func(t *testing.T) {
+		exports := format(false, Env.Exports)
+		require.Equal(t, "export API_KEY='secret'\n", exports)
+	})
+}
+
+func TestParseContext_Invalid(t *testing.T) {
+	_, err := ParseContext([]byte(`{"K8S_SECRET_A": `))
+	require.EqualError(t, err, "invalid context: unexpected end of JSON input")
+}
+
+func TestAddDatabase(t *testing.T) {
+	getenv := func(env map[string]string) func(string) string {
+		return func(name string) string { return env[name] }
+	}
+
+	env := Env{}
+	env.AddDatabase(getenv(map[string]string{"POSTGRES_USER": "user", "DATABASE_URL": "postgres://db", "DEPLOY_DATABASE": "true"}))
+	require.Equal(t, Env{"DATABASE_URL": "postgres://db", "DEPLOY_DATABASE": "true"}, env)
+
+	env = Env{}
+	env.AddDatabase(getenv(map[string]string{"POSTGRES_USER": "user", "POSTGRES_PASSWORD": "p@ss", "POSTGRES_DB": "app", "POSTGRES_HOST": "db"}))
+	require.Equal(t, Env{"POSTGRES_USER": "user", "POSTGRES_PASSWORD": "p@ss", "POSTGRES_DB": "app", "POSTGRES_HOST": "db"}, env)
+}
+
+var env = Env{
+	"API_KEY":  `it's "quoted" $HOME`,
+	"CERT":     "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+	"node_env": "production",
+	"EMPTY":    "",
+}
+
+func TestEnv_Manifest(t *testing.T) {
+	manifest, err := env.Manifest("my-app", "review")
+	require.NoError(t, err)
+	require.Equal(t, `apiVersion: v1
+data:
+  API_KEY: aXQncyAicXVvdGVkIiAkSE9NRQ==
+  CERT: LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUIKLS0tLS1FTkQgQ0VSVElGSUNBVEUtLS0tLQo=
+  EMPTY: ""
+  node_env: cHJvZHVjdGlvbg==
+kind: Secret
+metadata:
+  name: my-app
+  namespace: review
+type: Opaque
+`, string(manifest))
+
+	manifest, err = Env{}.Manifest("my-app", "")
+	require.NoError(t, err)
+	require.Equal(t, "apiVersion: v1\ndata: {}\nkind: Secret\nmetadata:\n  name: my-app\ntype: Opaque\n", string(manifest))
+
+	_, err = env.Manifest("My_App", "")
+	require.Error(t, err)
+}
+
+func TestEnv_EnvFile(t *testing.T) {
+	envFile, err := Env{"API_KEY": `it's "quoted" $HOME`, "EMPTY": ""}.EnvFile()
+	require.NoError(t, err)
+	require.Equal(t, "API_KEY=it's \"quoted\" $HOME\nEMPTY=\n", string(envFile))
+
+	_, err = env.EnvFile()
+	require.EqualError(t, err, "CERT: an env file can't contain values with line breaks")
+
+	_, err = Env{"API_KEY": "secret", "my.var": "value"}.EnvFile()
+	require.EqualError(t, err, "my.var: an env file can only contain names of shell variables")
+}
+
+func TestEnv_Exports(t *testing.T) {
+	exports, err := env.Exports()
+	require.NoError(t, err)
+	require.Equal(t, `export API_KEY='it'\''s "quoted" $HOME'
+export CERT='-----BEGIN CERTIFICATE-----
+MIIB
+-----END CERTIFICATE-----
+'
+export EMPTY=''
+export node_env='production'
+`, string(exports))
+
+	// a valid name of a Secret, but `export my.var=...` is a syntax error
+	_, err = Env{"API_KEY": "secret", "my.var": "value"}.Exports()
+	require.EqualError(t, err, "my.var: shell exports can only contain names of shell variables")
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to source the exports")
+	}
+	script := filepath.Join(t.TempDir(), "secrets.env")
+	require.NoError(t, os.WriteFile(script, exports, 0644))
+	output, err := exec.Command(sh, "-c", `. "$1" && printf '%s|%s' "$API_KEY" "$CERT"`, "sh", script).Output()
+	require.NoError(t, err)
+	require.Equal(t, env["API_KEY"]+"|"+env["CERT"], string(output))
+}
+
+func TestEnv_Checksum(t *testing.T) {
+	checksum := env.Checksum()
+	require.Len(t, checksum, 64)
+	require.Equal(t, checksum, Env{"node_env": "production", "EMPTY": "", "CERT": env["CERT"], "API_KEY": env["API_KEY"]}.Checksum())
+
+	for _, changed := range []Env{
+		{"API_KEY": "changed", "CERT": env["CERT"], "node_env": "production", "EMPTY": ""},
+		{"API_KEY": env["API_KEY"], "CERT": env["CERT"], "node_env": "production"},
+		{"API_KEY": env["API_KEY"], "CERT": env["CERT"], "NODE_ENV": "production", "EMPTY": ""},
+	} {
+		require.NotEqual(t, checksum, changed.Checksum())
+	}
+}
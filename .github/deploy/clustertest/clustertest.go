@@ -0,0 +1,61 @@
+// Package clustertest is a fake cluster for the tests of deploy and stop: client-go's fake clientset and an
+// in-memory Helm release storage per namespace.
+package clustertest
+
+import (
+	"io"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Cluster is a fake cluster.
+type Cluster struct {
+	Clientset *fake.Clientset
+	// Storages are the Helm release storages by namespace, a storage is added by Storage or Helm.
+	Storages map[string]*storage.Storage
+}
+
+// New returns a cluster with the objects.
+func New(objects ...runtime.Object) *Cluster {
+	return &Cluster{Clientset: fake.NewSimpleClientset(objects...), Storages: map[string]*storage.Storage{}}
+}
+
+// Storage returns the Helm release storage of the namespace.
+func (c *Cluster) Storage(namespace string) *storage.Storage {
+	if c.Storages[namespace] == nil {
+		memory := driver.NewMemory()
+		memory.SetNamespace(namespace)
+		c.Storages[namespace] = storage.Init(memory)
+	}
+	return c.Storages[namespace]
+}
+
+// Helm returns the Helm configuration of the namespace, with its release storage and a kube client that applies
+// nothing.
+func (c *Cluster) Helm(namespace string) (*action.Configuration, error) {
+	return &action.Configuration{
+		Releases:     c.Storage(namespace),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(string, ...interface{}) {},
+	}, nil
+}
+
+// AddRelease adds a deployed release of a chart with its name to the storage of the namespace.
+func (c *Cluster) AddRelease(namespace, name string) error {
+	return c.Storage(namespace).Create(&release.Release{
+		Name:      name,
+		Namespace: namespace,
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: "1.0.0"}},
+	})
+}
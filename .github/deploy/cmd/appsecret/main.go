@@ -0,0 +1,107 @@
+// Command appsecret writes the K8S_SECRET_* and LC_K8S_SECRET_* secrets and variables of a workflow as a Secret
+// manifest, an env file, shell exports or the checksum of the Secret, see package appsecret. The contexts are read
+// from $SECRETS_CONTEXT and $VARS_CONTEXT, like in the workflows, or from files. Only the manifest and its checksum
+// include SERVICE_ID and PUBLIC_URL, like the Secret of deploy.yml:
+//
+//	SECRETS_CONTEXT='${{ toJson(secrets) }}' VARS_CONTEXT='${{ toJson(vars) }}' \
+//	  go run ./cmd/appsecret -name my-app -database | kubectl replace --force -f -
+//	go run ./cmd/appsecret -secrets secrets.json -vars vars.json -format env > secrets.env
+//	go run ./cmd/appsecret -format checksum
+//
+// The exit code is 2 if a context is invalid or the environment can't be written in the format.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/appsecret"
+)
+
+func main() {
+	format := flag.String("format", "manifest", "manifest, env, exports or checksum")
+	secretsFile := flag.String("secrets", "", "file with the secrets context instead of $SECRETS_CONTEXT")
+	varsFile := flag.String("vars", "", "file with the vars context instead of $VARS_CONTEXT")
+	publicURL := flag.String("public-url", os.Getenv("PUBLIC_URL"), "PUBLIC_URL input of the workflow, for a manifest or checksum")
+	name := flag.String("name", "", "name of the Secret")
+	namespace := flag.String("namespace", "", "namespace of the Secret")
+	database := flag.Bool("database", false, "add the database variables of the environment, e.g. DATABASE_URL, like deploy.yml")
+	output := flag.String("o", "", "write to a file instead of stdout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	secrets, err := readContext(*secretsFile, "SECRETS_CONTEXT")
+	if err != nil {
+		exit(err)
+	}
+	vars, err := readContext(*varsFile, "VARS_CONTEXT")
+	if err != nil {
+		exit(err)
+	}
+	env, err := appsecret.Collect(appsecret.Sources{
+		Secrets:      secrets,
+		Vars:         vars,
+		DeployExtras: *format == "manifest" || *format == "checksum",
+		PublicURL:    *publicURL,
+	})
+	if err != nil {
+		exit(err)
+	}
+	if *database {
+		env.AddDatabase(os.Getenv)
+	}
+
+	var data []byte
+	switch *format {
+	case "manifest":
+		if *name == "" {
+			exit(fmt.Errorf("-name is required for a manifest"))
+		}
+		data, err = env.Manifest(*name, *namespace)
+	case "env":
+		data, err = env.EnvFile()
+	case "exports":
+		data, err = env.Exports()
+	case "checksum":
+		data = []byte(env.Checksum() + "\n")
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		exit(err)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*output, data, 0600)
+	}
+	if err != nil {
+		exit(err)
+	}
+}
+
+// readContext reads a context from file, or the environment variable if file is empty.
+func readContext(file, variable string) (map[string]interface{}, error) {
+	data := []byte(os.Getenv(variable))
+	if file != "" {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	context, err := appsecret.ParseContext(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", variable, err)
+	}
+	return context, nil
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
@@ -0,0 +1,105 @@
+// Command database prints the database settings of an app, see package database. The settings are read from the
+// variables of deploy.yml, DATABASE_URL, POSTGRES_ENABLED, POSTGRES_HOST, POSTGRES_USER, POSTGRES_PASSWORD and
+// POSTGRES_DB:
+//
+//	cd .github/deploy
+//	go run ./cmd/database -app-name "$APP_NAME" >> "$GITHUB_ENV"
+//	go run ./cmd/database -app-name my-app -port 6432 -sslmode require -option connect_timeout=10 -format values
+//
+// Nothing is printed without a database. The exit code is 2 if the settings are invalid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/cmd/internal/flagutil"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/database"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/slug"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	appName := flag.String("app-name", os.Getenv("APP_NAME"), "name of the app, the PostgreSQL release is <app name>-postgres")
+	postgresRelease := flag.String("postgres-release", "", "name of the PostgreSQL release instead of <app name>-postgres")
+	port := flag.String("port", os.Getenv("POSTGRES_PORT"), "port of the server")
+	sslMode := flag.String("sslmode", "", "sslmode of the connection")
+	var options flagutil.Strings
+	flag.Var(&options, "option", "parameter of the connection as name=value, can be repeated")
+	format := flag.String("format", "env", "env (for $GITHUB_ENV), values or url")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	source := database.Source{
+		DatabaseURL:     os.Getenv("DATABASE_URL"),
+		PostgresRelease: *postgresRelease,
+		Host:            os.Getenv("POSTGRES_HOST"),
+		Port:            *port,
+		User:            os.Getenv("POSTGRES_USER"),
+		Password:        os.Getenv("POSTGRES_PASSWORD"),
+		Name:            os.Getenv("POSTGRES_DB"),
+		SSLMode:         *sslMode,
+	}
+	if value := os.Getenv("POSTGRES_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exit(fmt.Errorf("POSTGRES_ENABLED: %w", err))
+		}
+		source.PostgresEnabled = enabled
+	}
+	if source.PostgresRelease == "" && *appName != "" {
+		source.PostgresRelease = slug.Legacy(*appName, "").PostgresRelease
+	}
+	for _, option := range options {
+		name, value, ok := strings.Cut(option, "=")
+		if !ok {
+			exit(fmt.Errorf("option %q isn't name=value", option))
+		}
+		if source.Options == nil {
+			source.Options = map[string]string{}
+		}
+		source.Options[name] = value
+	}
+
+	db, err := database.Resolve(source)
+	if err != nil {
+		exit(err)
+	}
+	if db == nil {
+		return
+	}
+	switch *format {
+	case "env":
+		env := db.Env()
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s=%s\n", name, env[name])
+		}
+	case "values":
+		data, err := yaml.Marshal(db.Values())
+		if err != nil {
+			exit(err)
+		}
+		os.Stdout.Write(data)
+	case "url":
+		fmt.Println(db.URL())
+	default:
+		exit(fmt.Errorf("unknown format %q", *format))
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
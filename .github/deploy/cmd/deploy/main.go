@@ -0,0 +1,203 @@
+// Command deploy deploys an app, it is the deploy job of deploy.yml, see package deploy. The flags are the inputs of
+// deploy.yml, the secrets and variables are read from the environment like in the workflow: KUBE_CONFIG,
+// KUBE_NAMESPACE, POSTGRES_ENABLED and the other POSTGRES_* variables, OSSHELL_REPOSITORY, DATABASE_URL,
+// DEPLOY_DATABASE, and the contexts $SECRETS_CONTEXT and $VARS_CONTEXT with the K8S_SECRET_* secrets:
+//
+//	cd .github/deploy
+//	SECRETS_CONTEXT='${{ toJson(secrets) }}' VARS_CONTEXT='${{ toJson(vars) }}' \
+//	  go run ./cmd/deploy -app-name my-app -docker-tag registry.example.com/my-app:0123abcd \
+//	  -kube-ingress-base-domain apps.example.com -caller path/to/app
+//	go run ./cmd/deploy -app-name my-app -docker-tag my-app:1 -kube-ingress-base-domain example.com -dry-run
+//
+// Without KUBE_CONFIG, the kubeconfig is $KUBECONFIG or ~/.kube/config. -dry-run prints the plan, the names, the
+// values and the names of the variables of the Secret, without a cluster. The exit code is 2 if the deployment fails.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/appsecret"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/cmd/internal/flagutil"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/database"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/deployvalues"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+	"k8s.io/client-go/kubernetes"
+)
+
+func main() {
+	var config deploy.Config
+	in := &config.Inputs
+	flag.StringVar(&in.AppName, "app-name", os.Getenv("APP_NAME"), "APP_NAME")
+	flag.StringVar(&in.AppRoot, "app-root", "/", "APP_ROOT")
+	flag.StringVar(&in.DockerTag, "docker-tag", "", "image reference with the tag, e.g. registry.example.com/app:0123abcd")
+	flag.StringVar(&in.PublicURL, "public-url", "", "PUBLIC_URL")
+	flag.StringVar(&in.KubeIngressBaseDomain, "kube-ingress-base-domain", os.Getenv("KUBE_INGRESS_BASE_DOMAIN"), "KUBE_INGRESS_BASE_DOMAIN")
+	flag.StringVar(&in.ServiceID, "service-id", "", "SERVICE_ID")
+	flag.StringVar(&in.DefaultPort, "default-port", "5000", "default_port")
+	doNotGenerate := flag.String("do-not-generate-additional-host-names", "false",
+		"do_not_generate_additional_host_names, the additional host is only generated if it is false")
+	flag.StringVar(&in.RefName, "ref-name", os.Getenv("GITHUB_REF_NAME"), "branch or tag of the app")
+	flag.StringVar(&in.RepositoryURL, "repository-url", "", "URL of the repository of the app")
+	flag.BoolVar(&config.DeriveNames, "derive-names", false, "derive DNS-1123 names instead of the names of deploy.yml")
+	flag.StringVar(&config.Namespace, "namespace", os.Getenv("KUBE_NAMESPACE"), "namespace, the app name if it is empty")
+	flag.StringVar(&config.CallerDir, "caller", ".", "path of the repository of the app")
+	flag.BoolVar(&config.ReplaceValues, "replace", false, "use the values file of the app instead of merging it into the generated values")
+	flag.StringVar(&config.Chart, "chart", "", "chart of the app instead of the chart directory of the app or -default-chart")
+	flag.StringVar(&config.DefaultChart, "default-chart", "../auto-deploy-app", "chart if the app has no chart directory")
+	var valuesFiles, setValues flagutil.Strings
+	flag.Var(&valuesFiles, "values", "additional values file like `helm --values`, can be repeated")
+	flag.Var(&valuesFiles, "f", "shorthand for -values")
+	flag.Var(&setValues, "set", "additional value like `helm --set`, can be repeated")
+	flag.DurationVar(&config.Timeout, "timeout", deploy.DefaultTimeout, "time to wait for each release")
+	dryRun := flag.Bool("dry-run", false, "print the plan without deploying")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in.DoNotGenerateAdditionalHostNames = *doNotGenerate != "false"
+	in.Env = map[string]string{}
+	for _, variable := range deployvalues.Variables {
+		if value, ok := os.LookupEnv(variable); ok {
+			in.Env[variable] = value
+		}
+	}
+	config.ValuesFiles = valuesFiles
+	config.SetValues = setValues
+	config.DeployDatabase = os.Getenv("DEPLOY_DATABASE")
+	config.Database = database.Source{
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+		Host:        os.Getenv("POSTGRES_HOST"),
+		User:        os.Getenv("POSTGRES_USER"),
+		Password:    os.Getenv("POSTGRES_PASSWORD"),
+		Name:        os.Getenv("POSTGRES_DB"),
+	}
+	if value := os.Getenv("POSTGRES_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exit(fmt.Errorf("POSTGRES_ENABLED: %w", err))
+		}
+		if enabled {
+			config.Postgres = postgres()
+		}
+	}
+	var err error
+	config.Secrets.PublicURL = in.PublicURL
+	if config.Secrets.Secrets, err = appsecret.ParseContext([]byte(os.Getenv("SECRETS_CONTEXT"))); err != nil {
+		exit(fmt.Errorf("SECRETS_CONTEXT: %w", err))
+	}
+	if config.Secrets.Vars, err = appsecret.ParseContext([]byte(os.Getenv("VARS_CONTEXT"))); err != nil {
+		exit(fmt.Errorf("VARS_CONTEXT: %w", err))
+	}
+
+	plan, err := deploy.NewPlan(config)
+	if err != nil {
+		exit(err)
+	}
+	if *dryRun {
+		if err := plan.Write(os.Stdout); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	deployer, err := newDeployer(plan.Namespace)
+	if err != nil {
+		exit(err)
+	}
+	if err := deployer.Apply(context.Background(), plan); err != nil {
+		exit(err)
+	}
+}
+
+// postgres returns the settings of the PostgreSQL release from the environment.
+func postgres() *deploy.Postgres {
+	p := deploy.DefaultPostgres()
+	p.User = os.Getenv("POSTGRES_USER")
+	p.Password = os.Getenv("POSTGRES_PASSWORD")
+	p.Database = os.Getenv("POSTGRES_DB")
+	for variable, setting := range map[string]*string{
+		"POSTGRES_REPOSITORY":       &p.Repository,
+		"POSTGRES_VERSION":          &p.Tag,
+		"OSSHELL_REPOSITORY":        &p.OSShellRepository,
+		"POSTGRES_SIZE":             &p.Size,
+		"POSTGRES_RESOURCES_PRESET": &p.ResourcesPreset,
+	} {
+		if value := os.Getenv(variable); value != "" {
+			*setting = value
+		}
+	}
+	return &p
+}
+
+// newDeployer returns a deployer for the cluster of KUBE_CONFIG, or of the kubeconfig of helm if it isn't set.
+func newDeployer(namespace string) (*deploy.Deployer, error) {
+	settings := cli.New()
+	getters, err := deploy.RESTClientGetters(settings, os.Getenv("KUBE_CONFIG"))
+	if err != nil {
+		return nil, err
+	}
+	getter, err := getters(namespace)
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := getter.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	registryClient, err := registry.NewClient(
+		registry.ClientOptWriter(os.Stderr),
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	log := func(format string, v ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", v...)
+	}
+
+	return &deploy.Deployer{
+		Clientset: clientset,
+		Helm: func(namespace string) (*action.Configuration, error) {
+			getter, err := getters(namespace)
+			if err != nil {
+				return nil, err
+			}
+			cfg := &action.Configuration{}
+			if err := cfg.Init(getter, namespace, os.Getenv("HELM_DRIVER"), log); err != nil {
+				return nil, err
+			}
+			cfg.RegistryClient = registryClient
+			return cfg, nil
+		},
+		LoadChart: func(name, version string) (*chart.Chart, error) {
+			install := action.NewInstall(&action.Configuration{RegistryClient: registryClient})
+			install.Version = version
+			path, err := install.LocateChart(name, settings)
+			if err != nil {
+				return nil, err
+			}
+			return loader.Load(path)
+		},
+		Out: os.Stdout,
+	}, nil
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
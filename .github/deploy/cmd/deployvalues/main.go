@@ -0,0 +1,81 @@
+// Command deployvalues writes the auto-deploy-values.yaml deploy.yml passes to `helm upgrade`, see package
+// deployvalues. The flags are the inputs of deploy.yml, the variables in upper case of deployvalues.Variables,
+// e.g. DATABASE_URL, are read from the environment:
+//
+//	cd .github/deploy
+//	go run ./cmd/deployvalues -app-name my-app -app-root / -docker-tag registry.example.com/my-app:0123abcd \
+//	  -kube-ingress-base-domain apps.example.com -ref-name feature/login -caller path/to/app > auto-deploy-values.yaml
+//
+// The exit code is 2 if the inputs or the values file of the app are invalid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/deployvalues"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	var in deployvalues.Inputs
+	flag.StringVar(&in.AppName, "app-name", "", "APP_NAME")
+	flag.StringVar(&in.AppRoot, "app-root", "/", "APP_ROOT")
+	flag.StringVar(&in.DockerTag, "docker-tag", "", "image reference with the tag, e.g. registry.example.com/app:0123abcd")
+	flag.StringVar(&in.PublicURL, "public-url", "", "PUBLIC_URL")
+	flag.StringVar(&in.KubeIngressBaseDomain, "kube-ingress-base-domain", "", "KUBE_INGRESS_BASE_DOMAIN")
+	flag.StringVar(&in.ServiceID, "service-id", "", "SERVICE_ID")
+	flag.StringVar(&in.DefaultPort, "default-port", "5000", "default_port")
+	doNotGenerate := flag.String("do-not-generate-additional-host-names", "false",
+		"do_not_generate_additional_host_names, the additional host is only generated if it is false")
+	flag.StringVar(&in.RefName, "ref-name", os.Getenv("GITHUB_REF_NAME"), "branch or tag of the app")
+	flag.StringVar(&in.RepositoryURL, "repository-url", "", "URL of the repository of the app")
+	callerDir := flag.String("caller", ".", "path of the repository of the app")
+	replace := flag.Bool("replace", false, "use the values file of the app instead of merging it into the generated values")
+	output := flag.String("o", "", "write the values to a file instead of stdout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in.DoNotGenerateAdditionalHostNames = *doNotGenerate != "false"
+	in.Env = map[string]string{}
+	for _, variable := range deployvalues.Variables {
+		if value, ok := os.LookupEnv(variable); ok {
+			in.Env[variable] = value
+		}
+	}
+
+	opts := deployvalues.Options{Replace: *replace}
+	callerFile, err := deployvalues.FindCallerFile(*callerDir)
+	if err == nil && callerFile != "" {
+		opts.CallerValues, err = os.ReadFile(callerFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	values, err := deployvalues.Build(in, opts)
+	if err != nil {
+		if callerFile != "" {
+			err = fmt.Errorf("%s: %w", callerFile, err)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	data, err := yaml.Marshal(values)
+	if err == nil {
+		if *output == "" {
+			_, err = os.Stdout.Write(data)
+		} else {
+			err = os.WriteFile(*output, data, 0644)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,17 @@
+package flagutil
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrings(t *testing.T) {
+	var values Strings
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&values, "f", "values file")
+	require.NoError(t, flags.Parse([]string{"-f", "a.yaml", "-f", "b,c.yaml"}))
+	require.Equal(t, Strings{"a.yaml", "b,c.yaml"}, values)
+	require.Equal(t, "a.yaml,b,c.yaml", values.String())
+}
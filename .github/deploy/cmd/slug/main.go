@@ -0,0 +1,67 @@
+// Command slug prints the names of a deployment derived from the app name and the git ref, see package slug, as
+// variables for $GITHUB_ENV, or with arguments the arguments as slugs:
+//
+//	cd .github/deploy
+//	go run ./cmd/slug -app-name "$APP_NAME" -ref "$GITHUB_REF_NAME" >> "$GITHUB_ENV"
+//	go run ./cmd/slug -legacy -json -app-name my_app -ref feature/login
+//	go run ./cmd/slug -max 24 review-feature-login-app-with-long-name
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/slug"
+)
+
+func main() {
+	appName := flag.String("app-name", "", "name of the app, APP_NAME")
+	ref := flag.String("ref", os.Getenv("GITHUB_REF_NAME"), "branch or tag")
+	legacy := flag.Bool("legacy", false, "derive the names like the shell commands of the workflows")
+	printJSON := flag.Bool("json", false, "print the names as JSON")
+	max := flag.Int("max", slug.LabelLength, "maximum length of the slugs of the arguments")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [strings]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		if *max < 10 {
+			fmt.Fprintln(os.Stderr, "-max has to be at least 10")
+			os.Exit(2)
+		}
+		for _, arg := range flag.Args() {
+			fmt.Println(slug.Slug(arg, *max))
+		}
+		return
+	}
+
+	names := slug.Derive(*appName, *ref)
+	if *legacy {
+		names = slug.Legacy(*appName, *ref)
+	}
+	if *printJSON {
+		data, err := json.MarshalIndent(names, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	for _, variable := range []struct{ name, value string }{
+		{"RELEASE_NAME", names.Release},
+		{"POSTGRES_RELEASE_NAME", names.PostgresRelease},
+		{"KUBE_NAMESPACE", names.Namespace},
+		{"SECRET_NAME", names.Secret},
+		{"APP_NAME_IN_URL", names.AppNameInURL},
+		{"REF_NAME", names.RefName},
+		{"ENVIRONMENT_SHORT", names.EnvironmentShort},
+		{"ADDITIONAL_HOST", names.AdditionalHost},
+	} {
+		fmt.Printf("%s=%s\n", variable.name, variable.value)
+	}
+}
@@ -0,0 +1,232 @@
+// Package database builds the PostgreSQL connection settings of an app, which deploy.yml passes as
+// application.database_url and as the POSTGRES_* variables of the app Secret, from one of:
+//
+//   - a DATABASE_URL, which is used as it is,
+//   - the PostgreSQL release deploy.yml installs in the cluster if POSTGRES_ENABLED is set,
+//   - an external server if POSTGRES_HOST is set.
+//
+// Unlike the shell steps of deploy.yml, which concatenated the URL, the user name, password and database name are
+// percent-encoded, so passwords with '@', '/' or ':' work, and the port, sslmode and other options can be set.
+package database
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is the port of PostgreSQL.
+const DefaultPort = 5432
+
+// Provider is where the database comes from.
+type Provider string
+
+const (
+	// Supplied is a database of a DATABASE_URL.
+	Supplied Provider = "url"
+	// InCluster is the PostgreSQL release deploy.yml installs.
+	InCluster Provider = "in-cluster"
+	// External is the server of POSTGRES_HOST.
+	External Provider = "external"
+)
+
+// SSLModes are the values of sslmode libpq supports.
+var SSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Source are the settings the database is built from, the variables of deploy.yml.
+type Source struct {
+	// DatabaseURL is DATABASE_URL, which takes precedence over the other settings.
+	DatabaseURL string
+	// PostgresEnabled is POSTGRES_ENABLED, the database is the PostgreSQL release PostgresRelease.
+	PostgresEnabled bool
+	// PostgresRelease is the name of the PostgreSQL release, which is the host of its Service.
+	PostgresRelease string
+	// Host is POSTGRES_HOST.
+	Host string
+	// Port is the port of the server, DefaultPort if it is empty.
+	Port string
+	// User is POSTGRES_USER.
+	User string
+	// Password is POSTGRES_PASSWORD.
+	Password string
+	// Name is POSTGRES_DB.
+	Name string
+	// SSLMode is the sslmode of the connection, libpq's default if it is empty.
+	SSLMode string
+	// Options are other parameters of the connection, e.g. application_name or connect_timeout.
+	Options map[string]string
+}
+
+// Database are the connection settings of a database.
+type Database struct {
+	Provider Provider
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+	Options  map[string]string
+
+	// supplied is the DATABASE_URL the database was parsed from.
+	supplied string
+}
+
+// Resolve returns the database of the source, or nil if it has none.
+func Resolve(source Source) (*Database, error) {
+	if source.DatabaseURL != "" {
+		return Parse(source.DatabaseURL)
+	}
+
+	database := &Database{
+		Provider: External,
+		Host:     source.Host,
+		User:     source.User,
+		Password: source.Password,
+		Name:     source.Name,
+		SSLMode:  source.SSLMode,
+		Options:  source.Options,
+	}
+	if source.PostgresEnabled {
+		if source.PostgresRelease == "" {
+			return nil, fmt.Errorf("the PostgreSQL release is required with POSTGRES_ENABLED")
+		}
+		database.Provider = InCluster
+		database.Host = source.PostgresRelease
+	} else if source.Host == "" {
+		return nil, nil
+	}
+
+	database.Port = DefaultPort
+	if source.Port != "" {
+		port, err := strconv.Atoi(source.Port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", source.Port)
+		}
+		database.Port = port
+	}
+	if err := database.Validate(); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// Parse parses a postgres:// or postgresql:// URL.
+func Parse(databaseURL string) (*Database, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		// the error contains the URL with the password
+		return nil, fmt.Errorf("DATABASE_URL is not a URL")
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return nil, fmt.Errorf("DATABASE_URL has the scheme %q instead of postgres", u.Scheme)
+	}
+
+	database := &Database{
+		Provider: Supplied,
+		Host:     u.Hostname(),
+		Port:     DefaultPort,
+		User:     u.User.Username(),
+		Name:     strings.TrimPrefix(u.Path, "/"),
+		supplied: databaseURL,
+	}
+	database.Password, _ = u.User.Password()
+	if port := u.Port(); port != "" {
+		if database.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("DATABASE_URL has the invalid port %q", port)
+		}
+	}
+	query := u.Query()
+	database.SSLMode = query.Get("sslmode")
+	query.Del("sslmode")
+	for key := range query {
+		if database.Options == nil {
+			database.Options = map[string]string{}
+		}
+		database.Options[key] = query.Get(key)
+	}
+	if err := database.Validate(); err != nil {
+		return nil, fmt.Errorf("DATABASE_URL: %w", err)
+	}
+	return database, nil
+}
+
+// Validate returns an error if the settings can't be a connection.
+func (d *Database) Validate() error {
+	if d.Host == "" {
+		return fmt.Errorf("the host is required")
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		return fmt.Errorf("invalid port %d", d.Port)
+	}
+	if d.Name == "" {
+		return fmt.Errorf("the database name is required")
+	}
+	if d.SSLMode != "" {
+		valid := false
+		for _, mode := range SSLModes {
+			valid = valid || d.SSLMode == mode
+		}
+		if !valid {
+			return fmt.Errorf("invalid sslmode %q, supported are %s", d.SSLMode, strings.Join(SSLModes, ", "))
+		}
+	}
+	return nil
+}
+
+// URL returns the postgres:// URL of the database with percent-encoded credentials, or the DATABASE_URL it was
+// parsed from.
+func (d *Database) URL() string {
+	if d.supplied != "" {
+		return d.supplied
+	}
+	u := url.URL{
+		Scheme:  "postgres",
+		Host:    net.JoinHostPort(d.Host, strconv.Itoa(d.Port)),
+		Path:    "/" + d.Name,
+		RawPath: "/" + url.PathEscape(d.Name),
+	}
+	if d.Password != "" {
+		u.User = url.UserPassword(d.User, d.Password)
+	} else if d.User != "" {
+		u.User = url.User(d.User)
+	}
+	query := url.Values{}
+	for key, value := range d.Options {
+		query.Set(key, value)
+	}
+	if d.SSLMode != "" {
+		query.Set("sslmode", d.SSLMode)
+	}
+	// Encode sorts the keys
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Env returns the variables deploy.yml adds to the app Secret: DATABASE_URL and the discrete POSTGRES_* variables,
+// which aren't encoded.
+func (d *Database) Env() map[string]string {
+	env := map[string]string{
+		"DATABASE_URL":  d.URL(),
+		"POSTGRES_HOST": d.Host,
+		"POSTGRES_PORT": strconv.Itoa(d.Port),
+		"POSTGRES_USER": d.User,
+		"POSTGRES_DB":   d.Name,
+	}
+	if d.Password != "" {
+		env["POSTGRES_PASSWORD"] = d.Password
+	}
+	if d.SSLMode != "" {
+		env["PGSSLMODE"] = d.SSLMode
+	}
+	return env
+}
+
+// Values returns the values of the chart for the database, application.database_url.
+func (d *Database) Values() map[string]interface{} {
+	return map[string]interface{}{
+		"application": map[string]interface{}{"database_url": d.URL()},
+	}
+}
@@ -0,0 +1,443 @@
+// Package deploy is the deploy job of deploy.yml, which runs cmd/deploy. It deploys an app with the Helm and client-go
+// libraries instead of the shell steps the job had:
+//
+//  1. check the access to the namespace, KUBE_NAMESPACE or the app name, like `kubectl get pod`,
+//  2. install or upgrade the PostgreSQL release if POSTGRES_ENABLED is set,
+//  3. build the values of the app (see package deployvalues) and its database URL (see package database),
+//  4. replace the app Secret with the K8S_SECRET_ variables and the database variables (see package appsecret),
+//  5. install or upgrade the release of the app like `helm upgrade --install --atomic --wait`.
+//
+// NewPlan computes the names, values and the Secret without a cluster, and Deployer.Apply applies a plan. The names
+// are the names the shell steps derived (see slug.Legacy), so the releases of existing deployments are upgraded.
+// Unlike the shell steps, application.secretName is the name of the Secret that is created, and
+// application.secretChecksum is set, so the pods are replaced when a secret changes.
+package deploy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/appsecret"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/database"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/deployvalues"
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/slug"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"helm.sh/helm/v3/pkg/strvals"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// PostgresChart is the chart of the PostgreSQL release.
+	PostgresChart = "oci://registry-1.docker.io/bitnamicharts/postgresql"
+	// PostgresChartVersion is the version of PostgresChart deploy.yml installs.
+	PostgresChartVersion = "16.7.27"
+	// DefaultTimeout is the time `helm upgrade --wait` waits for the resources by default.
+	DefaultTimeout = 5 * time.Minute
+)
+
+// Postgres are the settings of the PostgreSQL release.
+type Postgres struct {
+	// Version is the version of PostgresChart.
+	Version string
+	// User, Password and Database are POSTGRES_USER, POSTGRES_PASSWORD and POSTGRES_DB.
+	User     string
+	Password string
+	Database string
+	// Repository and Tag are the image, POSTGRES_REPOSITORY and POSTGRES_VERSION.
+	Repository string
+	Tag        string
+	// OSShellRepository is the image of the volume permissions init container, OSSHELL_REPOSITORY.
+	OSShellRepository string
+	// Size is the size of the volume, POSTGRES_SIZE.
+	Size string
+	// ResourcesPreset is POSTGRES_RESOURCES_PRESET, e.g. small.
+	ResourcesPreset string
+}
+
+// DefaultPostgres returns the settings deploy.yml uses if the variables aren't set.
+func DefaultPostgres() Postgres {
+	return Postgres{
+		Version:           PostgresChartVersion,
+		Repository:        "bitnamilegacy/postgresql",
+		Tag:               "15.9.0",
+		OSShellRepository: "bitnamisecure/os-shell",
+		Size:              "1Gi",
+		ResourcesPreset:   "small",
+	}
+}
+
+// values returns the values of the PostgreSQL chart for the release.
+func (p Postgres) values(release string) map[string]interface{} {
+	return map[string]interface{}{
+		"fullnameOverride": release,
+		"auth": map[string]interface{}{
+			"username": p.User,
+			"password": p.Password,
+			"database": p.Database,
+		},
+		"global": map[string]interface{}{
+			"security": map[string]interface{}{"allowInsecureImages": true},
+		},
+		// only needed for older images like 9.6.16
+		"volumePermissions": map[string]interface{}{
+			"enabled": true,
+			"image":   map[string]interface{}{"repository": p.OSShellRepository, "tag": "latest"},
+		},
+		"image":           map[string]interface{}{"repository": p.Repository, "tag": p.Tag},
+		"persistence":     map[string]interface{}{"size": p.Size},
+		"resourcesPreset": p.ResourcesPreset,
+	}
+}
+
+// Config are the inputs and variables of deploy.yml.
+type Config struct {
+	// Inputs are the inputs of the values of the app, Inputs.AppName and Inputs.RefName also derive the names.
+	Inputs deployvalues.Inputs
+	// DeriveNames derives DNS-1123 names with slug.Derive instead of the names of deploy.yml.
+	DeriveNames bool
+	// Namespace is KUBE_NAMESPACE, the namespace of the derived names if it is empty.
+	Namespace string
+	// CallerDir is the repository of the app, with the values file and optionally the chart of the app.
+	CallerDir string
+	// ReplaceValues uses the values file of the app instead of the generated values, like deploy.yml.
+	ReplaceValues bool
+	// Chart is the chart of the app. If it is empty, the chart is the `chart` directory of the repository of the
+	// app if it has a Chart.yaml, or else DefaultChart.
+	Chart        string
+	DefaultChart string
+	// Postgres are the settings of the PostgreSQL release, nil unless POSTGRES_ENABLED is set.
+	Postgres *Postgres
+	// Database is the database of the app, the PostgreSQL release if Postgres is set.
+	Database database.Source
+	// DeployDatabase is DEPLOY_DATABASE, by default true unless the app has a PostgreSQL release or server.
+	DeployDatabase string
+	// Secrets are the secrets and variables of the K8S_SECRET_ variables.
+	Secrets appsecret.Sources
+	// ValuesFiles and SetValues are additional values like `helm --values` and `--set`, e.g. of
+	// HELM_UPGRADE_EXTRA_ARGS.
+	ValuesFiles []string
+	SetValues   []string
+	// Timeout is the time to wait for the releases, DefaultTimeout if it is 0.
+	Timeout time.Duration
+}
+
+// Release is a release of a plan.
+type Release struct {
+	Name    string
+	Chart   string
+	Version string
+	Values  map[string]interface{}
+}
+
+// Plan is what a deployment does.
+type Plan struct {
+	Namespace string
+	Postgres  *Release
+	Secret    *corev1.Secret
+	App       Release
+	Timeout   time.Duration
+}
+
+// NewPlan returns the plan of a deployment.
+func NewPlan(config Config) (*Plan, error) {
+	names := slug.Legacy(config.Inputs.AppName, config.Inputs.RefName)
+	if config.DeriveNames {
+		names = slug.Derive(config.Inputs.AppName, config.Inputs.RefName)
+	}
+	plan := &Plan{
+		Namespace: config.Namespace,
+		Timeout:   config.Timeout,
+	}
+	if plan.Namespace == "" {
+		plan.Namespace = names.Namespace
+	}
+	if plan.Timeout == 0 {
+		plan.Timeout = DefaultTimeout
+	}
+
+	source := config.Database
+	if config.Postgres != nil {
+		plan.Postgres = &Release{
+			Name:    names.PostgresRelease,
+			Chart:   PostgresChart,
+			Version: config.Postgres.Version,
+			Values:  config.Postgres.values(names.PostgresRelease),
+		}
+		source.PostgresEnabled = true
+		source.PostgresRelease = names.PostgresRelease
+		source.User = config.Postgres.User
+		source.Password = config.Postgres.Password
+		source.Name = config.Postgres.Database
+	}
+	db, err := database.Resolve(source)
+	if err != nil {
+		return nil, err
+	}
+
+	// the Secret of deploy.yml has SERVICE_ID and PUBLIC_URL
+	secrets := config.Secrets
+	secrets.DeployExtras = true
+	env, err := appsecret.Collect(secrets)
+	if err != nil {
+		return nil, err
+	}
+	databaseURL := ""
+	if db != nil {
+		databaseURL = db.URL()
+		for name, value := range db.Env() {
+			env[name] = value
+		}
+	}
+	env["DEPLOY_DATABASE"] = config.DeployDatabase
+	if config.DeployDatabase == "" {
+		env["DEPLOY_DATABASE"] = strconv.FormatBool(source.Host == "" && config.Postgres == nil)
+	}
+	plan.Secret = &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: names.Secret, Namespace: plan.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: env,
+	}
+
+	plan.App = Release{Name: names.Release, Chart: config.Chart}
+	if plan.App.Chart == "" {
+		plan.App.Chart = config.DefaultChart
+		if _, err := os.Stat(filepath.Join(config.CallerDir, "chart", "Chart.yaml")); err == nil {
+			plan.App.Chart = filepath.Join(config.CallerDir, "chart")
+		}
+	}
+	opts := deployvalues.Options{Replace: config.ReplaceValues}
+	if callerFile, err := deployvalues.FindCallerFile(config.CallerDir); err != nil {
+		return nil, err
+	} else if callerFile != "" {
+		if opts.CallerValues, err = os.ReadFile(callerFile); err != nil {
+			return nil, err
+		}
+	}
+	// the values file of the app can reference the database variables deploy.yml exports
+	in := config.Inputs
+	in.Env = map[string]string{}
+	for name, value := range config.Inputs.Env {
+		in.Env[name] = value
+	}
+	for _, name := range []string{"DATABASE_URL", "DEPLOY_DATABASE"} {
+		if value, ok := env[name]; ok {
+			in.Env[name] = value
+		}
+	}
+	values, err := deployvalues.Build(in, opts)
+	if err != nil {
+		return nil, err
+	}
+	// like helm, the values files are merged before the --set values of deploy.yml and HELM_UPGRADE_EXTRA_ARGS
+	for _, file := range config.ValuesFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fileValues := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		values = chartutil.CoalesceTables(fileValues, values)
+	}
+	sets := append([]string{
+		"application.database_url=" + escapeSetValue(databaseURL),
+		"application.secretName=" + escapeSetValue(names.Secret),
+		"application.secretChecksum=" + env.Checksum(),
+	}, config.SetValues...)
+	for _, set := range sets {
+		if err := strvals.ParseInto(set, values); err != nil {
+			return nil, fmt.Errorf("failed parsing --set data %q: %w", set, err)
+		}
+	}
+	plan.App.Values = values
+	return plan, nil
+}
+
+// escapeSetValue escapes the characters strvals splits values at.
+func escapeSetValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`).Replace(value)
+}
+
+// Write writes the plan without the values of the Secret and passwords.
+func (p *Plan) Write(w io.Writer) error {
+	fmt.Fprintf(w, "namespace: %s\n", p.Namespace)
+	if p.Postgres != nil {
+		fmt.Fprintf(w, "release %s: %s %s\n", p.Postgres.Name, p.Postgres.Chart, p.Postgres.Version)
+		if err := writeValues(w, p.Postgres.Values); err != nil {
+			return err
+		}
+	}
+	names := appsecret.Env(p.Secret.StringData).Names()
+	fmt.Fprintf(w, "secret %s: %s\n", p.Secret.Name, strings.Join(names, ", "))
+	fmt.Fprintf(w, "release %s: %s\n", p.App.Name, p.App.Chart)
+	return writeValues(w, p.App.Values)
+}
+
+// redacted are the paths of the values Write doesn't print.
+var redacted = [][]string{{"auth", "password"}, {"application", "database_url"}}
+
+func writeValues(w io.Writer, values map[string]interface{}) error {
+	values, err := copyValues(values)
+	if err != nil {
+		return err
+	}
+	for _, path := range redacted {
+		parent := chartutil.Values(values)
+		table, err := parent.Table(strings.Join(path[:len(path)-1], "."))
+		if err != nil {
+			continue
+		}
+		if value, ok := table[path[len(path)-1]]; ok && value != "" {
+			table[path[len(path)-1]] = "<redacted>"
+		}
+	}
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if _, err := fmt.Fprintf(w, "  %s", line); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// copyValues returns a deep copy of the values.
+func copyValues(values map[string]interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	copied := map[string]interface{}{}
+	return copied, yaml.Unmarshal(data, &copied)
+}
+
+// DecodeKubeConfig decodes KUBE_CONFIG, a base64 encoded kubeconfig, and checks that it is a kubeconfig.
+func DecodeKubeConfig(encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("KUBE_CONFIG is not base64 encoded: %w", err)
+	}
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("KUBE_CONFIG is not a kubeconfig: %w", err)
+	}
+	if config.CurrentContext == "" || config.Contexts[config.CurrentContext] == nil {
+		return nil, fmt.Errorf("KUBE_CONFIG has no current context")
+	}
+	return data, nil
+}
+
+// Deployer applies plans to a cluster.
+type Deployer struct {
+	Clientset kubernetes.Interface
+	// Helm returns the Helm configuration of a namespace.
+	Helm func(namespace string) (*action.Configuration, error)
+	// LoadChart loads a chart of a repository, e.g. PostgresChart.
+	LoadChart func(name, version string) (*chart.Chart, error)
+	// Out is where the steps are logged.
+	Out io.Writer
+}
+
+// Apply applies the plan.
+func (d *Deployer) Apply(ctx context.Context, plan *Plan) error {
+	if _, err := d.Clientset.CoreV1().Pods(plan.Namespace).List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return fmt.Errorf("namespace %s: %w", plan.Namespace, err)
+	}
+	helm, err := d.Helm(plan.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if plan.Postgres != nil {
+		c, err := d.LoadChart(plan.Postgres.Chart, plan.Postgres.Version)
+		if err != nil {
+			return fmt.Errorf("release %s: %w", plan.Postgres.Name, err)
+		}
+		if err := d.upgradeInstall(helm, plan.Namespace, *plan.Postgres, c, plan.Timeout); err != nil {
+			return err
+		}
+	}
+
+	if err := d.replaceSecret(ctx, plan.Secret); err != nil {
+		return err
+	}
+
+	c, err := loader.Load(plan.App.Chart)
+	if err != nil {
+		return fmt.Errorf("release %s: %w", plan.App.Name, err)
+	}
+	if req := c.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(c, req); err != nil {
+			return fmt.Errorf("release %s: %w", plan.App.Name, err)
+		}
+	}
+	return d.upgradeInstall(helm, plan.Namespace, plan.App, c, plan.Timeout)
+}
+
+// replaceSecret deletes and creates the Secret like `kubectl replace --force`.
+func (d *Deployer) replaceSecret(ctx context.Context, secret *corev1.Secret) error {
+	secrets := d.Clientset.CoreV1().Secrets(secret.Namespace)
+	if err := secrets.Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("secret %s: %w", secret.Name, err)
+	}
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("secret %s: %w", secret.Name, err)
+	}
+	names := appsecret.Env(secret.StringData).Names()
+	fmt.Fprintf(d.Out, "secret %s replaced: %s\n", secret.Name, strings.Join(names, ", "))
+	return nil
+}
+
+// upgradeInstall upgrades the release or installs it if it doesn't exist, like `helm upgrade --install --atomic
+// --wait`.
+func (d *Deployer) upgradeInstall(helm *action.Configuration, namespace string, r Release, c *chart.Chart, timeout time.Duration) error {
+	history := action.NewHistory(helm)
+	history.Max = 1
+	var deployed *release.Release
+	_, err := history.Run(r.Name)
+	switch {
+	case errors.Is(err, driver.ErrReleaseNotFound):
+		install := action.NewInstall(helm)
+		install.Namespace = namespace
+		install.ReleaseName = r.Name
+		install.Atomic = true
+		install.Wait = true
+		install.Timeout = timeout
+		deployed, err = install.Run(c, r.Values)
+	case err == nil:
+		upgrade := action.NewUpgrade(helm)
+		upgrade.Namespace = namespace
+		upgrade.Atomic = true
+		upgrade.Wait = true
+		upgrade.Timeout = timeout
+		deployed, err = upgrade.Run(r.Name, c, r.Values)
+	}
+	if err != nil {
+		return fmt.Errorf("release %s: %w", r.Name, err)
+	}
+	fmt.Fprintf(d.Out, "release %s deployed: revision %d of %s %s\n", deployed.Name, deployed.Version, c.Metadata.Name, c.Metadata.Version)
+	return nil
+}
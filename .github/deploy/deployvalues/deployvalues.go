@@ -0,0 +1,241 @@
+// Package deployvalues builds the auto-deploy-values.yaml the deploy workflow (.github/workflows/deploy.yml) passes
+// to `helm upgrade`, from the inputs of the workflow:
+//
+//   - the values deploy.yml generates from APP_NAME, APP_ROOT, DOCKER_TAG, PUBLIC_URL, KUBE_INGRESS_BASE_DOMAIN,
+//     SERVICE_ID, default_port and do_not_generate_additional_host_names,
+//   - merged with the `.github/auto-deploy-values.yaml`, or else `.gitlab/auto-deploy-values.yaml`, of the app,
+//     whose values take precedence. The variables deploy.yml passes to `envsubst`, e.g. `$tag` or
+//     `${public_url}`, are substituted in the file first.
+//
+// deploy.yml uses the file of the app instead of the generated values, Build does the same with Replace.
+package deployvalues
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gitlab-org/charts/auto-deploy-app/deploy/slug"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+// CallerFiles are the values files of an app, relative to its repository, in the order they are looked up.
+var CallerFiles = []string{".github/auto-deploy-values.yaml", ".gitlab/auto-deploy-values.yaml"}
+
+// Variables are the variables deploy.yml substitutes with `envsubst` in the values file of an app. The variables
+// in upper case are taken from the environment of the workflow, e.g. DATABASE_URL, and are empty unless set in
+// Inputs.Env.
+var Variables = []string{
+	"repo_url", "ref_name", "environment_short", "kube_ingress_base_domain", "public_url", "service_id",
+	"docker_tag", "repository", "tag", "app_name", "app_name_in_url",
+	"POSTGRES_ENABLED", "POSTGRES_HOST", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB", "POSTGRES_VERSION",
+	"POSTGRES_SIZE", "DATABASE_URL", "DEPLOY_DATABASE",
+}
+
+// Inputs are the inputs of deploy.yml and the context of the workflow run the values are built from.
+type Inputs struct {
+	// AppName is APP_NAME, e.g. "my_app review".
+	AppName string
+	// AppRoot is APP_ROOT, the path of the liveness and readiness probes, and the app root of the Ingress
+	// unless it is "/".
+	AppRoot string
+	// DockerTag is the image reference the docker/metadata-action step outputs for DOCKER_TAG, e.g.
+	// "registry.example.com/group/app:0123abcd".
+	DockerTag string
+	// PublicURL is PUBLIC_URL, https://<environment short>.<KubeIngressBaseDomain> if empty, see slug.Legacy.
+	PublicURL string
+	// KubeIngressBaseDomain is KUBE_INGRESS_BASE_DOMAIN.
+	KubeIngressBaseDomain string
+	// ServiceID is SERVICE_ID, the ID label of the resources.
+	ServiceID string
+	// DefaultPort is default_port, the port of the Service and the container.
+	DefaultPort string
+	// DoNotGenerateAdditionalHostNames disables the additional host <app name in URL>-<ref name>.<base domain>.
+	// deploy.yml only generates it if do_not_generate_additional_host_names is "false".
+	DoNotGenerateAdditionalHostNames bool
+	// RefName is the branch or tag the workflow runs for, github.ref_name.
+	RefName string
+	// RepositoryURL is the URL of the repository of the app, github.repositoryUrl.
+	RepositoryURL string
+	// Env are the values of the variables in upper case of Variables.
+	Env map[string]string
+}
+
+// splitImage splits an image reference into the repository and the tag. Unlike deploy.yml, which cuts at the first
+// colon, the port of a registry is part of the repository.
+func splitImage(image string) (repository, tag string, err error) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return "", "", fmt.Errorf("docker tag %q has no tag", image)
+	}
+	return image[:i], image[i+1:], nil
+}
+
+// Substitutions returns the values of Variables for the inputs.
+func (in Inputs) Substitutions() (map[string]string, error) {
+	repository, tag, err := splitImage(in.DockerTag)
+	if err != nil {
+		return nil, err
+	}
+	names := slug.Legacy(in.AppName, in.RefName)
+	publicURL := in.PublicURL
+	if publicURL == "" {
+		publicURL = fmt.Sprintf("https://%s.%s", names.EnvironmentShort, in.KubeIngressBaseDomain)
+	}
+
+	substitutions := map[string]string{
+		"repo_url":                 in.RepositoryURL,
+		"ref_name":                 names.RefName,
+		"environment_short":        names.EnvironmentShort,
+		"kube_ingress_base_domain": in.KubeIngressBaseDomain,
+		"public_url":               publicURL,
+		"service_id":               in.ServiceID,
+		"docker_tag":               in.DockerTag,
+		"repository":               repository,
+		"tag":                      tag,
+		"app_name":                 in.AppName,
+		"app_name_in_url":          names.AppNameInURL,
+	}
+	for _, variable := range Variables {
+		if _, ok := substitutions[variable]; !ok {
+			substitutions[variable] = in.Env[variable]
+		}
+	}
+	return substitutions, nil
+}
+
+// Generate returns the values deploy.yml generates for an app without a values file.
+func Generate(in Inputs) (map[string]interface{}, error) {
+	s, err := in.Substitutions()
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(in.DefaultPort)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("default port %q is not a port number", in.DefaultPort)
+	}
+
+	service := map[string]interface{}{
+		"enabled":      true,
+		"name":         "web",
+		"url":          s["public_url"],
+		"type":         "ClusterIP",
+		"externalPort": port,
+		"internalPort": port,
+	}
+	if !in.DoNotGenerateAdditionalHostNames {
+		service["additionalHosts"] = []interface{}{
+			fmt.Sprintf("%s-%s.%s", s["app_name_in_url"], s["ref_name"], s["kube_ingress_base_domain"]),
+		}
+	}
+	annotations := map[string]interface{}{"kubernetes.io/ingressClassName": "nginx"}
+	if in.AppRoot != "/" {
+		annotations["nginx.ingress.kubernetes.io/app-root"] = in.AppRoot
+	}
+
+	return map[string]interface{}{
+		"replicaCount": 1,
+		"image": map[string]interface{}{
+			"repository": s["repository"],
+			"tag":        s["tag"],
+			"pullPolicy": "Always",
+			"secrets":    []interface{}{},
+		},
+		"extraLabels": map[string]interface{}{"ID": s["service_id"]},
+		"gitlab": map[string]interface{}{
+			"app":    s["app_name"],
+			"envURL": s["repo_url"],
+		},
+		"service": service,
+		"ingress": map[string]interface{}{
+			"enabled":     true,
+			"path":        "/",
+			"annotations": annotations,
+		},
+		"livenessProbe": map[string]interface{}{
+			"path":                in.AppRoot,
+			"initialDelaySeconds": 15,
+			"timeoutSeconds":      15,
+			"scheme":              "HTTP",
+			"probeType":           "httpGet",
+		},
+		"readinessProbe": map[string]interface{}{
+			"path":                in.AppRoot,
+			"initialDelaySeconds": 5,
+			"timeoutSeconds":      3,
+			"scheme":              "HTTP",
+			"probeType":           "httpGet",
+		},
+	}, nil
+}
+
+var variableReference = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// Substitute replaces the references $name and ${name} of the variables in content like `envsubst` with a list of
+// variables. References to other variables are kept.
+func Substitute(content string, variables map[string]string) string {
+	return variableReference.ReplaceAllStringFunc(content, func(reference string) string {
+		match := variableReference.FindStringSubmatch(reference)
+		name := match[1] + match[2]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		return reference
+	})
+}
+
+// FindCallerFile returns the path of the first of CallerFiles in the repository of the app at dir, or "" if there
+// is none.
+func FindCallerFile(dir string) (string, error) {
+	for _, file := range CallerFiles {
+		path := filepath.Join(dir, file)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Options are the options of Build.
+type Options struct {
+	// CallerValues is the content of the values file of the app, nil if it has none.
+	CallerValues []byte
+	// Replace uses the values file of the app instead of merging it into the generated values, like deploy.yml.
+	Replace bool
+}
+
+// Build returns the values for the inputs, see the package documentation.
+func Build(in Inputs, opts Options) (map[string]interface{}, error) {
+	generated, err := Generate(in)
+	if err != nil {
+		return nil, err
+	}
+	if opts.CallerValues == nil {
+		return generated, nil
+	}
+
+	substitutions, err := in.Substitutions()
+	if err != nil {
+		return nil, err
+	}
+	caller := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(Substitute(string(opts.CallerValues), substitutions)), &caller); err != nil {
+		return nil, fmt.Errorf("the values file of the app is invalid: %w", err)
+	}
+	if caller == nil {
+		caller = map[string]interface{}{}
+	}
+	if opts.Replace {
+		return caller, nil
+	}
+	// like `helm --values generated.yaml --values caller.yaml`, null in the file of the app removes a value
+	return chartutil.CoalesceTables(caller, generated), nil
+}
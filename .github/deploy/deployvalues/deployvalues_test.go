@@ -0,0 +1,274 @@
+package deployvalues
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+var inputs = Inputs{
+	AppName:               "My_App review",
+	AppRoot:               "/app",
+	DockerTag:             "registry.example.com:5000/group/app:0123abcd",
+	KubeIngressBaseDomain: "apps.example.com",
+	ServiceID:             "42",
+	DefaultPort:           "5000",
+	RefName:               "feature/JIRA-123_Add_Login",
+	RepositoryURL:         "git://github.com/group/app.git",
+}
+
+// generated are the values deploy.yml generates for inputs.
+const generated = `extraLabels:
+  ID: "42"
+gitlab:
+  app: My_App review
+  envURL: git://github.com/group/app.git
+image:
+  pullPolicy: Always
+  repository: registry.example.com:5000/group/app
+  secrets: []
+  tag: 0123abcd
+ingress:
+  annotations:
+    kubernetes.io/ingressClassName: nginx
+    nginx.ingress.kubernetes.io/app-root: /app
+  enabled: true
+  path: /
+livenessProbe:
+  initialDelaySeconds: 15
+  path: /app
+  probeType: httpGet
+  scheme: HTTP
+  timeoutSeconds: 15
+readinessProbe:
+  initialDelaySeconds: 5
+  path: /app
+  probeType: httpGet
+  scheme: HTTP
+  timeoutSeconds: 3
+replicaCount: 1
+service:
+  additionalHosts:
+  - my-app-review-feature-jira-123-add-log.apps.example.com
+  enabled: true
+  externalPort: 5000
+  internalPort: 5000
+  name: web
+  type: ClusterIP
+  url: https://jira-123-add-login.apps.example.com
+`
+
+func TestSubstitute(t *testing.T) {
+	variables := map[string]string{"tag": "1.0", "public_url": "https://example.com", "DATABASE_URL": ""}
+	require.Equal(t,
+		`tag: "1.0" url: https://example.com/path db: "" other: $HOME ${tagged} $tag_ $ $1`,
+		Substitute(`tag: "$tag" url: ${public_url}/path db: "$DATABASE_URL" other: $HOME ${tagged} $tag_ $ $1`, variables))
+}
+
+func TestBuild(t *testing.T) {
+	tcs := []struct {
+		name   string
+		inputs func(in *Inputs)
+		opts   Options
+
+		expectedValues string
+		expectedError  string
+	}{
+		{
+			name:           "generated",
+			expectedValues: generated,
+		},
+		{
+			name: "public URL, root path and no additional hosts",
+			inputs: func(in *Inputs) {
+				in.PublicURL = "https://app.example.com"
+				in.AppRoot = "/"
+				in.DoNotGenerateAdditionalHostNames = true
+				in.DefaultPort = "8080"
+			},
+			expectedValues: `extraLabels:
+  ID: "42"
+gitlab:
+  app: My_App review
+  envURL: git://github.com/group/app.git
+image:
+  pullPolicy: Always
+  repository: registry.example.com:5000/group/app
+  secrets: []
+  tag: 0123abcd
+ingress:
+  annotations:
+    kubernetes.io/ingressClassName: nginx
+  enabled: true
+  path: /
+livenessProbe:
+  initialDelaySeconds: 15
+  path: /
+  probeType: httpGet
+  scheme: HTTP
+  timeoutSeconds: 15
+readinessProbe:
+  initialDelaySeconds: 5
+  path: /
+  probeType: httpGet
+  scheme: HTTP
+  timeoutSeconds: 3
+replicaCount: 1
+service:
+  enabled: true
+  externalPort: 8080
+  internalPort: 8080
+  name: web
+  type: ClusterIP
+  url: https://app.example.com
+`,
+		},
+		{
+			name: "values of the app are merged",
+			inputs: func(in *Inputs) {
+				in.Env = map[string]string{"DATABASE_URL": "postgres://user:p@ss@db:5432/app"}
+			},
+			opts: Options{CallerValues: []byte(`replicaCount: 2
+image:
+  tag: "$tag-debug"
+service:
+  url: "${public_url}/"
+  additionalHosts: null
+application:
+  database_url: $DATABASE_URL
+livenessProbe: null
+readinessProbe:
+  path: /health
+`)},
+			expectedValues: `application:
+  database_url: postgres://user:p@ss@db:5432/app
+extraLabels:
+  ID: "42"
+gitlab:
+  app: My_App review
+  envURL: git://github.com/group/app.git
+image:
+  pullPolicy: Always
+  repository: registry.example.com:5000/group/app
+  secrets: []
+  tag: 0123abcd-debug
+ingress:
+  annotations:
+    kubernetes.io/ingressClassName: nginx
+    nginx.ingress.kubernetes.io/app-root: /app
+  enabled: true
+  path: /
+readinessProbe:
+  initialDelaySeconds: 5
+  path: /health
+  probeType: httpGet
+  scheme: HTTP
+  timeoutSeconds: 3
+replicaCount: 2
+service:
+  enabled: true
+  externalPort: 5000
+  internalPort: 5000
+  name: web
+  type: ClusterIP
+  url: https://jira-123-add-login.apps.example.com/
+`,
+		},
+		{
+			name: "substituted values aren't quoted, like envsubst",
+			inputs: func(in *Inputs) {
+				in.AppName = `app: "review" #1`
+				in.ServiceID = "on"
+				in.DoNotGenerateAdditionalHostNames = true
+				in.PublicURL = "https://app.example.com"
+			},
+			opts:          Options{CallerValues: []byte("gitlab:\n  app: \"$app_name\"\nextraLabels:\n  ID: $service_id\n"), Replace: true},
+			expectedError: "the values file of the app is invalid: error converting YAML to JSON: yaml: line 1: did not find expected key",
+		},
+		{
+			name: "values of the app replace the generated values",
+			opts: Options{CallerValues: []byte("image:\n  repository: $repository\n  tag: \"$tag\"\n"), Replace: true},
+			expectedValues: `image:
+  repository: registry.example.com:5000/group/app
+  tag: 0123abcd
+`,
+		},
+		{
+			name:           "empty values file of the app",
+			opts:           Options{CallerValues: []byte{}, Replace: true},
+			expectedValues: "{}\n",
+		},
+		{
+			name:          "invalid values file of the app",
+			opts:          Options{CallerValues: []byte("image: [")},
+			expectedError: "the values file of the app is invalid: error converting YAML to JSON: yaml: line 1: did not find expected node content",
+		},
+		{
+			name:          "docker tag without a tag",
+			inputs:        func(in *Inputs) { in.DockerTag = "registry.example.com:5000/group/app" },
+			expectedError: `docker tag "registry.example.com:5000/group/app" has no tag`,
+		},
+		{
+			name:          "invalid port",
+			inputs:        func(in *Inputs) { in.DefaultPort = "http" },
+			expectedError: `default port "http" is not a port number`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			in := inputs
+			if tc.inputs != nil {
+				tc.inputs(&in)
+			}
+
+			values, err := Build(in, tc.opts)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			data, err := yaml.Marshal(values)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedValues, string(data))
+		})
+	}
+}
+
+func TestGenerate_Quoting(t *testing.T) {
+	in := inputs
+	in.AppName = `app: "review" #1`
+	in.ServiceID = "on"
+	in.AppRoot = "/*"
+	values, err := Generate(in)
+	require.NoError(t, err)
+	data, err := yaml.Marshal(values)
+	require.NoError(t, err)
+
+	parsed := map[string]interface{}{}
+	require.NoError(t, yaml.Unmarshal(data, &parsed))
+	require.Equal(t, `app: "review" #1`, parsed["gitlab"].(map[string]interface{})["app"])
+	require.Equal(t, "on", parsed["extraLabels"].(map[string]interface{})["ID"])
+	require.Equal(t, "/*", parsed["livenessProbe"].(map[string]interface{})["path"])
+	// deploy.yml only replaces spaces and underscores in the host
+	require.Equal(t, []interface{}{`app:-"review"-#1-feature-jira-123-add-log.apps.example.com`}, parsed["service"].(map[string]interface{})["additionalHosts"])
+}
+
+func TestFindCallerFile(t *testing.T) {
+	dir := t.TempDir()
+	path, err := FindCallerFile(dir)
+	require.NoError(t, err)
+	require.Empty(t, path)
+
+	for _, file := range []string{".gitlab/auto-deploy-values.yaml", ".github/auto-deploy-values.yaml"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte("replicaCount: 2\n"), 0644))
+
+		path, err := FindCallerFile(dir)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, file), path)
+	}
+}
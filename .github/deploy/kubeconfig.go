@@ -0,0 +1,75 @@
+package deploy
+
+import (
+	"helm.sh/helm/v3/pkg/cli"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// RESTClientGetters returns a function returning the RESTClientGetter of a namespace for the cluster of KUBE_CONFIG,
+// the base64 encoded kubeconfig encoded, or of the kubeconfig of settings if encoded is empty.
+func RESTClientGetters(settings *cli.EnvSettings, encoded string) (func(namespace string) (genericclioptions.RESTClientGetter, error), error) {
+	if encoded == "" {
+		return func(namespace string) (genericclioptions.RESTClientGetter, error) {
+			settings.SetNamespace(namespace)
+			return settings.RESTClientGetter(), nil
+		}, nil
+	}
+	data, err := DecodeKubeConfig(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return func(namespace string) (genericclioptions.RESTClientGetter, error) {
+		return NewRESTClientGetter(data, namespace)
+	}, nil
+}
+
+// NewRESTClientGetter returns the RESTClientGetter for helm of a kubeconfig in memory, e.g. of DecodeKubeConfig, so
+// the kubeconfig of KUBE_CONFIG isn't written to a file. The namespace overrides the one of the current context.
+func NewRESTClientGetter(kubeConfig []byte, namespace string) (genericclioptions.RESTClientGetter, error) {
+	config, err := clientcmd.Load(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.Context.Namespace = namespace
+	return &restClientGetter{clientConfig: clientcmd.NewDefaultClientConfig(*config, overrides)}, nil
+}
+
+type restClientGetter struct {
+	clientConfig clientcmd.ClientConfig
+}
+
+func (g *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return g.clientConfig.ClientConfig()
+}
+
+func (g *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	config, err := g.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(client), nil
+}
+
+func (g *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	client, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(client)
+	return restmapper.NewShortcutExpander(mapper, client), nil
+}
+
+func (g *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return g.clientConfig
+}
@@ -0,0 +1,150 @@
+// Package slug derives the names of a deployment, e.g. the Helm release and the additional host, from the name of
+// the app and the git ref it is deployed for.
+//
+// Legacy returns the names the workflows derive with sed, tr and cut, which aren't always valid names: they keep
+// characters Kubernetes doesn't allow, and names cut to 24 characters can collide. Derive returns DNS-1123 labels
+// instead, which are the same as the legacy names for the usual names of apps and branches. A name that is too
+// long is cut and ends with a hash of the complete name, so names that only differ after the cut don't collide.
+package slug
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+const (
+	// ReleaseLength is the length of release names. The workflows cut them to 24 characters, which leaves room for
+	// the suffixes of the chart, e.g. `-auto-deploy` and `-postgres`.
+	ReleaseLength = 24
+	// EnvironmentLength is the length of the short environment name, the subdomain of the default public URL.
+	EnvironmentLength = 24
+	// LabelLength is the length of a DNS-1123 label, e.g. a namespace or a part of a host.
+	LabelLength = 63
+	// hashLength is the length of the hash a cut slug ends with.
+	hashLength = 8
+)
+
+// Names are the names of a deployment of an app.
+type Names struct {
+	// Release is the name of the Helm release of the app.
+	Release string `json:"release"`
+	// PostgresRelease is the name of the Helm release of the PostgreSQL database, and its host.
+	PostgresRelease string `json:"postgresRelease"`
+	// Namespace is the namespace of the deployment unless KUBE_NAMESPACE is set.
+	Namespace string `json:"namespace"`
+	// Secret is the name of the Secret with the K8S_SECRET_ variables of the app.
+	Secret string `json:"secret"`
+	// AppNameInURL is the name of the app in hosts, $app_name_in_url in deploy.yml.
+	AppNameInURL string `json:"appNameInURL"`
+	// RefName is the git ref in hosts, $ref_name in deploy.yml.
+	RefName string `json:"refName"`
+	// EnvironmentShort is the subdomain of the default public URL, $environment_short in deploy.yml.
+	EnvironmentShort string `json:"environmentShort"`
+	// AdditionalHost is the first label of the additional host, <app name in URL>-<ref name>.
+	AdditionalHost string `json:"additionalHost"`
+}
+
+// Legacy returns the names deploy.yml derives:
+//
+//	release_name=$(echo -n "$APP_NAME" | tr '[:upper:]' '[:lower:]' | tr '_' '-' | cut -c1-24 | sed 's~-*$~~')
+//	secret_name=$(echo -n "$APP_NAME" | tr '[:upper:]' '[:lower:]' | tr '_' '-')
+//	ref_name=$(echo -n "$GITHUB_REF_NAME" | tr '/' '-' | tr '_' '-' | tr '[:upper:]' '[:lower:]' | cut -c1-24 | sed 's~-*$~~')
+//	environment_short="$(echo -n $GITHUB_REF_NAME | sed 's/feature[_/]//' | tr '_' '-' | tr '[:upper:]' '[:lower:]' | cut -c1-24 | sed 's~-*$~~')"
+//	app_name_in_url=$(echo -n "${APP_NAME// /-}" | tr '_' '-' | tr '[:upper:]' '[:lower:]')
+//
+// The PostgreSQL release and the namespace are the app name as it is.
+func Legacy(appName, ref string) Names {
+	names := Names{
+		Release:          cut(lower(strings.ReplaceAll(appName, "_", "-")), ReleaseLength),
+		PostgresRelease:  appName + "-postgres",
+		Namespace:        appName,
+		Secret:           lower(strings.ReplaceAll(appName, "_", "-")),
+		AppNameInURL:     lower(strings.NewReplacer(" ", "-", "_", "-").Replace(appName)),
+		RefName:          cut(lower(strings.NewReplacer("/", "-", "_", "-").Replace(ref)), 24),
+		EnvironmentShort: cut(lower(strings.ReplaceAll(replaceFirst(legacyEnvironmentPrefix, ref), "_", "-")), EnvironmentLength),
+	}
+	names.AdditionalHost = names.AppNameInURL + "-" + names.RefName
+	return names
+}
+
+// HerokuishTestName is the name the herokuish test workflows give the test container before the random suffix:
+//
+//	echo -n "$GITHUB_REF_NAME" | sed 's/\(chore\|docs\|fix\|feat\(ure\)\{0,1\}\)[_/]//i' | tr '_' '-' | tr '[:upper:]' '[:lower:]' | cut -c -63
+func HerokuishTestName(ref string) string {
+	name := lower(strings.ReplaceAll(replaceFirst(herokuishPrefix, ref), "_", "-"))
+	if len(name) > LabelLength {
+		name = name[:LabelLength]
+	}
+	return name
+}
+
+var (
+	legacyEnvironmentPrefix = regexp.MustCompile(`feature[_/]`)
+	herokuishPrefix         = regexp.MustCompile(`(?i)(chore|docs|fix|feat(ure)?)[_/]`)
+	// branchPrefix are the prefixes of branch names Derive removes from the short environment name.
+	branchPrefix = regexp.MustCompile(`(?i)^(chore|docs|fix|feat|feature)[_/]`)
+	invalid      = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Derive returns the names of a deployment as DNS-1123 labels, see Slug:
+//
+//   - the release and the secret are the app name, the release cut to ReleaseLength,
+//   - the PostgreSQL release is the release with the suffix `-postgres`,
+//   - the short environment name is the ref without a leading feat/, feature/, fix/, chore/ or docs/ (or with
+//     `_`), cut to EnvironmentLength,
+//   - the additional host is <app name>-<ref>, cut to LabelLength.
+func Derive(appName, ref string) Names {
+	names := Names{
+		Release:          Slug(appName, ReleaseLength),
+		Namespace:        Slug(appName, LabelLength),
+		Secret:           Slug(appName, LabelLength),
+		AppNameInURL:     Slug(appName, LabelLength),
+		RefName:          Slug(ref, LabelLength),
+		EnvironmentShort: Slug(branchPrefix.ReplaceAllString(ref, ""), EnvironmentLength),
+		AdditionalHost:   Slug(appName+"-"+ref, LabelLength),
+	}
+	names.PostgresRelease = names.Release + "-postgres"
+	return names
+}
+
+// Slug returns s as a DNS-1123 label of at most max characters: in lower case, with every sequence of characters
+// other than letters and digits replaced with '-' and without leading or trailing dashes. If it is longer than max,
+// it is cut and ends with '-' and a hash of s, so slugs of different strings with the same beginning differ.
+// max has to be greater than the length of the hash.
+func Slug(s string, max int) string {
+	slug := strings.Trim(invalid.ReplaceAllString(lower(s), "-"), "-")
+	if len(slug) <= max {
+		return slug
+	}
+	sum := sha256.Sum256([]byte(s))
+	hash := hex.EncodeToString(sum[:])[:hashLength]
+	return strings.TrimRight(slug[:max-hashLength-1], "-") + "-" + hash
+}
+
+// lower lower cases the ASCII letters of s like `tr '[:upper:]' '[:lower:]'`.
+func lower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// cut cuts s to n bytes and removes trailing dashes like `cut -c1-<n> | sed 's~-*$~~'`.
+func cut(s string, n int) string {
+	if len(s) > n {
+		s = s[:n]
+	}
+	return strings.TrimRight(s, "-")
+}
+
+// replaceFirst removes the first match of re in s like `sed 's/<re>//'`.
+func replaceFirst(re *regexp.Regexp, s string) string {
+	if loc := re.FindStringIndex(s); loc != nil {
+		return s[:loc[0]] + s[loc[1]:]
+	}
+	return s
+}
@@ -0,0 +1,184 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// The expected legacy names are the output of the shell commands of the workflows.
+func TestLegacy_Ref(t *testing.T) {
+	tcs := []struct {
+		ref string
+
+		expectedRefName           string
+		expectedEnvironmentShort  string
+		expectedHerokuishTestName string
+	}{
+		{ref: "main", expectedRefName: "main", expectedEnvironmentShort: "main", expectedHerokuishTestName: "main"},
+		{ref: "feature/Add_Login", expectedRefName: "feature-add-login", expectedEnvironmentShort: "add-login", expectedHerokuishTestName: "add-login"},
+		{ref: "feat_login", expectedRefName: "feat-login", expectedEnvironmentShort: "feat-login", expectedHerokuishTestName: "login"},
+		{ref: "Fix/login", expectedRefName: "fix-login", expectedEnvironmentShort: "fix/login", expectedHerokuishTestName: "login"},
+		{ref: "prefix/x", expectedRefName: "prefix-x", expectedEnvironmentShort: "prefix/x", expectedHerokuishTestName: "prex"},
+		{ref: "chore_deps", expectedRefName: "chore-deps", expectedEnvironmentShort: "chore-deps", expectedHerokuishTestName: "deps"},
+		{ref: "docs/readme", expectedRefName: "docs-readme", expectedEnvironmentShort: "docs/readme", expectedHerokuishTestName: "readme"},
+		{ref: "team/feature/login", expectedRefName: "team-feature-login", expectedEnvironmentShort: "team/login", expectedHerokuishTestName: "team/login"},
+		{ref: "release-2024-01-01-hotfix-x", expectedRefName: "release-2024-01-01-hotfi", expectedEnvironmentShort: "release-2024-01-01-hotfi", expectedHerokuishTestName: "release-2024-01-01-hotfix-x"},
+		{ref: "Ünicode", expectedRefName: "Ünicode", expectedEnvironmentShort: "Ünicode", expectedHerokuishTestName: "Ünicode"},
+		{
+			ref:                       "dependabot/npm_and_yarn/express-4.18.2",
+			expectedRefName:           "dependabot-npm-and-yarn",
+			expectedEnvironmentShort:  "dependabot/npm-and-yarn/",
+			expectedHerokuishTestName: "dependabot/npm-and-yarn/express-4.18.2",
+		},
+		{
+			ref:                       "feature/a-very-long-branch-name-that-exceeds-sixty-three-characters-by-quite-a-bit",
+			expectedRefName:           "feature-a-very-long-bran",
+			expectedEnvironmentShort:  "a-very-long-branch-name",
+			expectedHerokuishTestName: "a-very-long-branch-name-that-exceeds-sixty-three-characters-by-",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.ref, func(t *testing.T) {
+			names := Legacy("app", tc.ref)
+			require.Equal(t, tc.expectedRefName, names.RefName)
+			require.Equal(t, tc.expectedEnvironmentShort, names.EnvironmentShort)
+			require.Equal(t, tc.expectedHerokuishTestName, HerokuishTestName(tc.ref))
+		})
+	}
+}
+
+func TestLegacy_AppName(t *testing.T) {
+	tcs := []struct {
+		appName string
+
+		expectedRelease      string
+		expectedSecret       string
+		expectedAppNameInURL string
+	}{
+		{appName: "my-app", expectedRelease: "my-app", expectedSecret: "my-app", expectedAppNameInURL: "my-app"},
+		{appName: "My_App", expectedRelease: "my-app", expectedSecret: "my-app", expectedAppNameInURL: "my-app"},
+		{appName: "My App", expectedRelease: "my app", expectedSecret: "my app", expectedAppNameInURL: "my-app"},
+		{appName: "app_", expectedRelease: "app", expectedSecret: "app-", expectedAppNameInURL: "app-"},
+		{
+			appName:              "review-feature-login-app-with-long-name",
+			expectedRelease:      "review-feature-login-app",
+			expectedSecret:       "review-feature-login-app-with-long-name",
+			expectedAppNameInURL: "review-feature-login-app-with-long-name",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.appName, func(t *testing.T) {
+			names := Legacy(tc.appName, "main")
+			require.Equal(t, tc.expectedRelease, names.Release)
+			require.Equal(t, tc.expectedSecret, names.Secret)
+			require.Equal(t, tc.expectedAppNameInURL, names.AppNameInURL)
+			require.Equal(t, tc.appName, names.Namespace)
+			require.Equal(t, tc.appName+"-postgres", names.PostgresRelease)
+			require.Equal(t, tc.expectedAppNameInURL+"-main", names.AdditionalHost)
+		})
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tcs := []struct {
+		s   string
+		max int
+
+		expectedSlug string
+	}{
+		{s: "my-app", max: 24, expectedSlug: "my-app"},
+		{s: "My_App review", max: 24, expectedSlug: "my-app-review"},
+		{s: "--feature//login__", max: 24, expectedSlug: "feature-login"},
+		{s: "Ünicode", max: 24, expectedSlug: "nicode"},
+		{s: "", max: 24, expectedSlug: ""},
+		{s: "review-feature-login-app", max: 24, expectedSlug: "review-feature-login-app"},
+		// the dash before the hash isn't doubled
+		{s: "review-feature-login-app-with-long-name", max: 24, expectedSlug: "review-feature-010e0f99"},
+		{s: "review-feature-login-app-with-other-name", max: 24, expectedSlug: "review-feature-bfce3501"},
+		{s: "review-feature-login-app-with-long-name", max: 63, expectedSlug: "review-feature-login-app-with-long-name"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.s, func(t *testing.T) {
+			slug := Slug(tc.s, tc.max)
+			require.Equal(t, tc.expectedSlug, slug)
+			require.LessOrEqual(t, len(slug), tc.max)
+			if slug != "" {
+				require.Empty(t, validation.IsDNS1123Label(slug))
+			}
+		})
+	}
+}
+
+func TestDerive(t *testing.T) {
+	tcs := []struct {
+		name    string
+		appName string
+		ref     string
+
+		expectedNames Names
+	}{
+		{
+			name:    "same as legacy",
+			appName: "my-app",
+			ref:     "feature/Add_Login",
+			expectedNames: Names{
+				Release:          "my-app",
+				PostgresRelease:  "my-app-postgres",
+				Namespace:        "my-app",
+				Secret:           "my-app",
+				AppNameInURL:     "my-app",
+				RefName:          "feature-add-login",
+				EnvironmentShort: "add-login",
+				AdditionalHost:   "my-app-feature-add-login",
+			},
+		},
+		{
+			name:    "invalid characters and prefixes",
+			appName: "My App",
+			ref:     "Fix/dependabot/npm_and_yarn/express-4.18.2",
+			expectedNames: Names{
+				Release:          "my-app",
+				PostgresRelease:  "my-app-postgres",
+				Namespace:        "my-app",
+				Secret:           "my-app",
+				AppNameInURL:     "my-app",
+				RefName:          "fix-dependabot-npm-and-yarn-express-4-18-2",
+				EnvironmentShort: "dependabot-npm-177e9feb",
+				AdditionalHost:   "my-app-fix-dependabot-npm-and-yarn-express-4-18-2",
+			},
+		},
+		{
+			name:    "long names",
+			appName: "review-feature-login-app-with-long-name",
+			ref:     "feature/a-very-long-branch-name-that-exceeds-sixty-three-characters-by-quite-a-bit",
+			expectedNames: Names{
+				Release:          "review-feature-010e0f99",
+				PostgresRelease:  "review-feature-010e0f99-postgres",
+				Namespace:        "review-feature-login-app-with-long-name",
+				Secret:           "review-feature-login-app-with-long-name",
+				AppNameInURL:     "review-feature-login-app-with-long-name",
+				RefName:          "feature-a-very-long-branch-name-that-exceeds-sixty-thr-c535eb47",
+				EnvironmentShort: "a-very-long-bra-6e5a1107",
+				AdditionalHost:   "review-feature-login-app-with-long-name-feature-a-very-9d25adda",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			names := Derive(tc.appName, tc.ref)
+			require.Equal(t, tc.expectedNames, names)
+			for _, name := range []string{names.Release, names.PostgresRelease, names.Namespace, names.Secret, names.AdditionalHost, names.EnvironmentShort} {
+				require.Empty(t, validation.IsDNS1123Label(name), name)
+			}
+			require.LessOrEqual(t, len(names.Release), ReleaseLength)
+			require.False(t, strings.Contains(names.EnvironmentShort, "/"))
+		})
+	}
+}